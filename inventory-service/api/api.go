@@ -0,0 +1,16 @@
+// Package api embeds the OpenAPI contract of inventory-service
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var Spec []byte
+
+// Handler serves the OpenAPI document at /openapi.json
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(Spec)
+}
@@ -2,29 +2,72 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/etag"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type InventoryHandler struct {
-	service *service.InventoryService
+	service  *service.InventoryService
+	verifier *auth.Verifier
+	keys     *auth.KeyRing
+	tenants  *tenant.Registry
 }
 
-func NewInventoryHandler(s *service.InventoryService) *InventoryHandler {
-	return &InventoryHandler{service: s}
+// NewInventoryHandler returns the inventory API, stock changes require an admin token or a service key of
+// keys. Both checks are skipped when verifier and keys are nil. Requests act for a tenant of tenants, any
+// tenant when it is nil.
+func NewInventoryHandler(s *service.InventoryService, verifier *auth.Verifier, keys *auth.KeyRing, tenants *tenant.Registry) *InventoryHandler {
+	return &InventoryHandler{service: s, verifier: verifier, keys: keys, tenants: tenants}
 }
 
-// GetAllProductsHandler handles GET /products
+// scoped returns the service acting for the tenant of the request, stock changes are recorded as made by
+// the caller
+func (h *InventoryHandler) scoped(r *http.Request) *service.InventoryService {
+	return h.service.ForTenant(tenant.FromContext(r.Context())).ForActor(auth.Actor(r.Context()))
+}
+
+// ifMatch reads the If-Match precondition of a request on the product of the id parameter. A malformed header
+// is a bad request, a header without a strong ETag fails the precondition.
+func (h *InventoryHandler) ifMatch(w http.ResponseWriter, r *http.Request) (*int64, bool) {
+	version, err := etag.IfMatch(r, func() (int64, error) {
+		product, err := h.scoped(r).GetProductByID(param(r, "id"))
+		if err != nil {
+			return 0, err
+		}
+		return product.Version, nil
+	})
+	if errors.Is(err, etag.ErrInvalidIfMatch) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return nil, false
+	}
+	return version, true
+}
+
+// GetAllProductsHandler handles GET /v1/products, ?ids=P001,P002 narrows the list down to those products
 func (h *InventoryHandler) GetAllProductsHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	var products []models.Product
+	var err error
+	if ids := r.URL.Query().Get("ids"); ids != "" {
+		products, err = h.scoped(r).GetProductsByIDs(strings.Split(ids, ","))
+	} else {
+		products, err = h.scoped(r).GetAllProducts()
 	}
-
-	products, err := h.service.GetAllProducts()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -34,21 +77,323 @@ func (h *InventoryHandler) GetAllProductsHandler(w http.ResponseWriter, r *http.
 	json.NewEncoder(w).Encode(products)
 }
 
-// GetProductByIdHandler handles GET /product?id=P001
+// GetProductByIdHandler handles GET /v1/products/{id}
 func (h *InventoryHandler) GetProductByIdHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	id := param(r, "id")
+	product, err := h.scoped(r).GetProductByID(id)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "product not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, service.ErrInvalidProductID) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	id := r.URL.Query().Get("id")
-	product, err := h.service.GetProductByID(id)
+	etag.Set(w, product.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// GetAvailabilityHandler handles GET /v1/products/{id}/availability
+func (h *InventoryHandler) GetAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	availability, err := h.scoped(r).GetAvailability(r.PathValue("id"))
 	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "product not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, service.ErrInvalidProductID) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(availability)
+}
+
+// RestockRequest is the body of POST /v1/products/{id}/restock, units without a warehouse_id are not held
+// at any warehouse. OrderID references the order of returned units.
+type RestockRequest struct {
+	Quantity    int    `json:"quantity"`
+	Reason      string `json:"reason"`
+	WarehouseID string `json:"warehouse_id"`
+	OrderID     string `json:"order_id"`
+}
+
+// RestockProductHandler handles POST /v1/products/{id}/restock
+func (h *InventoryHandler) RestockProductHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	precondition, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req RestockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	id := param(r, "id")
+	line := service.StockLine{ProductID: id, WarehouseID: req.WarehouseID, Quantity: req.Quantity, OrderID: req.OrderID}
+	product, err := h.scoped(r).RestockWarehouse(line, req.Reason, precondition)
+	if err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Product %s restocked by %d (%s)", id, req.Quantity, req.Reason)
+
+	etag.Set(w, product.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(product)
 }
+
+// AdjustStockRequest is the body of POST /v1/products/{id}/adjust, a signed correction of the stock
+type AdjustStockRequest struct {
+	Quantity    int    `json:"quantity"`
+	Reason      string `json:"reason"`
+	WarehouseID string `json:"warehouse_id"`
+}
+
+// AdjustStockHandler handles POST /v1/products/{id}/adjust
+func (h *InventoryHandler) AdjustStockHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	precondition, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req AdjustStockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	product, err := h.scoped(r).AdjustStock(r.PathValue("id"), req.WarehouseID, req.Quantity, req.Reason, precondition)
+	if err != nil {
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			http.Error(w, "product not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrVersionConflict):
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		case errors.Is(err, service.ErrInsufficientStock):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	etag.Set(w, product.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// GetMovementsHandler handles GET /v1/products/{id}/movements, ?from= and ?to= (RFC 3339) narrow the ledger
+// down to a time range and ?limit= caps the number of entries
+func (h *InventoryHandler) GetMovementsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	query := r.URL.Query()
+
+	var from, to time.Time
+	var err error
+	if v := query.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "from must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "to must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	movements, err := h.scoped(r).GetMovements(r.PathValue("id"), from, to, limit)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidProductID) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movements)
+}
+
+// SetThresholdsHandler handles PUT /v1/products/{id}/thresholds
+func (h *InventoryHandler) SetThresholdsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	precondition, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var thresholds models.StockThresholds
+	if err := json.NewDecoder(r.Body).Decode(&thresholds); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	product, err := h.scoped(r).SetThresholds(r.PathValue("id"), thresholds, precondition)
+	if err != nil {
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			http.Error(w, "product not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrVersionConflict):
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		case errors.Is(err, service.ErrInvalidProductID), errors.Is(err, service.ErrInvalidThresholds):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	etag.Set(w, product.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// SetBackorderHandler handles PUT /v1/products/{id}/backorder
+func (h *InventoryHandler) SetBackorderHandler(w http.ResponseWriter, r *http.Request) {
+	var policy models.BackorderPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	h.setBackorder(w, r, &policy)
+}
+
+// ClearBackorderHandler handles DELETE /v1/products/{id}/backorder
+func (h *InventoryHandler) ClearBackorderHandler(w http.ResponseWriter, r *http.Request) {
+	h.setBackorder(w, r, nil)
+}
+
+func (h *InventoryHandler) setBackorder(w http.ResponseWriter, r *http.Request, policy *models.BackorderPolicy) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	precondition, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	product, err := h.scoped(r).SetBackorder(r.PathValue("id"), policy, precondition)
+	if err != nil {
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			http.Error(w, "product not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrVersionConflict):
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		case errors.Is(err, service.ErrInvalidProductID), errors.Is(err, service.ErrInvalidBackorderMode):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	etag.Set(w, product.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// GetLowStockHandler handles GET /v1/products/low-stock
+func (h *InventoryHandler) GetLowStockHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	report, err := h.scoped(r).GetLowStock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// StockRequest is the body of the /v1/stock endpoints order-service moves the stock of an order with.
+// Lines without a warehouse_id move unassigned stock.
+type StockRequest struct {
+	OrderID string `json:"order_id"`
+	Reason  string `json:"reason"`
+	Lines   []struct {
+		ProductID   string `json:"product_id"`
+		WarehouseID string `json:"warehouse_id"`
+		Quantity    int    `json:"quantity"`
+	} `json:"lines"`
+}
+
+// ReserveStockHandler handles POST /v1/stock/reserve, the lines are reserved all or nothing
+func (h *InventoryHandler) ReserveStockHandler(w http.ResponseWriter, r *http.Request) {
+	h.moveStock(w, r, func(s *service.InventoryService, lines []service.StockLine, _ string) error {
+		_, err := s.ReserveStock(lines)
+		return err
+	})
+}
+
+// ReleaseStockHandler handles POST /v1/stock/release
+func (h *InventoryHandler) ReleaseStockHandler(w http.ResponseWriter, r *http.Request) {
+	h.moveStock(w, r, func(s *service.InventoryService, lines []service.StockLine, reason string) error {
+		_, err := s.ReleaseStock(lines, reason)
+		return err
+	})
+}
+
+// CommitStockHandler handles POST /v1/stock/commit
+func (h *InventoryHandler) CommitStockHandler(w http.ResponseWriter, r *http.Request) {
+	h.moveStock(w, r, func(s *service.InventoryService, lines []service.StockLine, _ string) error {
+		return s.CommitStock(lines)
+	})
+}
+
+func (h *InventoryHandler) moveStock(w http.ResponseWriter, r *http.Request, move func(*service.InventoryService, []service.StockLine, string) error) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+
+	var req StockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Lines) == 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	lines := make([]service.StockLine, len(req.Lines))
+	for i, line := range req.Lines {
+		lines[i] = service.StockLine{ProductID: line.ProductID, WarehouseID: line.WarehouseID, Quantity: line.Quantity, OrderID: req.OrderID}
+	}
+
+	if err := move(h.scoped(r), lines, req.Reason); err != nil {
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			http.Error(w, "product not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrInsufficientStock):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, service.ErrInvalidProductID), errors.Is(err, service.ErrInvalidQuantity), errors.Is(err, service.ErrUnknownWarehouse):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
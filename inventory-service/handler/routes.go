@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/api"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/router"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+)
+
+// Routes registers the versioned API and the legacy query-parameter paths as deprecated aliases
+func (h *InventoryHandler) Routes() http.Handler {
+	rt := router.New()
+
+	// The catalog is public, changing stock is reserved to admins and internal callers like order-service.
+	// Every product request acts for the tenant of the caller.
+	public := tenant.Middleware(h.tenants)
+	admin := tenant.Guard(h.tenants, auth.ServiceOr(h.keys, auth.Require(h.verifier, auth.RoleAdmin)))
+
+	rt.Handle("GET /v1/products", public(h.GetAllProductsHandler))
+	rt.Handle("GET /v1/products/{id}", public(h.GetProductByIdHandler))
+	rt.Handle("GET /v1/products/{id}/availability", public(h.GetAvailabilityHandler))
+	rt.Handle("POST /v1/products/{id}/restock", admin(h.RestockProductHandler))
+	rt.Handle("POST /v1/products/{id}/adjust", admin(h.AdjustStockHandler))
+	rt.Handle("GET /v1/products/{id}/movements", admin(h.GetMovementsHandler))
+	rt.Handle("PUT /v1/products/{id}/thresholds", admin(h.SetThresholdsHandler))
+	rt.Handle("PUT /v1/products/{id}/backorder", admin(h.SetBackorderHandler))
+	rt.Handle("DELETE /v1/products/{id}/backorder", admin(h.ClearBackorderHandler))
+	rt.Handle("GET /v1/products/low-stock", admin(h.GetLowStockHandler))
+	rt.Handle("POST /v1/stock/reserve", admin(h.ReserveStockHandler))
+	rt.Handle("POST /v1/stock/release", admin(h.ReleaseStockHandler))
+	rt.Handle("POST /v1/stock/commit", admin(h.CommitStockHandler))
+	rt.Handle("GET /openapi.json", api.Handler)
+
+	rt.Deprecated("GET /products", "/v1/products", public(h.GetAllProductsHandler))
+	rt.Deprecated("GET /product", "/v1/products/{id}", public(h.GetProductByIdHandler))
+	rt.Deprecated("POST /product/restock", "/v1/products/{id}/restock", admin(h.RestockProductHandler))
+
+	return rt
+}
+
+// param reads a route parameter, falling back to the query string used by the legacy paths
+func param(r *http.Request, name string) string {
+	if v := r.PathValue(name); v != "" {
+		return v
+	}
+	return r.URL.Query().Get(name)
+}
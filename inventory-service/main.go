@@ -4,15 +4,29 @@ import (
 	"context"
 	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/rpc"
 	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/health"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
 	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mongodb"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mtls"
+	inventoryv1 "github.com/dinesh-man/ecommerce-order-processing-system/pkg/pb/inventory/v1"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/warehouse"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/webhook"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
@@ -24,13 +38,129 @@ func main() {
 
 	mongodb.InitMongoDB()
 
-	inventoryService := service.NewInventoryService(collectionName)
-	inventoryHandler := handler.NewInventoryHandler(inventoryService)
+	// Product changes are published to a Redis stream when REDIS_ADDR is set, so order-service can
+	// invalidate its product cache
+	var rdb *redis.Client
+	productStreamKey := os.Getenv("PRODUCT_STREAM_KEY")
+	if productStreamKey == "" {
+		productStreamKey = "product-events"
+	}
+	if redisAddr := os.Getenv("REDIS_ADDR"); redisAddr != "" {
+		rdb = redis.NewClient(&redis.Options{Addr: redisAddr})
+		if err := rdb.Ping(context.Background()).Err(); err != nil {
+			log.Printf("Redis connection error: %v", err)
+		}
+	}
+
+	// Every stock change is recorded in the LEDGER_COLLECTION_NAME collection
+	ledgerCollection := os.Getenv("LEDGER_COLLECTION_NAME")
+	if ledgerCollection == "" {
+		ledgerCollection = "stock_movements"
+	}
+	reconcileInterval := time.Hour
+	if v := os.Getenv("RECONCILE_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval < time.Minute {
+			log.Fatal("RECONCILE_INTERVAL must be a duration of at least 1 minute")
+		}
+		reconcileInterval = interval
+	}
+
+	// Products without thresholds of their own run low at LOW_STOCK_THRESHOLD units and out of stock at
+	// OUT_OF_STOCK_THRESHOLD units, the checker alerts every LOW_STOCK_CHECK_INTERVAL
+	defaults := models.StockThresholds{LowStock: 5}
+	for name, threshold := range map[string]*int{"LOW_STOCK_THRESHOLD": &defaults.LowStock, "OUT_OF_STOCK_THRESHOLD": &defaults.OutOfStock} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				log.Fatalf("%s must be a non-negative number", name)
+			}
+			*threshold = n
+		}
+	}
+	if defaults.LowStock < defaults.OutOfStock {
+		log.Fatal("LOW_STOCK_THRESHOLD must not be below OUT_OF_STOCK_THRESHOLD")
+	}
+	lowStockInterval := time.Minute
+	if v := os.Getenv("LOW_STOCK_CHECK_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval < 10*time.Second {
+			log.Fatal("LOW_STOCK_CHECK_INTERVAL must be a duration of at least 10 seconds")
+		}
+		lowStockInterval = interval
+	}
+
+	// Stock is held at the warehouses of WAREHOUSES_FILE, at any warehouse when it is not set. Low-stock
+	// alerts are also posted to the LOW_STOCK_WEBHOOK_URLS, signed with LOW_STOCK_WEBHOOK_SECRET.
+	inventoryService := service.NewInventoryService(collectionName, rdb, productStreamKey).
+		WithWarehouses(warehouse.RegistryFromEnv()).
+		WithLedger(ledgerCollection).
+		WithThresholds(defaults).
+		WithWebhooks(webhook.SenderFromEnv("LOW_STOCK_WEBHOOK"))
+	// Internal callers authenticate with a key of SERVICE_KEYS_FILE, reloaded to pick up rotations, or with
+	// a client certificate on the gRPC API when SERVICE_TLS_CERT and SERVICE_TLS_CA are set
+	serviceKeys := auth.KeyRingFromEnv()
+	tlsConfig := mtls.ConfigFromEnv()
+	auth.RequireServiceAuth(serviceKeys, tlsConfig.Enabled())
+	keysCtx, stopKeys := context.WithCancel(context.Background())
+	defer stopKeys()
+	if serviceKeys != nil {
+		go serviceKeys.Watch(keysCtx, auth.KeyReloadInterval)
+	}
 
-	http.HandleFunc("/products", inventoryHandler.GetAllProductsHandler)
-	http.HandleFunc("/product", inventoryHandler.GetProductByIdHandler)
+	// The reconciliation job checks every RECONCILE_INTERVAL that the stock matches the ledger, the
+	// low-stock checker compares the stock with the thresholds
+	jobCtx, stopJob := context.WithCancel(context.Background())
+	defer stopJob()
+	go inventoryService.RunReconciliation(jobCtx, reconcileInterval)
+	go inventoryService.RunLowStockChecks(jobCtx, lowStockInterval)
 
-	server := &http.Server{Addr: ":8080"}
+	// Requests act for the tenant of the caller's token or X-Tenant-ID, TENANTS_FILE lists the known tenants
+	tenants := tenant.RegistryFromEnv()
+	inventoryHandler := handler.NewInventoryHandler(inventoryService, auth.VerifierFromEnv(), serviceKeys, tenants)
+
+	// Liveness only covers the process, readiness pings MongoDB and Redis when product events are published
+	probes := health.New(health.DefaultTimeout)
+	probes.AddReadiness("mongodb", mongodb.Ping)
+	if rdb != nil {
+		probes.AddReadiness("redis", func(ctx context.Context) error { return rdb.Ping(ctx).Err() })
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", probes.Live)
+	mux.HandleFunc("GET /readyz", probes.Ready)
+	mux.Handle("/", inventoryHandler.Routes())
+	server := &http.Server{Addr: ":8080", Handler: mux}
+
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":9090"
+	}
+	// The gRPC API is only used by order-service, every call must come from an authenticated service
+	grpcOpts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(
+		auth.ServiceUnaryInterceptor(serviceKeys, tlsConfig.Enabled()),
+		tenant.UnaryServerInterceptor(tenants),
+	)}
+	if tlsConfig.Enabled() {
+		serverTLS, err := mtls.ServerConfig(tlsConfig.CertPath, tlsConfig.CAPath)
+		if err != nil {
+			log.Fatalf("Failed to configure gRPC mTLS: %v", err)
+		}
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(serverTLS)))
+	}
+	grpcServer := grpc.NewServer(grpcOpts...)
+	inventoryv1.RegisterInventoryServiceServer(grpcServer, rpc.NewInventoryServer(inventoryService))
+
+	go func() {
+		lis, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			log.Fatalf("gRPC listen error: %v", err)
+		}
+		log.Printf("Inventory gRPC server running on %s", grpcAddr)
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatalf("gRPC server error: %v", err)
+		}
+	}()
 
 	go func() {
 		log.Println("Inventory service running on :8080")
@@ -46,15 +176,23 @@ func main() {
 	<-stop // Block until signal is received
 	log.Println("Shutdown signal received. Cleaning up...")
 
+	// Keep serving while the pod is taken out of the service endpoints
+	probes.Drain()
+	time.Sleep(health.DrainDelayFromEnv())
+
 	// Gracefully shutdown HTTP server
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
 		log.Printf("HTTP server shutdown error: %v", err)
 	}
+	grpcServer.GracefulStop()
 
 	// Disconnect MongoDB to release resources acquired for connection pooling
 	mongodb.DisconnectMongo()
+	if rdb != nil {
+		rdb.Close()
+	}
 
 	log.Println("Inventory service shutdown complete.")
 }
@@ -0,0 +1,145 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	inventoryv1 "github.com/dinesh-man/ecommerce-order-processing-system/pkg/pb/inventory/v1"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// InventoryServer serves the inventory gRPC API on top of the inventory service
+type InventoryServer struct {
+	inventoryv1.UnimplementedInventoryServiceServer
+	service *service.InventoryService
+}
+
+func NewInventoryServer(s *service.InventoryService) *InventoryServer {
+	return &InventoryServer{service: s}
+}
+
+// scoped returns the service acting for the tenant of the call, stock changes are recorded as made by the
+// caller
+func (s *InventoryServer) scoped(ctx context.Context) *service.InventoryService {
+	return s.service.ForTenant(tenant.FromContext(ctx)).ForActor(auth.Actor(ctx))
+}
+
+func (s *InventoryServer) GetProduct(ctx context.Context, req *inventoryv1.GetProductRequest) (*inventoryv1.GetProductResponse, error) {
+	product, err := s.scoped(ctx).GetProductByID(req.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &inventoryv1.GetProductResponse{Product: toProto(product)}, nil
+}
+
+func (s *InventoryServer) BatchGetProducts(ctx context.Context, req *inventoryv1.BatchGetProductsRequest) (*inventoryv1.BatchGetProductsResponse, error) {
+	products, err := s.scoped(ctx).GetProductsByIDs(req.GetIds())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &inventoryv1.BatchGetProductsResponse{}
+	found := make(map[string]bool, len(products))
+	for i := range products {
+		found[products[i].ID] = true
+		resp.Products = append(resp.Products, toProto(&products[i]))
+	}
+	for _, id := range req.GetIds() {
+		if !found[id] {
+			resp.MissingIds = append(resp.MissingIds, id)
+		}
+	}
+	return resp, nil
+}
+
+func (s *InventoryServer) ReserveStock(ctx context.Context, req *inventoryv1.ReserveStockRequest) (*inventoryv1.ReserveStockResponse, error) {
+	products, err := s.scoped(ctx).ReserveStock(stockLines(req.GetLines()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &inventoryv1.ReserveStockResponse{Products: toProtos(products)}, nil
+}
+
+func (s *InventoryServer) ReleaseStock(ctx context.Context, req *inventoryv1.ReleaseStockRequest) (*inventoryv1.ReleaseStockResponse, error) {
+	products, err := s.scoped(ctx).ReleaseStock(stockLines(req.GetLines()), req.GetReason())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	log.Printf("Released stock of %d products (%s)", len(products), req.GetReason())
+	return &inventoryv1.ReleaseStockResponse{Products: toProtos(products)}, nil
+}
+
+func (s *InventoryServer) CommitStock(ctx context.Context, req *inventoryv1.CommitStockRequest) (*inventoryv1.CommitStockResponse, error) {
+	if err := s.scoped(ctx).CommitStock(stockLines(req.GetLines())); err != nil {
+		return nil, toStatus(err)
+	}
+	return &inventoryv1.CommitStockResponse{}, nil
+}
+
+// toStatus maps service errors to gRPC status codes
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return status.Error(codes.NotFound, "product not found")
+	case errors.Is(err, service.ErrInsufficientStock):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrVersionConflict):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, service.ErrInvalidProductID), errors.Is(err, service.ErrInvalidQuantity), errors.Is(err, service.ErrUnknownWarehouse):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		log.Printf("Inventory RPC failed: %v", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func stockLines(lines []*inventoryv1.StockLine) []service.StockLine {
+	out := make([]service.StockLine, len(lines))
+	for i, line := range lines {
+		out[i] = service.StockLine{ProductID: line.GetProductId(), WarehouseID: line.GetWarehouseId(), Quantity: int(line.GetQuantity()), OrderID: line.GetOrderId()}
+	}
+	return out
+}
+
+func toProtos(products []models.Product) []*inventoryv1.Product {
+	out := make([]*inventoryv1.Product, len(products))
+	for i := range products {
+		out[i] = toProto(&products[i])
+	}
+	return out
+}
+
+func toProto(p *models.Product) *inventoryv1.Product {
+	warehouses := make([]*inventoryv1.WarehouseStock, len(p.Warehouses))
+	for i, held := range p.Warehouses {
+		warehouses[i] = &inventoryv1.WarehouseStock{WarehouseId: held.WarehouseID, Stock: int64(held.Stock)}
+	}
+	pb := &inventoryv1.Product{
+		Id:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		Currency:    p.Currency,
+		Stock:       int64(p.Stock),
+		Category:    p.Category,
+		Brand:       p.Brand,
+		Rating:      p.Rating,
+		Version:     p.Version,
+		Warehouses:  warehouses,
+	}
+	if p.Backorder != nil {
+		pb.Backorder = &inventoryv1.BackorderPolicy{Mode: string(p.Backorder.Mode)}
+		if p.Backorder.AvailableAt != nil {
+			pb.Backorder.AvailableAt = timestamppb.New(*p.Backorder.AvailableAt)
+		}
+	}
+	return pb
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidBackorderMode is returned for a backorder policy that is neither BACKORDER nor PRE_ORDER
+var ErrInvalidBackorderMode = errors.New("backorder mode must be BACKORDER or PRE_ORDER")
+
+// SetBackorder lets the product be ordered beyond its stock under policy, a nil policy stops it. When
+// ifMatch is set the product must still be at that version.
+func (s *InventoryService) SetBackorder(id string, policy *models.BackorderPolicy, ifMatch *int64) (*models.Product, error) {
+	if !strings.HasPrefix(id, "P") {
+		return nil, ErrInvalidProductID
+	}
+	update := bson.M{"$unset": bson.M{"backorder": ""}, "$inc": bson.M{"version": 1}}
+	if policy != nil {
+		if policy.Mode != models.Backorder && policy.Mode != models.PreOrder {
+			return nil, ErrInvalidBackorderMode
+		}
+		update = bson.M{"$set": bson.M{"backorder": policy}, "$inc": bson.M{"version": 1}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := s.filter(bson.M{"id": id})
+	if ifMatch != nil {
+		filter["version"] = mongodb.VersionFilter(*ifMatch)
+	}
+	var product models.Product
+	err := GetCollection(s.collectionName).FindOneAndUpdate(
+		ctx,
+		filter,
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&product)
+	if err != nil {
+		if ifMatch != nil && errors.Is(err, mongo.ErrNoDocuments) {
+			if _, findErr := s.GetProductByID(id); findErr == nil {
+				return nil, ErrVersionConflict
+			}
+		}
+		return nil, err
+	}
+
+	if policy != nil {
+		log.Printf("Product %s accepts orders beyond its stock as %s", id, policy.Mode)
+	} else {
+		log.Printf("Product %s no longer accepts orders beyond its stock", id)
+	}
+	s.publishProductUpdated(&product)
+	return &product, nil
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// EventProductUpdated is published to the product stream whenever a product document changes, consumers
+// such as the order-service product cache drop their copy when they see it. The event carries the stock
+// after the change, order-processor releases backorders when it went up.
+const EventProductUpdated = "product.updated"
+
+// EventLowStock is published to the product stream when a product runs low or out of stock
+const EventLowStock = "inventory.low_stock"
+
+// productStreamMaxLen caps the product stream, consumers only care about recent changes
+const productStreamMaxLen = 10000
+
+// publishProductUpdated announces a product change. Publishing is best effort: consumer caches also
+// expire on their own, so a failure is only logged.
+func (s *InventoryService) publishProductUpdated(product *models.Product) {
+	if s.rdb == nil {
+		return
+	}
+
+	args := &redis.XAddArgs{
+		Stream: s.streamKey,
+		MaxLen: productStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"event":      EventProductUpdated,
+			"product_id": product.ID,
+			"tenant_id":  s.tenant.ID,
+			"version":    product.Version,
+			"stock":      product.Stock,
+		},
+	}
+	if err := s.rdb.XAdd(context.Background(), args).Err(); err != nil {
+		log.Printf("failed to publish %s for product %s: %v", EventProductUpdated, product.ID, err)
+	}
+}
+
+// publishLowStock announces a product that ran low or out of stock, best effort like every product event
+func (s *InventoryService) publishLowStock(alert *models.LowStockAlert) {
+	if s.rdb == nil {
+		return
+	}
+
+	args := &redis.XAddArgs{
+		Stream: s.streamKey,
+		MaxLen: productStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"event":        EventLowStock,
+			"product_id":   alert.ProductID,
+			"tenant_id":    alert.TenantID,
+			"status":       string(alert.Status),
+			"stock":        alert.Stock,
+			"low_stock":    alert.Thresholds.LowStock,
+			"out_of_stock": alert.Thresholds.OutOfStock,
+		},
+	}
+	if err := s.rdb.XAdd(context.Background(), args).Err(); err != nil {
+		log.Printf("failed to publish %s for product %s: %v", EventLowStock, alert.ProductID, err)
+	}
+}
@@ -3,34 +3,82 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"strings"
 	"time"
 
 	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
 	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mongodb"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/warehouse"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/webhook"
 
+	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+var GetCollection = mongodb.GetCollection
+
+// ErrInvalidProductID is returned for ids that cannot belong to a product
+var ErrInvalidProductID = errors.New("invalid product ID")
+
+// ErrVersionConflict is returned when the product was modified since the version the caller based its change on
+var ErrVersionConflict = errors.New("product was modified concurrently, reload it and retry")
+
+// ErrUnknownWarehouse is returned for stock changes at a warehouse missing from the registry
+var ErrUnknownWarehouse = errors.New("unknown warehouse")
+
 type InventoryService struct {
 	collectionName string
+	rdb            *redis.Client
+	streamKey      string
+	tenant         tenant.Tenant
+	warehouses     *warehouse.Registry
+	// ledgerCollection holds the stock movements, actor is recorded as their author
+	ledgerCollection string
+	actor            string
+	// thresholds apply to products without their own, low-stock alerts also go to webhooks
+	thresholds models.StockThresholds
+	webhooks   *webhook.Sender
+}
+
+// NewInventoryService returns the service of the default tenant, product changes are published to the
+// streamKey stream unless rc is nil
+func NewInventoryService(collectionName string, rc *redis.Client, sk string) *InventoryService {
+	return &InventoryService{collectionName: collectionName, rdb: rc, streamKey: sk, tenant: tenant.Tenant{ID: tenant.Default}}
+}
+
+// ForTenant returns the service acting for t, every query is restricted to the tenant's products
+func (s *InventoryService) ForTenant(t tenant.Tenant) *InventoryService {
+	scoped := *s
+	scoped.tenant = t
+	return &scoped
+}
+
+// WithWarehouses returns the service holding stock at the warehouses of reg, any warehouse when it is nil
+func (s *InventoryService) WithWarehouses(reg *warehouse.Registry) *InventoryService {
+	scoped := *s
+	scoped.warehouses = reg
+	return &scoped
 }
 
-func NewInventoryService(collectionName string) *InventoryService {
-	return &InventoryService{collectionName: collectionName}
+// filter scopes a query to the tenant of the service
+func (s *InventoryService) filter(filter bson.M) bson.M {
+	return tenant.Filter(s.tenant.ID, filter)
 }
 
 // GetAllProducts returns all available products
 func (s *InventoryService) GetAllProducts() ([]models.Product, error) {
-	collection := mongodb.GetCollection(s.collectionName)
+	collection := GetCollection(s.collectionName)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cursor, err := collection.Find(ctx, bson.M{})
+	cursor, err := collection.Find(ctx, s.filter(bson.M{}))
 	if err != nil {
 		return nil, err
 	}
@@ -53,16 +101,97 @@ func (s *InventoryService) GetAllProducts() ([]models.Product, error) {
 func (s *InventoryService) GetProductByID(id string) (*models.Product, error) {
 
 	if !strings.HasPrefix(id, "P") {
-		return nil, errors.New("invalid product ID")
+		return nil, ErrInvalidProductID
+	}
+
+	collection := GetCollection(s.collectionName)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var product models.Product
+	err := collection.FindOne(ctx, s.filter(bson.M{"id": id})).Decode(&product)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// RestockProduct adds returned or replenished units back to the product stock. When ifMatch is set the
+// product must still be at that version.
+func (s *InventoryService) RestockProduct(id string, quantity int, ifMatch *int64) (*models.Product, error) {
+	return s.RestockWarehouse(StockLine{ProductID: id, Quantity: quantity}, "", ifMatch)
+}
+
+// RestockWarehouse adds the units of the line to the stock its warehouse holds of the product, the product
+// total included. Without a warehouse the units are added to the unassigned stock.
+func (s *InventoryService) RestockWarehouse(line StockLine, reason string, ifMatch *int64) (*models.Product, error) {
+
+	if !strings.HasPrefix(line.ProductID, "P") {
+		return nil, ErrInvalidProductID
+	}
+	if line.Quantity <= 0 {
+		return nil, errors.New("restock quantity must be positive")
+	}
+	if line.WarehouseID != "" && !s.warehouses.Known(line.WarehouseID) {
+		return nil, fmt.Errorf("%w %s", ErrUnknownWarehouse, line.WarehouseID)
 	}
 
-	collection := mongodb.GetCollection(s.collectionName)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	product, err := s.addStock(ctx, line.ProductID, line.WarehouseID, line.Quantity, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Restocked %d units of product %s, stock is now %d", line.Quantity, line.ProductID, product.Stock)
+	s.record(ctx, product, models.StockMovement{Type: models.MovementRestock, WarehouseID: line.WarehouseID, Quantity: line.Quantity, Reason: reason, OrderID: line.OrderID})
+	s.publishProductUpdated(product)
+	return product, nil
+}
+
+// addStock adds units to the product and the warehouse holding them
+func (s *InventoryService) addStock(ctx context.Context, id string, warehouseID string, quantity int, ifMatch *int64) (*models.Product, error) {
+	collection := GetCollection(s.collectionName)
+
+	filter := s.filter(bson.M{"id": id})
+	if ifMatch != nil {
+		filter["version"] = mongodb.VersionFilter(*ifMatch)
+	}
+	inc := bson.M{"stock": quantity, "version": 1}
+	update := bson.M{"$inc": inc}
+	if warehouseID != "" {
+		filter["warehouses.warehouse_id"] = warehouseID
+		inc["warehouses.$.stock"] = quantity
+	}
+
 	var product models.Product
-	err := collection.FindOne(ctx, bson.M{"id": id}).Decode(&product)
+	err := collection.FindOneAndUpdate(
+		ctx,
+		filter,
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&product)
+
+	// The first units at a warehouse add it to the product
+	if warehouseID != "" && errors.Is(err, mongo.ErrNoDocuments) {
+		filter["warehouses.warehouse_id"] = bson.M{"$ne": warehouseID}
+		err = collection.FindOneAndUpdate(
+			ctx,
+			filter,
+			bson.M{
+				"$inc":  bson.M{"stock": quantity, "version": 1},
+				"$push": bson.M{"warehouses": models.WarehouseStock{WarehouseID: warehouseID, Stock: quantity}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&product)
+	}
 	if err != nil {
+		if ifMatch != nil && errors.Is(err, mongo.ErrNoDocuments) {
+			if _, findErr := s.GetProductByID(id); findErr == nil {
+				return nil, ErrVersionConflict
+			}
+		}
 		return nil, err
 	}
 	return &product, nil
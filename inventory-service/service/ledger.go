@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrReasonRequired is returned for manual stock adjustments that do not say why the stock changed
+var ErrReasonRequired = errors.New("a reason is required for stock adjustments")
+
+// MaxMovements caps the number of ledger entries returned by a single query
+const MaxMovements = 500
+
+// WithLedger returns the service recording every stock change in the ledger collection, no changes are
+// recorded when it is empty
+func (s *InventoryService) WithLedger(collectionName string) *InventoryService {
+	scoped := *s
+	scoped.ledgerCollection = collectionName
+	return &scoped
+}
+
+// ForActor returns the service recording actor as the author of its stock changes
+func (s *InventoryService) ForActor(actor string) *InventoryService {
+	scoped := *s
+	scoped.actor = actor
+	return &scoped
+}
+
+// record appends a movement of the product to the ledger. The stock change has already been applied, so a
+// failure is only logged and the reconciliation job reports the product until the ledger is corrected.
+func (s *InventoryService) record(ctx context.Context, product *models.Product, movement models.StockMovement) {
+	if s.ledgerCollection == "" {
+		return
+	}
+
+	movement.TenantID = s.tenant.ID
+	movement.ProductID = product.ID
+	movement.StockAfter = product.Stock
+	movement.Actor = s.actor
+	movement.OccurredAt = time.Now()
+	if _, err := GetCollection(s.ledgerCollection).InsertOne(ctx, movement); err != nil {
+		log.Printf("Failed to record %s of %d units of product %s in the ledger: %v", movement.Type, movement.Quantity, product.ID, err)
+	}
+}
+
+// GetMovements returns the ledger entries of the product in the order they happened, restricted to
+// [from, to) when they are set and to at most limit entries
+func (s *InventoryService) GetMovements(id string, from, to time.Time, limit int) ([]models.StockMovement, error) {
+	if !strings.HasPrefix(id, "P") {
+		return nil, ErrInvalidProductID
+	}
+	if limit <= 0 || limit > MaxMovements {
+		limit = MaxMovements
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := s.filter(bson.M{"product_id": id})
+	occurred := bson.M{}
+	if !from.IsZero() {
+		occurred["$gte"] = from
+	}
+	if !to.IsZero() {
+		occurred["$lt"] = to
+	}
+	if len(occurred) > 0 {
+		filter["occurred_at"] = occurred
+	}
+
+	cursor, err := GetCollection(s.ledgerCollection).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "occurred_at", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	movements := []models.StockMovement{}
+	if err := cursor.All(ctx, &movements); err != nil {
+		return nil, err
+	}
+	return movements, nil
+}
+
+// AdjustStock corrects the stock of the product at a warehouse by a signed quantity, e.g. after a stock
+// take. The stock never drops below zero. When ifMatch is set the product must still be at that version.
+func (s *InventoryService) AdjustStock(id string, warehouseID string, quantity int, reason string, ifMatch *int64) (*models.Product, error) {
+	if !strings.HasPrefix(id, "P") {
+		return nil, ErrInvalidProductID
+	}
+	if quantity == 0 {
+		return nil, errors.New("adjustment quantity must not be zero")
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrReasonRequired
+	}
+	if warehouseID != "" && !s.warehouses.Known(warehouseID) {
+		return nil, fmt.Errorf("%w %s", ErrUnknownWarehouse, warehouseID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var product *models.Product
+	var err error
+	if quantity > 0 {
+		product, err = s.addStock(ctx, id, warehouseID, quantity, ifMatch)
+	} else {
+		line := StockLine{ProductID: id, WarehouseID: warehouseID, Quantity: -quantity}
+		product, err = s.takeStock(ctx, line, ifMatch)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			current, findErr := s.GetProductByID(id)
+			if findErr != nil {
+				return nil, findErr
+			}
+			if ifMatch != nil && current.Version != *ifMatch {
+				return nil, ErrVersionConflict
+			}
+			return nil, insufficientStock(line)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Adjusted stock of product %s by %d (%s), stock is now %d", id, quantity, reason, product.Stock)
+	s.record(ctx, product, models.StockMovement{Type: models.MovementAdjustment, WarehouseID: warehouseID, Quantity: quantity, Reason: reason})
+	s.publishProductUpdated(product)
+	return product, nil
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mongodb"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/webhook"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidThresholds is returned for thresholds that are negative or where low stock is below out of stock
+var ErrInvalidThresholds = errors.New("thresholds must not be negative and low_stock must not be below out_of_stock")
+
+// severity orders the stock statuses, alerts are sent when a product gets to a more severe one
+var severity = map[models.StockStatus]int{models.InStock: 0, models.LowStock: 1, models.OutOfStock: 2}
+
+// WithThresholds returns the service applying defaults to products without thresholds of their own
+func (s *InventoryService) WithThresholds(defaults models.StockThresholds) *InventoryService {
+	scoped := *s
+	scoped.thresholds = defaults
+	return &scoped
+}
+
+// WithWebhooks returns the service sending low-stock alerts to the subscribers of sender as well
+func (s *InventoryService) WithWebhooks(sender *webhook.Sender) *InventoryService {
+	scoped := *s
+	scoped.webhooks = sender
+	return &scoped
+}
+
+// thresholdsOf returns the thresholds that apply to the product
+func (s *InventoryService) thresholdsOf(product *models.Product) models.StockThresholds {
+	if product.Thresholds != nil {
+		return *product.Thresholds
+	}
+	return s.thresholds
+}
+
+// lowStockExpr matches products at or below the low-stock threshold that applies to them
+func (s *InventoryService) lowStockExpr() bson.M {
+	return bson.M{"$lte": bson.A{"$stock", bson.M{"$ifNull": bson.A{"$thresholds.low_stock", s.thresholds.LowStock}}}}
+}
+
+// SetThresholds sets the reorder points of the product. When ifMatch is set the product must still be at
+// that version.
+func (s *InventoryService) SetThresholds(id string, thresholds models.StockThresholds, ifMatch *int64) (*models.Product, error) {
+	if !strings.HasPrefix(id, "P") {
+		return nil, ErrInvalidProductID
+	}
+	if thresholds.OutOfStock < 0 || thresholds.LowStock < thresholds.OutOfStock {
+		return nil, ErrInvalidThresholds
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := s.filter(bson.M{"id": id})
+	if ifMatch != nil {
+		filter["version"] = mongodb.VersionFilter(*ifMatch)
+	}
+	var product models.Product
+	err := GetCollection(s.collectionName).FindOneAndUpdate(
+		ctx,
+		filter,
+		bson.M{"$set": bson.M{"thresholds": thresholds}, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&product)
+	if err != nil {
+		if ifMatch != nil && errors.Is(err, mongo.ErrNoDocuments) {
+			if _, findErr := s.GetProductByID(id); findErr == nil {
+				return nil, ErrVersionConflict
+			}
+		}
+		return nil, err
+	}
+
+	log.Printf("Thresholds of product %s set to %d low and %d out of stock", id, thresholds.LowStock, thresholds.OutOfStock)
+	s.publishProductUpdated(&product)
+	return &product, nil
+}
+
+// GetLowStock reports the products at or below their low-stock threshold, the emptiest first
+func (s *InventoryService) GetLowStock() ([]models.LowStockItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := GetCollection(s.collectionName).Find(ctx, s.filter(bson.M{"$expr": s.lowStockExpr()}),
+		options.Find().SetSort(bson.D{{Key: "stock", Value: 1}, {Key: "id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	report := make([]models.LowStockItem, 0, len(products))
+	for i := range products {
+		thresholds := s.thresholdsOf(&products[i])
+		report = append(report, models.LowStockItem{
+			ProductID:  products[i].ID,
+			Name:       products[i].Name,
+			Stock:      products[i].Stock,
+			Status:     thresholds.Status(products[i].Stock),
+			Thresholds: thresholds,
+		})
+	}
+	return report, nil
+}
+
+// RunLowStockChecks checks the stock of every tenant against the thresholds every interval until ctx is done
+func (s *InventoryService) RunLowStockChecks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.CheckStockLevels(ctx); err != nil {
+			log.Printf("Low-stock check failed: %v", err)
+		}
+	}
+}
+
+// CheckStockLevels records the stock status of the products of every tenant and alerts about those that
+// ran low or out of stock since the last check, returning the alerts sent. Every crossing is alerted once:
+// the status is updated conditionally, so only one replica alerts, and a product has to get back above
+// its threshold before it is alerted again.
+func (s *InventoryService) CheckStockLevels(ctx context.Context) ([]models.LowStockAlert, error) {
+	collection := GetCollection(s.collectionName)
+
+	// Only products that are low now or were low at the last check can change status
+	cursor, err := collection.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"$expr": s.lowStockExpr()},
+		bson.M{"stock_status": bson.M{"$in": bson.A{models.LowStock, models.OutOfStock}}},
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching products: %w", err)
+	}
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, fmt.Errorf("error decoding products: %w", err)
+	}
+
+	var alerts []models.LowStockAlert
+	for i := range products {
+		product := &products[i]
+		previous := product.StockStatus
+		if previous == "" {
+			previous = models.InStock
+		}
+		thresholds := s.thresholdsOf(product)
+		status := thresholds.Status(product.Stock)
+		if status == previous {
+			continue
+		}
+
+		tenantID := product.TenantID
+		if tenantID == "" {
+			tenantID = tenant.Default
+		}
+		filter := tenant.Filter(tenantID, bson.M{"id": product.ID, "stock_status": previous})
+		if previous == models.InStock {
+			filter["stock_status"] = bson.M{"$in": bson.A{nil, models.InStock}}
+		}
+		result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"stock_status": status}})
+		if err != nil {
+			log.Printf("Failed to record the stock status of product %s: %v", product.ID, err)
+			continue
+		}
+		if result.ModifiedCount == 0 || severity[status] < severity[previous] {
+			continue
+		}
+
+		alert := models.LowStockAlert{
+			Event:      EventLowStock,
+			TenantID:   tenantID,
+			ProductID:  product.ID,
+			Name:       product.Name,
+			Stock:      product.Stock,
+			Status:     status,
+			Thresholds: thresholds,
+			OccurredAt: time.Now(),
+		}
+		log.Printf("Product %s of tenant %s is %s with %d units", product.ID, tenantID, status, product.Stock)
+		s.publishLowStock(&alert)
+		if err := s.webhooks.Send(ctx, EventLowStock, alert); err != nil {
+			log.Printf("Failed to deliver %s for product %s: %v", EventLowStock, product.ID, err)
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// reconciliationActor is recorded as the author of the opening balances written by the reconciliation job
+const reconciliationActor = "job:reconciliation"
+
+// ledgerTotal is the ledger sum of a product, Opened tells whether its opening balance was recorded
+type ledgerTotal struct {
+	Key struct {
+		TenantID  string `bson:"tenant_id"`
+		ProductID string `bson:"product_id"`
+	} `bson:"_id"`
+	Sum    int `bson:"sum"`
+	Opened int `bson:"opened"`
+}
+
+// RunReconciliation reconciles the stock of every tenant with the ledger every interval until ctx is done
+func (s *InventoryService) RunReconciliation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		discrepancies, err := s.Reconcile(ctx)
+		if err != nil {
+			log.Printf("Stock reconciliation failed: %v", err)
+			continue
+		}
+		log.Printf("Stock reconciliation completed, %d discrepancies", len(discrepancies))
+	}
+}
+
+// Reconcile verifies for the products of every tenant that the stock equals the sum of their ledger
+// movements. Products whose stock predates the ledger first get an opening balance: the stock before their
+// first movement, or their current stock when they never moved. A mismatch is checked a second time before
+// it is reported, to skip stock changes whose movement was not recorded yet.
+func (s *InventoryService) Reconcile(ctx context.Context) ([]models.StockDiscrepancy, error) {
+	if s.ledgerCollection == "" {
+		return nil, errors.New("no stock ledger configured")
+	}
+
+	// Products are read before the ledger, so movements recorded in between are part of the sums
+	cursor, err := GetCollection(s.collectionName).Find(ctx, bson.M{},
+		options.Find().SetProjection(bson.M{"id": 1, "tenant_id": 1, "stock": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching products: %w", err)
+	}
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, fmt.Errorf("error decoding products: %w", err)
+	}
+
+	totals, err := s.ledgerTotals(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	byProduct := make(map[[2]string]ledgerTotal, len(totals))
+	for _, total := range totals {
+		byProduct[[2]string{total.Key.TenantID, total.Key.ProductID}] = total
+	}
+
+	var discrepancies []models.StockDiscrepancy
+	for i := range products {
+		product := &products[i]
+		if product.TenantID == "" {
+			product.TenantID = tenant.Default
+		}
+
+		total := byProduct[[2]string{product.TenantID, product.ID}]
+		if total.Opened == 0 {
+			opening, err := s.recordOpening(ctx, product)
+			if err != nil {
+				log.Printf("Failed to record the opening balance of product %s: %v", product.ID, err)
+				continue
+			}
+			total.Sum += opening
+		}
+		if total.Sum == product.Stock {
+			continue
+		}
+
+		discrepancy, err := s.recheck(ctx, product)
+		if err != nil {
+			log.Printf("Failed to reconcile product %s: %v", product.ID, err)
+			continue
+		}
+		if discrepancy != nil {
+			log.Printf("Stock of product %s of tenant %s is %d but its ledger adds up to %d", product.ID, product.TenantID, discrepancy.Stock, discrepancy.Ledger)
+			discrepancies = append(discrepancies, *discrepancy)
+		}
+	}
+	return discrepancies, nil
+}
+
+// ledgerTotals sums the movements matching filter per product. Commits leave the stock alone and are not
+// part of the sum.
+func (s *InventoryService) ledgerTotals(ctx context.Context, filter bson.M) ([]ledgerTotal, error) {
+	cursor, err := GetCollection(s.ledgerCollection).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    bson.M{"tenant_id": "$tenant_id", "product_id": "$product_id"},
+			"sum":    bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$type", models.MovementCommit}}, 0, "$quantity"}}},
+			"opened": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$type", models.MovementOpening}}, 1, 0}}},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error summing the ledger: %w", err)
+	}
+	var totals []ledgerTotal
+	if err := cursor.All(ctx, &totals); err != nil {
+		return nil, fmt.Errorf("error decoding ledger sums: %w", err)
+	}
+	return totals, nil
+}
+
+// recordOpening records the stock the product held before its first ledger movement and returns it
+func (s *InventoryService) recordOpening(ctx context.Context, product *models.Product) (int, error) {
+	ledger := GetCollection(s.ledgerCollection)
+
+	opening := models.StockMovement{
+		TenantID:   product.TenantID,
+		ProductID:  product.ID,
+		Type:       models.MovementOpening,
+		Quantity:   product.Stock,
+		Reason:     "stock before the ledger",
+		Actor:      reconciliationActor,
+		OccurredAt: time.Now(),
+	}
+	var first models.StockMovement
+	err := ledger.FindOne(ctx, bson.M{"tenant_id": product.TenantID, "product_id": product.ID},
+		options.FindOne().SetSort(bson.D{{Key: "occurred_at", Value: 1}, {Key: "_id", Value: 1}})).Decode(&first)
+	switch {
+	case err == nil:
+		opening.Quantity = first.StockAfter
+		if first.Type != models.MovementCommit {
+			opening.Quantity -= first.Quantity
+		}
+		opening.OccurredAt = first.OccurredAt
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return 0, err
+	}
+	opening.StockAfter = opening.Quantity
+
+	if _, err := ledger.InsertOne(ctx, opening); err != nil {
+		return 0, err
+	}
+	log.Printf("Recorded an opening balance of %d units for product %s of tenant %s", opening.Quantity, product.ID, product.TenantID)
+	return opening.Quantity, nil
+}
+
+// recheck reads the stock and the ledger sum of the product again, nil when they match by now
+func (s *InventoryService) recheck(ctx context.Context, product *models.Product) (*models.StockDiscrepancy, error) {
+	var current models.Product
+	err := GetCollection(s.collectionName).FindOne(ctx, tenant.Filter(product.TenantID, bson.M{"id": product.ID})).Decode(&current)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := s.ledgerTotals(ctx, bson.M{"tenant_id": product.TenantID, "product_id": product.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	discrepancy := &models.StockDiscrepancy{TenantID: product.TenantID, ProductID: product.ID, Stock: current.Stock}
+	if len(totals) > 0 {
+		discrepancy.Ledger = totals[0].Sum
+	}
+	if discrepancy.Ledger == discrepancy.Stock {
+		return nil, nil
+	}
+	return discrepancy, nil
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInsufficientStock is returned when a reservation asks for more units than are in stock
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// ErrInvalidQuantity is returned for stock lines without a positive quantity
+var ErrInvalidQuantity = errors.New("quantity must be positive")
+
+// StockLine is a quantity of a single product to reserve or release, at a warehouse when WarehouseID is set.
+// OrderID references the order the stock is moved for in the ledger.
+type StockLine struct {
+	ProductID   string
+	WarehouseID string
+	Quantity    int
+	OrderID     string
+}
+
+// GetProductsByIDs returns the products of the given ids that exist
+func (s *InventoryService) GetProductsByIDs(ids []string) ([]models.Product, error) {
+	collection := GetCollection(s.collectionName)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, s.filter(bson.M{"id": bson.M{"$in": ids}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// ReserveStock takes the quantities out of stock, all or nothing. Lines reserved before a failing line
+// are released again.
+func (s *InventoryService) ReserveStock(lines []StockLine) ([]models.Product, error) {
+	if err := s.validateLines(lines); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	products := make([]models.Product, 0, len(lines))
+	for i, line := range lines {
+		product, err := s.takeStock(ctx, line, nil)
+		if err == nil {
+			products = append(products, *product)
+			s.record(ctx, product, models.StockMovement{Type: models.MovementReservation, WarehouseID: line.WarehouseID, Quantity: -line.Quantity, OrderID: line.OrderID})
+			s.publishProductUpdated(product)
+			continue
+		}
+
+		// The rollback gives back exactly what this call took, the ledger entries may not have been written
+		if _, rollbackErr := s.releaseStock(lines[:i], "reservation rolled back", false); rollbackErr != nil {
+			log.Printf("Failed to release stock after a failed reservation: %v", rollbackErr)
+		}
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			if _, findErr := s.GetProductByID(line.ProductID); findErr != nil {
+				return nil, findErr
+			}
+			return nil, insufficientStock(line)
+		}
+		return nil, err
+	}
+
+	log.Printf("Reserved stock for %d products", len(lines))
+	return products, nil
+}
+
+// takeStock takes units out of the product and the warehouse holding them, as long as both have enough.
+// When ifMatch is set the product must still be at that version.
+func (s *InventoryService) takeStock(ctx context.Context, line StockLine, ifMatch *int64) (*models.Product, error) {
+	collection := GetCollection(s.collectionName)
+
+	filter := s.filter(bson.M{"id": line.ProductID, "stock": bson.M{"$gte": line.Quantity}})
+	if ifMatch != nil {
+		filter["version"] = mongodb.VersionFilter(*ifMatch)
+	}
+	inc := bson.M{"stock": -line.Quantity, "version": 1}
+	if line.WarehouseID != "" {
+		filter["warehouses"] = bson.M{"$elemMatch": bson.M{"warehouse_id": line.WarehouseID, "stock": bson.M{"$gte": line.Quantity}}}
+		inc["warehouses.$.stock"] = -line.Quantity
+	}
+
+	var product models.Product
+	err := collection.FindOneAndUpdate(
+		ctx,
+		filter,
+		bson.M{"$inc": inc},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&product)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func insufficientStock(line StockLine) error {
+	if line.WarehouseID != "" {
+		return fmt.Errorf("%w for product %s at warehouse %s", ErrInsufficientStock, line.ProductID, line.WarehouseID)
+	}
+	return fmt.Errorf("%w for product %s", ErrInsufficientStock, line.ProductID)
+}
+
+// ReleaseStock puts reserved or returned units back into stock. A line made for an order never puts back more
+// than the order took out and did not get back yet, so releasing the stock of an order again is harmless.
+func (s *InventoryService) ReleaseStock(lines []StockLine, reason string) ([]models.Product, error) {
+	return s.releaseStock(lines, reason, true)
+}
+
+// releaseStock puts the lines back into stock, capped at the units their order holds when capped is set
+func (s *InventoryService) releaseStock(lines []StockLine, reason string, capped bool) ([]models.Product, error) {
+	if err := s.validateLines(lines); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	products := make([]models.Product, 0, len(lines))
+	for _, line := range lines {
+		if capped && line.OrderID != "" && s.ledgerCollection != "" {
+			held, err := s.heldBy(ctx, line)
+			if err != nil {
+				return products, err
+			}
+			if held <= 0 {
+				log.Printf("Order %s holds no units of product %s to release", line.OrderID, line.ProductID)
+				continue
+			}
+			line.Quantity = min(line.Quantity, held)
+		}
+
+		product, err := s.addStock(ctx, line.ProductID, line.WarehouseID, line.Quantity, nil)
+		if err != nil {
+			return products, err
+		}
+		products = append(products, *product)
+		s.record(ctx, product, models.StockMovement{Type: models.MovementRelease, WarehouseID: line.WarehouseID, Quantity: line.Quantity, Reason: reason, OrderID: line.OrderID})
+		s.publishProductUpdated(product)
+	}
+	return products, nil
+}
+
+// heldBy returns the units of the line's product and warehouse the ledger shows reserved for its order and not
+// released since
+func (s *InventoryService) heldBy(ctx context.Context, line StockLine) (int, error) {
+	filter := s.filter(bson.M{
+		"order_id":   line.OrderID,
+		"product_id": line.ProductID,
+		"type":       bson.M{"$in": bson.A{models.MovementReservation, models.MovementRelease}},
+	})
+	if line.WarehouseID != "" {
+		filter["warehouse_id"] = line.WarehouseID
+	} else {
+		filter["warehouse_id"] = bson.M{"$in": bson.A{"", nil}}
+	}
+
+	cursor, err := GetCollection(s.ledgerCollection).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "sum": bson.M{"$sum": "$quantity"}}}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error summing the reservations of order %s: %w", line.OrderID, err)
+	}
+	var totals []struct {
+		Sum int `bson:"sum"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return 0, fmt.Errorf("error decoding the reservations of order %s: %w", line.OrderID, err)
+	}
+	if len(totals) == 0 {
+		return 0, nil
+	}
+	// Reservations are negative movements, releases positive ones
+	return -totals[0].Sum, nil
+}
+
+// CommitStock records that reserved units left for good, e.g. because the order shipped. The reservation
+// already took them out of stock, so only the ledger changes.
+func (s *InventoryService) CommitStock(lines []StockLine) error {
+	if err := s.validateLines(lines); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, line := range lines {
+		product, err := s.GetProductByID(line.ProductID)
+		if err != nil {
+			return err
+		}
+		s.record(ctx, product, models.StockMovement{Type: models.MovementCommit, WarehouseID: line.WarehouseID, Quantity: -line.Quantity, OrderID: line.OrderID})
+	}
+	return nil
+}
+
+func (s *InventoryService) validateLines(lines []StockLine) error {
+	for _, line := range lines {
+		if !strings.HasPrefix(line.ProductID, "P") {
+			return ErrInvalidProductID
+		}
+		if line.Quantity <= 0 {
+			return fmt.Errorf("%w for product %s", ErrInvalidQuantity, line.ProductID)
+		}
+		if line.WarehouseID != "" && !s.warehouses.Known(line.WarehouseID) {
+			return fmt.Errorf("%w %s", ErrUnknownWarehouse, line.WarehouseID)
+		}
+	}
+	return nil
+}
+
+// GetAvailability returns the stock of the product broken down by the warehouses holding it
+func (s *InventoryService) GetAvailability(id string) (*models.Availability, error) {
+	product, err := s.GetProductByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	availability := &models.Availability{ProductID: product.ID, Stock: product.Stock, Unassigned: product.Stock, Warehouses: []models.WarehouseAvailability{}}
+	for _, held := range product.Warehouses {
+		w, _ := s.warehouses.Lookup(held.WarehouseID)
+		availability.Warehouses = append(availability.Warehouses, models.WarehouseAvailability{Warehouse: w, Stock: held.Stock})
+		availability.Unassigned -= held.Stock
+	}
+	return availability, nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -11,9 +12,18 @@ import (
 	"time"
 
 	"github.com/dinesh-man/ecommerce-order-processing-system/order-processor/processor"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/health"
 	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mongodb"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mtls"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
 	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/redis-stream"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/warehouse"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/webhook"
 	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
@@ -44,16 +54,101 @@ func main() {
 		log.Fatal("JOB_RUN_INTERVAL_MINUTES must be at least 1 minute")
 	}
 
+	// Fulfilment groups of authorized orders are handed to the warehouses on this stream
+	fulfilmentStreamKey := os.Getenv("FULFILMENT_STREAM_KEY")
+	if fulfilmentStreamKey == "" {
+		fulfilmentStreamKey = "fulfilments"
+	}
+
+	// Backordered orders are released as inventory-service announces restocks on the product stream, their
+	// customers are notified on the notification stream
+	productStreamKey := os.Getenv("PRODUCT_STREAM_KEY")
+	if productStreamKey == "" {
+		productStreamKey = "product-events"
+	}
+	notificationStreamKey := os.Getenv("NOTIFICATION_STREAM_KEY")
+	if notificationStreamKey == "" {
+		notificationStreamKey = "notifications"
+	}
+
+	// Stock of cancelled and released orders is moved through the inventory-service gRPC API. Calls carry
+	// SERVICE_API_KEY, the channel also uses mTLS when SERVICE_TLS_CERT and SERVICE_TLS_CA are set
+	inventoryGRPCAddr := os.Getenv("INVENTORY_GRPC_ADDR")
+	if inventoryGRPCAddr == "" {
+		log.Fatal("Inventory-service gRPC address not specified")
+	}
+	transportCreds := insecure.NewCredentials()
+	tlsConfig := mtls.ConfigFromEnv()
+	if tlsConfig.Enabled() {
+		clientTLS, err := mtls.ClientConfig(tlsConfig.CertPath, tlsConfig.CAPath)
+		if err != nil {
+			log.Fatalf("Failed to configure inventory gRPC mTLS: %v", err)
+		}
+		transportCreds = credentials.NewTLS(clientTLS)
+	}
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(transportCreds)}
+	if serviceKey := os.Getenv("SERVICE_API_KEY"); serviceKey != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(auth.ServiceKeyCredentials{Key: serviceKey, TLS: tlsConfig.Enabled()}))
+	}
+	inventoryConn, err := grpc.NewClient(inventoryGRPCAddr, dialOpts...)
+	if err != nil {
+		log.Fatalf("Failed to create inventory gRPC client: %v", err)
+	}
+	stock := processor.NewGRPCStock(inventoryConn)
+
 	mongodb.InitMongoDB()
 
 	rdb, sk := redis_stream.InitRedis()
 
 	// Start background job
-	go processor.RunJob(rdb, sk, consumerGroup, uuid.NewString(), collectionName, duration)
+	jobCtx, stopJob := context.WithCancel(context.Background())
+	jobDone := make(chan struct{})
+	started := time.Now()
+	consumerID := uuid.NewString()
+	go func() {
+		defer close(jobDone)
+		processor.RunJob(jobCtx, rdb, sk, fulfilmentStreamKey, consumerGroup, consumerID, collectionName, duration, payment.NewFakeGatewayFromEnv(), stock)
+	}()
 
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("OK")) })
+	// Released backorder lines are allocated like order-service allocates new lines, so the processor reads the
+	// same WAREHOUSES_FILE and ALLOCATION_RULE
+	backorders := processor.NewBackorders(rdb, productStreamKey, consumerGroup, consumerID, sk, notificationStreamKey, collectionName, webhook.SenderFromEnv("CUSTOMER_WEBHOOK"), stock).
+		WithAllocator(warehouse.AllocatorFromEnv())
+	backordersDone := make(chan struct{})
+	go func() {
+		defer close(backordersDone)
+		backorders.Watch(jobCtx)
+	}()
 
-	server := &http.Server{Addr: ":8080"}
+	// The processor is ready while MongoDB and Redis answer and batches keep succeeding. A job that has not
+	// completed a batch for three intervals is reported unready.
+	probes := health.New(health.DefaultTimeout)
+	probes.AddReadiness("mongodb", mongodb.Ping)
+	probes.AddReadiness("redis", func(ctx context.Context) error { return rdb.Ping(ctx).Err() })
+	probes.AddReadiness("batch", func(ctx context.Context) error {
+		last := processor.LastSuccessfulBatch()
+		if last.IsZero() {
+			last = started
+		}
+		if since := time.Since(last); since > 3*duration {
+			return fmt.Errorf("no successful batch for %s", since.Round(time.Second))
+		}
+		return nil
+	})
+	probes.AddInfo("last_successful_batch", func() interface{} {
+		last := processor.LastSuccessfulBatch()
+		if last.IsZero() {
+			return nil
+		}
+		return map[string]interface{}{"at": last, "seconds_ago": int64(time.Since(last).Seconds())}
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", probes.Live)
+	mux.HandleFunc("GET /readyz", probes.Ready)
+	mux.HandleFunc("GET /health", probes.Live)
+
+	server := &http.Server{Addr: ":8080", Handler: mux}
 
 	go func() {
 		log.Println("Order processor running on :8080")
@@ -69,6 +164,12 @@ func main() {
 	<-stop // Block until signal is received
 	log.Println("Shutdown signal received. Cleaning up...")
 
+	// Report not ready while the batch in progress is drained
+	probes.Drain()
+	stopJob()
+	<-jobDone
+	<-backordersDone
+
 	// Gracefully shutdown HTTP server
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -80,6 +181,7 @@ func main() {
 	mongodb.DisconnectMongo()
 	// Close Redis connection
 	redis_stream.CloseRedis()
+	inventoryConn.Close()
 
 	log.Println("Order processor shutdown complete.")
 }
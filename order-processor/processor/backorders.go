@@ -0,0 +1,334 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mongodb"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/warehouse"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/webhook"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// eventProductUpdated is published by inventory-service with the stock of the product after a change, it
+	// only tells that stock may be available: the releases reserve it in inventory-service
+	eventProductUpdated = "product.updated"
+	// EventOrderReleased is added to the order stream when a backordered order got all its stock, the
+	// job then processes it like a new order
+	EventOrderReleased = "order.released"
+	// EventBackorderReleased tells the customer that a backordered order is on its way
+	EventBackorderReleased = "order.backorder_released"
+)
+
+// BackorderRelease is the notification sent to the customer when a backordered order is released
+type BackorderRelease struct {
+	Event      string    `json:"event"`
+	TenantID   string    `json:"tenant_id"`
+	OrderID    string    `json:"order_id"`
+	CustomerID string    `json:"customer_id"`
+	ReleasedAt time.Time `json:"released_at"`
+}
+
+// Backorders releases backordered orders when inventory-service announces that their products were
+// restocked
+type Backorders struct {
+	rdb                   *redis.Client
+	productStreamKey      string
+	group                 string
+	consumerID            string
+	orderStreamKey        string
+	notificationStreamKey string
+	collectionName        string
+	notifier              *webhook.Sender
+	stock                 Stock
+	allocator             *warehouse.Allocator
+}
+
+// NewBackorders returns the releaser reading productStreamKey in group and handing released orders to the
+// job on orderStreamKey. Released lines are reserved through stock. Customers are notified on
+// notificationStreamKey and through notifier, which may be nil.
+func NewBackorders(rdb *redis.Client, productStreamKey, group, consumerID, orderStreamKey, notificationStreamKey, collectionName string, notifier *webhook.Sender, stock Stock) *Backorders {
+	return &Backorders{
+		rdb:                   rdb,
+		productStreamKey:      productStreamKey,
+		group:                 group,
+		consumerID:            consumerID,
+		orderStreamKey:        orderStreamKey,
+		notificationStreamKey: notificationStreamKey,
+		collectionName:        collectionName,
+		notifier:              notifier,
+		stock:                 stock,
+	}
+}
+
+// WithAllocator returns the releaser allocating released lines to warehouses with a
+func (b *Backorders) WithAllocator(a *warehouse.Allocator) *Backorders {
+	scoped := *b
+	scoped.allocator = a
+	return &scoped
+}
+
+// Watch reads the product stream until ctx is done. Replicas share the consumer group so every event is
+// handled once, an event is only acknowledged after the orders it released were updated.
+func (b *Backorders) Watch(ctx context.Context) {
+	// Only restocks announced from now on matter, older events carry stock that may be outdated
+	err := b.rdb.XGroupCreateMkStream(ctx, b.productStreamKey, b.group, "$").Err()
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		log.Printf("Failed to create consumer group %s on %s: %v", b.group, b.productStreamKey, err)
+	}
+
+	for ctx.Err() == nil {
+		messages := ReclaimStuckMessages(ctx, b.rdb, b.productStreamKey, b.group, b.consumerID)
+		if len(messages) == 0 {
+			streams, err := b.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+				Group:    b.group,
+				Consumer: b.consumerID,
+				Streams:  []string{b.productStreamKey, ">"},
+				Count:    100,
+				Block:    5 * time.Second,
+			}).Result()
+			if err != nil {
+				if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+					log.Printf("product events: read failed: %v", err)
+					select {
+					case <-ctx.Done():
+					case <-time.After(time.Second):
+					}
+				}
+				continue
+			}
+			for _, stream := range streams {
+				messages = append(messages, stream.Messages...)
+			}
+		}
+
+		if err := b.Release(context.WithoutCancel(ctx), messages); err != nil {
+			log.Printf("Releasing backorders failed: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// Release releases the backordered orders the restocks announced in messages can serve and acknowledges the
+// messages. Waiting lines are served strictly in the order they were placed: a line inventory-service cannot
+// reserve holds back the lines placed after it. Replayed events release nothing twice, the stock a line
+// needs is reserved before it is released.
+func (b *Backorders) Release(ctx context.Context, messages []redis.XMessage) error {
+	type restock struct {
+		tenantID  string
+		productID string
+	}
+
+	// Only the latest stock of a product counts, a product out of stock is not looked at
+	stock := make(map[restock]int)
+	var keys []restock
+	for _, msg := range messages {
+		if msg.Values["event"] != eventProductUpdated {
+			continue
+		}
+		productID, _ := msg.Values["product_id"].(string)
+		units, err := strconv.Atoi(fmt.Sprint(msg.Values["stock"]))
+		if productID == "" || err != nil {
+			continue
+		}
+		// Events published before tenants existed belong to the default tenant
+		tenantID, _ := msg.Values["tenant_id"].(string)
+		if tenantID == "" {
+			tenantID = tenant.Default
+		}
+		key := restock{tenantID: tenantID, productID: productID}
+		if _, ok := stock[key]; !ok {
+			keys = append(keys, key)
+		}
+		stock[key] = units
+	}
+
+	for _, key := range keys {
+		if stock[key] <= 0 {
+			continue
+		}
+		if err := b.releaseProduct(ctx, key.tenantID, key.productID); err != nil {
+			return fmt.Errorf("error releasing backorders of product %s: %w", key.productID, err)
+		}
+	}
+
+	for _, msg := range messages {
+		if err := b.rdb.XAck(ctx, b.productStreamKey, b.group, msg.ID).Err(); err != nil {
+			log.Printf("Failed to ACK product event %s: %v", msg.ID, err)
+		}
+	}
+	return nil
+}
+
+// releaseProduct releases the waiting lines of the product, oldest order first, as long as inventory-service
+// can reserve their stock
+func (b *Backorders) releaseProduct(ctx context.Context, tenantID, productID string) error {
+	collection := GetCollection(b.collectionName)
+
+	waiting := bson.M{"product_id": productID, "backorder": bson.M{"$exists": true}, "backorder.released_at": bson.M{"$exists": false}}
+	cursor, err := collection.Find(ctx,
+		tenant.Filter(tenantID, bson.M{"status": models.Backordered, "items": bson.M{"$elemMatch": waiting}}),
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return err
+	}
+	if len(orders) == 0 {
+		return nil
+	}
+
+	// Released lines are allocated out of the stock held per warehouse, the reservations keep it current
+	levelCtx, cancel := context.WithTimeout(tenant.NewContext(ctx, tenant.Tenant{ID: tenantID}), stockTimeout)
+	level, err := b.stock.Level(levelCtx, productID)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("error reading the stock of product %s: %w", productID, err)
+	}
+
+	for i := range orders {
+		order := &orders[i]
+		now := time.Now()
+
+		reserved, short, err := b.reserveWaiting(ctx, tenantID, order, productID, &level, now)
+		if err != nil {
+			return err
+		}
+		if len(reserved) == 0 {
+			return nil
+		}
+
+		set := bson.M{"items": order.Items, "fulfilments": models.FulfilmentGroups(order.Items, order.Fulfilments, now), "updated_at": now}
+		update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+		released := !models.WaitingForStock(order.Items)
+		if released {
+			set["status"] = models.Pending
+			update["$push"] = bson.M{"status_history": models.StatusChange{Status: models.Pending, Reason: "backordered items in stock", ChangedAt: now}}
+		}
+
+		// Orders cancelled or released meanwhile are left alone and the stock reserved for them goes to the
+		// next order
+		result, err := collection.UpdateOne(ctx,
+			tenant.Filter(tenantID, bson.M{"_id": order.ID, "status": models.Backordered, "version": mongodb.VersionFilter(order.Version)}),
+			update)
+		if err != nil {
+			releaseStock(ctx, b.stock, order, reserved, "backorder not released")
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			releaseStock(ctx, b.stock, order, reserved, "backorder not released")
+			moveLevel(&level, reserved, 1)
+		} else {
+			order.Version++
+			if released {
+				log.Printf("Backordered order %s of tenant %s released", order.ID.Hex(), tenantID)
+				b.handOver(ctx, tenantID, order, now)
+			}
+		}
+		if short {
+			return nil
+		}
+	}
+	return nil
+}
+
+// reserveWaiting reserves the waiting lines of the product in the order one by one, at the warehouse allocated
+// out of level like order-service allocates new lines, and marks the reserved ones released at now. level is
+// lowered by the reservations. short reports that a line could not be allocated or reserved, the lines after
+// it are not tried. On an error the reservations made are released again.
+func (b *Backorders) reserveWaiting(ctx context.Context, tenantID string, order *models.Order, productID string, level *models.StockLevel, now time.Time) (reserved []StockLine, short bool, err error) {
+	for j := range order.Items {
+		item := &order.Items[j]
+		if item.ProductID != productID || !item.Backorder.Waiting() {
+			continue
+		}
+
+		warehouseID, ok := b.allocator.AllocateLevel(order.ShipTo, item.Quantity, *level)
+		if !ok {
+			return reserved, true, nil
+		}
+		line := StockLine{ProductID: item.ProductID, WarehouseID: warehouseID, Quantity: item.Quantity}
+		reserveCtx, cancel := context.WithTimeout(tenant.NewContext(ctx, tenant.Tenant{ID: tenantID}), stockTimeout)
+		err := b.stock.Reserve(reserveCtx, order.ID.Hex(), []StockLine{line})
+		cancel()
+		if errors.Is(err, ErrInsufficientStock) {
+			return reserved, true, nil
+		}
+		if err != nil {
+			releaseStock(ctx, b.stock, order, reserved, "backorder not released")
+			return nil, false, fmt.Errorf("error reserving stock for order %s: %w", order.ID.Hex(), err)
+		}
+		reserved = append(reserved, line)
+		moveLevel(level, []StockLine{line}, -1)
+		item.WarehouseID = warehouseID
+		item.Backorder.ReleasedAt = &now
+	}
+	return reserved, false, nil
+}
+
+// moveLevel adds the lines to the stock level, sign -1 takes them out of it
+func moveLevel(level *models.StockLevel, lines []StockLine, sign int) {
+	for _, line := range lines {
+		level.Stock += sign * line.Quantity
+		for i := range level.Warehouses {
+			if level.Warehouses[i].WarehouseID == line.WarehouseID {
+				level.Warehouses[i].Stock += sign * line.Quantity
+			}
+		}
+	}
+}
+
+// handOver queues the released order for processing and notifies the customer, both best effort: the order is
+// PENDING already and can be reprocessed from there
+func (b *Backorders) handOver(ctx context.Context, tenantID string, order *models.Order, now time.Time) {
+	err := b.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.orderStreamKey,
+		Values: map[string]interface{}{
+			"event":     EventOrderReleased,
+			"order_id":  order.ID.Hex(),
+			"tenant_id": tenantID,
+			"version":   order.Version,
+		},
+	}).Err()
+	if err != nil {
+		log.Printf("Failed to queue released order %s: %v", order.ID.Hex(), err)
+	}
+
+	notice := BackorderRelease{
+		Event:      EventBackorderReleased,
+		TenantID:   tenantID,
+		OrderID:    order.ID.Hex(),
+		CustomerID: order.CustomerID,
+		ReleasedAt: now,
+	}
+	err = b.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.notificationStreamKey,
+		Values: map[string]interface{}{
+			"event":       notice.Event,
+			"order_id":    notice.OrderID,
+			"tenant_id":   notice.TenantID,
+			"customer_id": notice.CustomerID,
+		},
+	}).Err()
+	if err != nil {
+		log.Printf("Failed to notify the customer of released order %s: %v", order.ID.Hex(), err)
+	}
+	if err := b.notifier.Send(ctx, EventBackorderReleased, notice); err != nil {
+		log.Printf("Failed to deliver %s for order %s: %v", EventBackorderReleased, order.ID.Hex(), err)
+	}
+}
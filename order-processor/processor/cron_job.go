@@ -2,35 +2,73 @@ package processor
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
 	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mongodb"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func RunJob(redisClient *redis.Client, streamKey string, group string, consumerID string, collectionName string, jobRunIntervalMints time.Duration) {
+var GetCollection = mongodb.GetCollection
+
+// paymentTimeout bounds a single authorization call to the payment gateway
+const paymentTimeout = 10 * time.Second
+
+// lastSuccess is the unix nano time the last batch completed without a Redis or MongoDB error
+var lastSuccess atomic.Int64
+
+// LastSuccessfulBatch reports when the job last completed a batch, zero before the first one
+func LastSuccessfulBatch() time.Time {
+	if ns := lastSuccess.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// RunJob processes a batch every interval until ctx is done. A batch that is in progress when ctx is done is
+// completed before RunJob returns, so shutdown drains it instead of leaving half-written orders.
+// Every fulfilment group of an authorized order is published to fulfilmentStreamKey for its warehouse, the
+// stock of an order cancelled for a declined payment is released through stock.
+func RunJob(ctx context.Context, redisClient *redis.Client, streamKey string, fulfilmentStreamKey string, group string, consumerID string, collectionName string, jobRunIntervalMints time.Duration, payments payment.Provider, stock Stock) {
 	ticker := time.NewTicker(jobRunIntervalMints)
 	defer ticker.Stop()
 
 	for {
 		log.Println("Cron job triggered...")
-		ctx := context.Background()
-		processOrders(ctx, redisClient, streamKey, group, consumerID, collectionName)
-		<-ticker.C
+		if err := processOrders(context.WithoutCancel(ctx), redisClient, streamKey, fulfilmentStreamKey, group, consumerID, collectionName, payments, stock); err != nil {
+			log.Printf("Cron job failed: %v", err)
+		} else {
+			lastSuccess.Store(time.Now().UnixNano())
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Cron job stopped")
+			return
+		case <-ticker.C:
+		}
 	}
 }
 
 // Updates PENDING orders to PROCESSING every 5 minutes
-func processOrders(ctx context.Context, rdb *redis.Client, streamKey string, group string, consumerID, collectionName string) {
+func processOrders(ctx context.Context, rdb *redis.Client, streamKey string, fulfilmentStreamKey string, group string, consumerID, collectionName string, payments payment.Provider, stock Stock) error {
 
 	// Check if pending messages exist in the stream
 	reclaimedMsgs := ReclaimStuckMessages(ctx, rdb, streamKey, group, consumerID)
 	if len(reclaimedMsgs) > 0 {
 		log.Printf("Reprocessing %d stuck messages from the stream", len(reclaimedMsgs))
-		digestMessages(ctx, rdb, reclaimedMsgs, streamKey, group, collectionName)
+		if err := digestMessages(ctx, rdb, reclaimedMsgs, streamKey, fulfilmentStreamKey, group, collectionName, payments, stock); err != nil {
+			return err
+		}
 	}
 
 	//Read Redis consumer group for new messages
@@ -42,8 +80,7 @@ func processOrders(ctx context.Context, rdb *redis.Client, streamKey string, gro
 	}).Result()
 
 	if err != nil && err != redis.Nil {
-		log.Printf("Redis read error: %v", err)
-		return
+		return fmt.Errorf("redis read error: %w", err)
 	}
 
 	var newMsgs []redis.XMessage
@@ -62,47 +99,169 @@ func processOrders(ctx context.Context, rdb *redis.Client, streamKey string, gro
 
 	if len(newMsgs) == 0 {
 		log.Println("No new messages to process")
-		return
+		return nil
 	}
 
-	digestMessages(ctx, rdb, newMsgs, streamKey, group, collectionName)
+	return digestMessages(ctx, rdb, newMsgs, streamKey, fulfilmentStreamKey, group, collectionName, payments, stock)
 }
 
-func digestMessages(ctx context.Context, rdb *redis.Client, messages []redis.XMessage, streamKey string, group string, collectionName string) {
+func digestMessages(ctx context.Context, rdb *redis.Client, messages []redis.XMessage, streamKey string, fulfilmentStreamKey string, group string, collectionName string, payments payment.Provider, stock Stock) error {
 
-	var pendingOrderIDs []primitive.ObjectID
+	pendingOrderIDs := make(map[string][]primitive.ObjectID)
+	msgsByOrder := make(map[primitive.ObjectID][]redis.XMessage)
 
 	for _, msg := range messages {
 		orderIDStr, _ := msg.Values["order_id"].(string)
 		orderID, _ := primitive.ObjectIDFromHex(orderIDStr)
-		pendingOrderIDs = append(pendingOrderIDs, orderID)
+		// Messages published before tenants existed belong to the default tenant
+		tenantID, _ := msg.Values["tenant_id"].(string)
+		if tenantID == "" {
+			tenantID = tenant.Default
+		}
+		pendingOrderIDs[tenantID] = append(pendingOrderIDs[tenantID], orderID)
+		msgsByOrder[orderID] = append(msgsByOrder[orderID], msg)
 
-		log.Printf("Processing order: %s", orderIDStr)
+		// Orders are always loaded from MongoDB, so several messages (order.created, order.amended) for
+		// the same order collapse into a single authorization of its latest version
+		log.Printf("Processing order: %s of tenant %s (event %v, version %v)", orderIDStr, tenantID, msg.Values["event"], msg.Values["version"])
 	}
 
-	//Update order status PENDING -> PROCESSING in bulk
-	filter := bson.M{"_id": bson.M{"$in": pendingOrderIDs}, "status": "PENDING"}
-	update := bson.M{"$set": bson.M{"status": "PROCESSING", "updated_at": time.Now()}}
-	collection := mongodb.GetCollection(collectionName)
+	collection := GetCollection(collectionName)
 
-	result, err := collection.UpdateMany(ctx, filter, update)
+	// An order is only picked up for the tenant its message was published for
+	scopes := bson.A{}
+	for tenantID, ids := range pendingOrderIDs {
+		scopes = append(scopes, tenant.Filter(tenantID, bson.M{"_id": bson.M{"$in": ids}}))
+	}
+	cur, err := collection.Find(ctx, bson.M{"$or": scopes, "status": models.Pending})
 	if err != nil {
-		log.Printf("Error updating orders: %v", err)
-		return
+		return fmt.Errorf("error fetching pending orders: %w", err)
+	}
+	var orders []models.Order
+	if err := cur.All(ctx, &orders); err != nil {
+		return fmt.Errorf("error decoding pending orders: %w", err)
 	}
 
-	log.Printf("Bulk update completed. Orders updated to PROCESSING: %d", result.ModifiedCount)
+	// Authorize payment for every pending order. Orders whose authorization could not be completed
+	// (e.g. gateway timeout) keep their stream entries un-ACKed so they are reclaimed on the next run.
+	var updates []mongo.WriteModel
+	authorized := make(map[primitive.ObjectID]*models.Payment)
+	var declined []*models.Order
+	retry := make(map[primitive.ObjectID]bool)
 
-	//Clean up stream entries only after DB update succeeds
-	for _, msg := range messages {
-		if err := rdb.XAck(ctx, streamKey, group, msg.ID).Err(); err != nil {
-			log.Printf("Failed to ACK stream entry %s: %v", msg.ID, err)
+	for i := range orders {
+		order := &orders[i]
+
+		authCtx, cancel := context.WithTimeout(ctx, paymentTimeout)
+		record, err := payment.Authorize(authCtx, payments, order)
+		cancel()
+		if err != nil {
+			log.Printf("Payment authorization for order %s failed, will retry: %v", order.ID.Hex(), err)
+			retry[order.ID] = true
 			continue
 		}
-		if err := rdb.XDel(ctx, streamKey, msg.ID).Err(); err != nil {
-			log.Printf("Failed to delete stream entry %s: %v", msg.ID, err)
+
+		//Update order status PENDING -> PROCESSING, or PENDING -> CANCELLED when the payment is declined
+		change := models.StatusChange{Status: models.Processing, Reason: "payment authorized", ChangedAt: time.Now()}
+		groupStatus := models.FulfilmentProcessing
+		if record.Status == models.PaymentDeclined {
+			change.Status = models.Cancelled
+			change.Reason = "payment declined"
+			groupStatus = models.FulfilmentCancelled
+			declined = append(declined, order)
+			log.Printf("Payment declined for order %s, order cancelled", order.ID.Hex())
 		} else {
-			log.Printf("Deleted stream entry: %s", msg.ID)
+			authorized[order.ID] = record
+		}
+
+		set := bson.M{"status": change.Status, "payment": record, "updated_at": change.ChangedAt}
+		if len(order.Fulfilments) > 0 {
+			for j := range order.Fulfilments {
+				order.Fulfilments[j].Status = groupStatus
+				order.Fulfilments[j].UpdatedAt = change.ChangedAt
+			}
+			set["fulfilments"] = order.Fulfilments
+		}
+
+		// The update only applies to the version that was authorized. If the order was amended meanwhile,
+		// the authorization is voided below and the order.amended message triggers a new attempt.
+		updates = append(updates, mongo.NewUpdateOneModel().
+			SetFilter(tenant.Filter(order.TenantID, bson.M{"_id": order.ID, "status": models.Pending, "version": mongodb.VersionFilter(order.Version)})).
+			SetUpdate(bson.M{
+				"$set":  set,
+				"$push": bson.M{"status_history": change},
+				"$inc":  bson.M{"version": 1},
+			}))
+	}
+
+	if len(updates) > 0 {
+		result, err := collection.BulkWrite(ctx, updates, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return fmt.Errorf("error updating orders: %w", err)
+		}
+		log.Printf("Bulk update completed. Orders updated: %d", result.ModifiedCount)
+
+		// An order cancelled while its payment was being authorized must not keep the funds on hold
+		if int(result.ModifiedCount) < len(updates) {
+			voidOrphanedAuthorizations(ctx, collection, payments, authorized)
+		}
+
+		// Cancelled orders give their reserved stock back, the ones amended meanwhile still need it
+		for _, order := range declined {
+			if int(result.ModifiedCount) < len(updates) && !cancelledAt(ctx, collection, order) {
+				continue
+			}
+			releaseStock(ctx, stock, order, reservedLines(order.Items), "payment declined")
+		}
+
+		// Warehouses only start on orders whose authorization stuck
+		for i := range orders {
+			if _, ok := authorized[orders[i].ID]; ok {
+				publishFulfilments(ctx, rdb, fulfilmentStreamKey, &orders[i])
+			}
+		}
+	}
+
+	//Clean up stream entries only after DB update succeeds
+	for orderID, msgs := range msgsByOrder {
+		if retry[orderID] {
+			continue
+		}
+		for _, msg := range msgs {
+			if err := rdb.XAck(ctx, streamKey, group, msg.ID).Err(); err != nil {
+				log.Printf("Failed to ACK stream entry %s: %v", msg.ID, err)
+				continue
+			}
+			if err := rdb.XDel(ctx, streamKey, msg.ID).Err(); err != nil {
+				log.Printf("Failed to delete stream entry %s: %v", msg.ID, err)
+			} else {
+				log.Printf("Deleted stream entry: %s", msg.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// cancelledAt reports whether the update of the job cancelled the order, i.e. the order is cancelled at the
+// version following the one that was authorized
+func cancelledAt(ctx context.Context, collection *mongo.Collection, order *models.Order) bool {
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": order.ID, "status": models.Cancelled, "version": order.Version + 1})
+	return err == nil && count > 0
+}
+
+// voidOrphanedAuthorizations voids authorizations whose order no longer carries them and drops them from
+// authorized
+func voidOrphanedAuthorizations(ctx context.Context, collection *mongo.Collection, payments payment.Provider, authorized map[primitive.ObjectID]*models.Payment) {
+	for orderID, record := range authorized {
+		count, err := collection.CountDocuments(ctx, bson.M{"_id": orderID, "payment.transaction_id": record.TransactionID})
+		if err != nil || count > 0 {
+			continue
+		}
+		delete(authorized, orderID)
+		if err := payment.Refund(ctx, payments, record, record.Amount); err != nil {
+			log.Printf("Failed to void orphaned authorization %s: %v", record.TransactionID, err)
+			continue
 		}
+		log.Printf("Voided authorization %s of order %s cancelled during processing", record.TransactionID, orderID.Hex())
 	}
 }
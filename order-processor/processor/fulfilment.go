@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// publishFulfilments adds a fulfilment.requested message per fulfilment group of the order to the stream
+// read by the warehouses. Orders without groups are fulfilled as a whole and publish a single message
+// without a fulfilment id.
+func publishFulfilments(ctx context.Context, rdb *redis.Client, streamKey string, order *models.Order) {
+	groups := order.Fulfilments
+	if len(groups) == 0 {
+		items := make([]models.ShipmentItem, 0, len(order.Items))
+		for _, item := range order.Items {
+			items = append(items, models.ShipmentItem{ProductID: item.ProductID, Quantity: item.Quantity})
+		}
+		groups = []models.FulfilmentGroup{{Items: items, Status: models.FulfilmentProcessing}}
+	}
+
+	for _, group := range groups {
+		itemsJSON, err := json.Marshal(group.Items)
+		if err != nil {
+			log.Printf("Failed to marshal items of fulfilment %s of order %s: %v", group.ID, order.ID.Hex(), err)
+			continue
+		}
+		err = rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: streamKey,
+			Values: map[string]interface{}{
+				"event":         "fulfilment.requested",
+				"order_id":      order.ID.Hex(),
+				"tenant_id":     order.TenantID,
+				"fulfilment_id": group.ID,
+				"warehouse_id":  group.WarehouseID,
+				// The processing update bumped the version the order was loaded with
+				"version": order.Version + 1,
+				"items":   string(itemsJSON)},
+		}).Err()
+		if err != nil {
+			log.Printf("Failed to publish fulfilment %s of order %s: %v", group.ID, order.ID.Hex(), err)
+		}
+	}
+}
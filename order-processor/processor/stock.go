@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	inventoryv1 "github.com/dinesh-man/ecommerce-order-processing-system/pkg/pb/inventory/v1"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// stockTimeout bounds a single reservation or release call to inventory-service
+const stockTimeout = 5 * time.Second
+
+// ErrInsufficientStock is returned when inventory-service does not hold the units of a reservation anymore
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// StockLine is a quantity of a product reserved for an order, at a warehouse when WarehouseID is set
+type StockLine struct {
+	ProductID   string
+	WarehouseID string
+	Quantity    int
+}
+
+// Stock moves the stock of orders in inventory-service. Calls act for the tenant of ctx.
+type Stock interface {
+	// Reserve takes the lines out of stock, all or nothing
+	Reserve(ctx context.Context, orderID string, lines []StockLine) error
+	// Release puts reserved lines back into stock
+	Release(ctx context.Context, orderID string, lines []StockLine, reason string) error
+	// Level returns the stock of the product per warehouse, a zero level for unknown products
+	Level(ctx context.Context, productID string) (models.StockLevel, error)
+}
+
+type grpcStock struct {
+	client inventoryv1.InventoryServiceClient
+}
+
+// NewGRPCStock returns the Stock of the inventory-service gRPC API reached through conn
+func NewGRPCStock(conn grpc.ClientConnInterface) Stock {
+	return &grpcStock{client: inventoryv1.NewInventoryServiceClient(conn)}
+}
+
+func (s *grpcStock) Reserve(ctx context.Context, orderID string, lines []StockLine) error {
+	_, err := s.client.ReserveStock(tenant.OutgoingContext(ctx), &inventoryv1.ReserveStockRequest{Lines: toStockLines(orderID, lines)})
+	if status.Code(err) == codes.FailedPrecondition {
+		return fmt.Errorf("%w: %s", ErrInsufficientStock, status.Convert(err).Message())
+	}
+	return err
+}
+
+func (s *grpcStock) Release(ctx context.Context, orderID string, lines []StockLine, reason string) error {
+	_, err := s.client.ReleaseStock(tenant.OutgoingContext(ctx), &inventoryv1.ReleaseStockRequest{Lines: toStockLines(orderID, lines), Reason: reason})
+	return err
+}
+
+func (s *grpcStock) Level(ctx context.Context, productID string) (models.StockLevel, error) {
+	resp, err := s.client.BatchGetProducts(tenant.OutgoingContext(ctx), &inventoryv1.BatchGetProductsRequest{Ids: []string{productID}})
+	if err != nil {
+		return models.StockLevel{}, err
+	}
+	var level models.StockLevel
+	for _, p := range resp.GetProducts() {
+		if p.GetId() != productID {
+			continue
+		}
+		level.Stock = int(p.GetStock())
+		for _, held := range p.GetWarehouses() {
+			level.Warehouses = append(level.Warehouses, models.WarehouseStock{WarehouseID: held.GetWarehouseId(), Stock: int(held.GetStock())})
+		}
+	}
+	return level, nil
+}
+
+func toStockLines(orderID string, lines []StockLine) []*inventoryv1.StockLine {
+	out := make([]*inventoryv1.StockLine, len(lines))
+	for i, line := range lines {
+		out[i] = &inventoryv1.StockLine{ProductId: line.ProductID, WarehouseId: line.WarehouseID, Quantity: int64(line.Quantity), OrderId: orderID}
+	}
+	return out
+}
+
+// reservedLines returns the stock the line items hold in inventory-service: every line except backordered
+// ones still waiting for stock
+func reservedLines(items []models.LineItem) []StockLine {
+	var lines []StockLine
+	for _, item := range items {
+		if item.Backorder.Waiting() {
+			continue
+		}
+		lines = append(lines, StockLine{ProductID: item.ProductID, WarehouseID: item.WarehouseID, Quantity: item.Quantity})
+	}
+	return lines
+}
+
+// releaseStock gives the stock reserved for the order back to inventory-service. The order has already
+// changed, so a failure is logged with the lines to release by hand.
+func releaseStock(ctx context.Context, stock Stock, order *models.Order, lines []StockLine, reason string) {
+	if len(lines) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(tenant.NewContext(ctx, tenant.Tenant{ID: order.TenantID}), stockTimeout)
+	defer cancel()
+	if err := stock.Release(ctx, order.ID.Hex(), lines, reason); err != nil {
+		log.Printf("Failed to release stock %+v of order %s (%s): %v", lines, order.ID.Hex(), reason, err)
+	}
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/problem"
+)
+
+// writeProblem sends a problem+json response for errors detected by the handlers themselves
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code string, detail string) {
+	problem.Write(w, r, status, code, detail)
+}
+
+// writeError maps a service error to its HTTP status. A version conflict is reported as 412 when the
+// client sent If-Match and as 409 otherwise. Errors without a kind are logged and hidden behind a 500.
+func writeError(w http.ResponseWriter, r *http.Request, err error, precondition *int64) {
+	var svcErr *service.Error
+	if !errors.As(err, &svcErr) {
+		log.Printf("Internal error on %s %s: %v", r.Method, r.URL.Path, err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "an unexpected error occurred")
+		return
+	}
+
+	status := statusOf(svcErr.Kind)
+	if errors.Is(err, service.ErrVersionConflict) && precondition != nil {
+		status = http.StatusPreconditionFailed
+	}
+	if svcErr.Err != nil {
+		log.Printf("Error on %s %s: %v", r.Method, r.URL.Path, err)
+	}
+	writeProblem(w, r, status, svcErr.Code, svcErr.Message)
+}
+
+func statusOf(kind service.ErrorKind) int {
+	switch kind {
+	case service.KindNotFound:
+		return http.StatusNotFound
+	case service.KindInvalidArgument:
+		return http.StatusBadRequest
+	case service.KindConflict, service.KindInsufficientStock:
+		return http.StatusConflict
+	case service.KindUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
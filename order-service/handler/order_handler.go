@@ -2,137 +2,344 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
-	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/etag"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
 )
 
 // OrderHandler handles HTTP requests for orders
 type OrderHandler struct {
-	service *service.OrderService
+	service              *service.OrderService
+	carrierWebhookSecret string
+	limits               OrderLimits
+	verifier             *auth.Verifier
+	tenants              *tenant.Registry
 }
 
-type ErrorResponse struct {
-	Message string `json:"message"`
-	Code    int    `json:"code"`
+// NewOrderHandler returns the order API, requests are authenticated with verifier unless it is nil. They act
+// for a tenant of tenants, any tenant when it is nil.
+func NewOrderHandler(s *service.OrderService, carrierWebhookSecret string, limits OrderLimits, verifier *auth.Verifier, tenants *tenant.Registry) *OrderHandler {
+	return &OrderHandler{service: s, carrierWebhookSecret: carrierWebhookSecret, limits: limits, verifier: verifier, tenants: tenants}
 }
 
-func NewOrderHandler(s *service.OrderService) *OrderHandler {
-	return &OrderHandler{service: s}
+// scoped returns the service acting for the tenant of the request
+func (h *OrderHandler) scoped(r *http.Request) *service.OrderService {
+	return h.service.ForTenant(tenant.FromContext(r.Context()))
 }
 
-func writeJSONError(w http.ResponseWriter, message string, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(ErrorResponse{
-		Message: message,
-		Code:    code,
+// limitsFor returns the order limits of the tenant of the request
+func (h *OrderHandler) limitsFor(r *http.Request) OrderLimits {
+	return h.limits.ForTenant(tenant.FromContext(r.Context()))
+}
+
+// ifMatch reads the If-Match precondition of a mutating request on the order id. A malformed header is a bad
+// request, a header without a strong ETag fails the precondition.
+func (h *OrderHandler) ifMatch(w http.ResponseWriter, r *http.Request, id string) (*int64, bool) {
+	version, err := etag.IfMatch(r, func() (int64, error) {
+		order, err := h.scoped(r).GetOrderByID(id)
+		if err != nil {
+			return 0, err
+		}
+		return order.Version, nil
 	})
+	if errors.Is(err, etag.ErrInvalidIfMatch) {
+		writeProblem(w, r, http.StatusBadRequest, "invalid_if_match", err.Error())
+		return nil, false
+	}
+	if err != nil {
+		writeProblem(w, r, http.StatusPreconditionFailed, "version_conflict", err.Error())
+		return nil, false
+	}
+	return version, true
 }
 
-// CreateOrderHandler handles POST /order
+// CreateOrderHandler handles POST /v1/orders
 func (h *OrderHandler) CreateOrderHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
 
-	if r.Method != http.MethodPost {
-		writeJSONError(w, fmt.Sprintf("Method not allowed: %s", r.Method), http.StatusMethodNotAllowed)
+	var req CreateOrderRequest
+	if !h.decodeJSON(w, r, &req) {
 		return
 	}
 
-	var order models.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
-		return
+	// Customers order for themselves, the customer_id may be left out
+	if customer := auth.CustomerScope(r.Context()); customer != "" {
+		if req.CustomerID != "" && req.CustomerID != customer {
+			writeProblem(w, r, http.StatusForbidden, "forbidden", "customers can only place orders for themselves")
+			return
+		}
+		req.CustomerID = customer
 	}
 
-	if len(order.Items) == 0 {
-		writeJSONError(w, "Order must contain at least one item", http.StatusBadRequest)
+	if err := req.Validate(h.limitsFor(r)); err != nil {
+		writeValidationError(w, r, err)
 		return
 	}
 
-	createdOrder, err := h.service.CreateOrder(order)
+	createdOrder, err := h.scoped(r).CreateOrder(req.Order())
 	if err != nil {
-		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err, nil)
 		return
 	}
 
+	etag.Set(w, createdOrder.Version)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(createdOrder)
 }
 
-// GetOrderHandler handles GET /order/?id=123
+// QuoteOrderHandler handles POST /v1/orders/quote, it prices an order without placing it
+func (h *OrderHandler) QuoteOrderHandler(w http.ResponseWriter, r *http.Request) {
+
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+
+	var req CreateOrderRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if customer := auth.CustomerScope(r.Context()); customer != "" {
+		if req.CustomerID != "" && req.CustomerID != customer {
+			writeProblem(w, r, http.StatusForbidden, "forbidden", "customers can only quote orders for themselves")
+			return
+		}
+		req.CustomerID = customer
+	}
+
+	if err := req.Validate(h.limitsFor(r)); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	quote, err := h.scoped(r).Quote(req.Order())
+	if err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+// AmendOrderHandler handles PATCH /v1/orders/{id}, the base version is taken from If-Match or the body
+func (h *OrderHandler) AmendOrderHandler(w http.ResponseWriter, r *http.Request) {
+
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+
+	id := param(r, "id")
+	if id == "" {
+		writeProblem(w, r, http.StatusBadRequest, "missing_order_id", "Missing order id")
+		return
+	}
+
+	precondition, ok := h.ifMatch(w, r, id)
+	if !ok || !h.ownsOrder(w, r, id) {
+		return
+	}
+
+	var amendment service.OrderAmendment
+	if !h.decodeJSON(w, r, &amendment) {
+		return
+	}
+
+	if err := validateAmendment(amendment, h.limitsFor(r)); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	order, err := h.scoped(r).AmendOrder(id, amendment, precondition)
+	if err != nil {
+		writeError(w, r, err, precondition)
+		return
+	}
+
+	etag.Set(w, order.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// GetOrderHandler handles GET /v1/orders/{id}
 func (h *OrderHandler) GetOrderHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
 
-	id := r.URL.Query().Get("id")
+	id := param(r, "id")
 
 	if id == "" {
-		writeJSONError(w, "Missing order id", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, "missing_order_id", "Missing order id")
 		return
 	}
 
-	order, err := h.service.GetOrderByID(id)
+	order, err := h.scoped(r).GetOrderByID(id)
+	if err == nil && !canSee(r, order.CustomerID) {
+		err = service.ErrOrderNotFound
+	}
 	if err != nil {
-		writeJSONError(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err, nil)
 		return
 	}
 
+	etag.Set(w, order.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(order)
 }
 
-// ListOrdersHandler handles GET /orders?status=PENDING
+// ListOrdersHandler handles GET /v1/orders?status=PENDING&customer_id=C001&product_id=P001&created_from=2025-01-01&created_to=2025-02-01&min_total=10&max_total=100
+// with sort=created_at|updated_at|total, order=asc|desc, cursor=, pageSize= and include_total=true
 func (h *OrderHandler) ListOrdersHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
 
-	status := r.URL.Query().Get("status")
-	cursor := r.URL.Query().Get("cursor")
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid_filter", err.Error())
+		return
+	}
+
+	// Customers only ever list their own orders
+	if customer := auth.CustomerScope(r.Context()); customer != "" {
+		if filter.CustomerID != "" && filter.CustomerID != customer {
+			writeProblem(w, r, http.StatusForbidden, "forbidden", "customers can only list their own orders")
+			return
+		}
+		filter.CustomerID = customer
+	}
+	h.listOrders(w, r, filter)
+}
+
+// ListCustomerOrdersHandler handles GET /v1/customers/{id}/orders, accepting the same filters as /v1/orders
+func (h *OrderHandler) ListCustomerOrdersHandler(w http.ResponseWriter, r *http.Request) {
+
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid_filter", err.Error())
+		return
+	}
+	filter.CustomerID = r.PathValue("id")
+	if filter.CustomerID == "" {
+		writeProblem(w, r, http.StatusBadRequest, "missing_customer_id", "Missing customer id")
+		return
+	}
+	if !canSee(r, filter.CustomerID) {
+		writeProblem(w, r, http.StatusForbidden, "forbidden", "customers can only list their own orders")
+		return
+	}
+	h.listOrders(w, r, filter)
+}
+
+func (h *OrderHandler) listOrders(w http.ResponseWriter, r *http.Request, filter service.OrderFilter) {
+	q := r.URL.Query()
+	opts := service.ListOptions{
+		Filter:       filter,
+		SortBy:       q.Get("sort"),
+		Cursor:       q.Get("cursor"),
+		IncludeTotal: q.Get("include_total") == "true",
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		writeProblem(w, r, http.StatusBadRequest, "invalid_sort", "order must be asc or desc")
+		return
+	}
 
 	// Default pageSize to 10 if pagesize is not provided
-	pageSize := int64(10)
-	if ps := r.URL.Query().Get("pageSize"); ps != "" {
+	opts.PageSize = int64(10)
+	if ps := q.Get("pageSize"); ps != "" {
 		if parsed, err := strconv.ParseInt(ps, 10, 64); err == nil && parsed > 0 {
-			pageSize = parsed
+			opts.PageSize = parsed
 		}
 	}
 
-	orders, nextCursor, err := h.service.ListOrders(status, cursor, pageSize)
+	page, err := h.scoped(r).ListOrders(opts)
 	if err != nil {
-		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err, nil)
 		return
 	}
 
-	response := map[string]interface{}{
-		"orders":      orders,
-		"next_cursor": nextCursor,
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseOrderFilter reads the list filters from the query string. Dates accept RFC 3339 timestamps or
+// plain YYYY-MM-DD days, created_to is exclusive.
+func parseOrderFilter(r *http.Request) (service.OrderFilter, error) {
+	q := r.URL.Query()
+	filter := service.OrderFilter{
+		Status:     q.Get("status"),
+		CustomerID: q.Get("customer_id"),
+		ProductID:  q.Get("product_id"),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	var err error
+	if filter.CreatedFrom, err = parseDate(q.Get("created_from")); err != nil {
+		return filter, fmt.Errorf("invalid created_from: %w", err)
+	}
+	if filter.CreatedTo, err = parseDate(q.Get("created_to")); err != nil {
+		return filter, fmt.Errorf("invalid created_to: %w", err)
+	}
+	if filter.MinTotal, err = parseAmount(q.Get("min_total")); err != nil {
+		return filter, fmt.Errorf("invalid min_total: %w", err)
+	}
+	if filter.MaxTotal, err = parseAmount(q.Get("max_total")); err != nil {
+		return filter, fmt.Errorf("invalid max_total: %w", err)
+	}
+	return filter, nil
 }
 
-// CancelOrderHandler handles DELETE /order/cancel?id=123
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+func parseAmount(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &amount, nil
+}
+
+// CancelOrderHandler handles POST /v1/orders/{id}/cancel
 func (h *OrderHandler) CancelOrderHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
 
-	id := r.URL.Query().Get("id")
+	id := param(r, "id")
 
 	if id == "" {
-		writeJSONError(w, "Missing order id", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, "missing_order_id", "Missing order id")
+		return
+	}
+
+	precondition, ok := h.ifMatch(w, r, id)
+	if !ok || !h.ownsOrder(w, r, id) {
 		return
 	}
 
-	err := h.service.CancelOrder(id)
+	err := h.scoped(r).CancelOrder(id, precondition)
 	if err != nil {
-		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err, precondition)
 		return
 	}
 
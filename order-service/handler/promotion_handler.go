@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/validation"
+)
+
+// PromotionRequest is the body of POST /v1/promotions. Usage counts and the active flag are kept by the
+// service.
+type PromotionRequest struct {
+	Name        string               `json:"name"`
+	Code        string               `json:"code,omitempty"`
+	Type        models.PromotionType `json:"type"`
+	Percent     float64              `json:"percent,omitempty"`
+	Amount      float64              `json:"amount,omitempty"`
+	BuyQuantity int                  `json:"buy_quantity,omitempty"`
+	GetQuantity int                  `json:"get_quantity,omitempty"`
+	ProductIDs  []string             `json:"product_ids,omitempty"`
+	Categories  []string             `json:"categories,omitempty"`
+	Brands      []string             `json:"brands,omitempty"`
+	MinSubtotal float64              `json:"min_subtotal,omitempty"`
+	Stackable   bool                 `json:"stackable,omitempty"`
+	UsageLimit  int                  `json:"usage_limit,omitempty"`
+	StartsAt    *time.Time           `json:"starts_at,omitempty"`
+	ExpiresAt   *time.Time           `json:"expires_at,omitempty"`
+}
+
+// Validate checks the rule of the promotion and reports every invalid field
+func (req PromotionRequest) Validate() error {
+	var v validation.Validator
+	v.Required("name", req.Name)
+	v.MaxLen("name", req.Name, 128)
+	v.MaxLen("code", req.Code, 64)
+	switch req.Type {
+	case models.PercentOff:
+		v.Check(req.Percent > 0 && req.Percent <= 100, "percent", "must be above 0 and at most 100")
+	case models.AmountOff:
+		v.Check(req.Amount > 0, "amount", "must be positive")
+	case models.BuyXGetY:
+		v.Check(req.BuyQuantity > 0, "buy_quantity", "must be positive")
+		v.Check(req.GetQuantity > 0, "get_quantity", "must be positive")
+	default:
+		v.Check(false, "type", "must be one of %s, %s or %s", models.PercentOff, models.AmountOff, models.BuyXGetY)
+	}
+	v.Check(req.MinSubtotal >= 0, "min_subtotal", "must not be negative")
+	v.Check(req.UsageLimit >= 0, "usage_limit", "must not be negative")
+	if req.StartsAt != nil && req.ExpiresAt != nil {
+		v.Check(req.ExpiresAt.After(*req.StartsAt), "expires_at", "must be after starts_at")
+	}
+	for i, id := range req.ProductIDs {
+		v.Required(fmt.Sprintf("product_ids[%d]", i), id)
+	}
+	return v.Err()
+}
+
+// Promotion converts the request into the promotion passed to the service
+func (req PromotionRequest) Promotion() models.Promotion {
+	return models.Promotion{
+		Name:        req.Name,
+		Code:        req.Code,
+		Type:        req.Type,
+		Percent:     req.Percent,
+		Amount:      req.Amount,
+		BuyQuantity: req.BuyQuantity,
+		GetQuantity: req.GetQuantity,
+		ProductIDs:  req.ProductIDs,
+		Categories:  req.Categories,
+		Brands:      req.Brands,
+		MinSubtotal: req.MinSubtotal,
+		Stackable:   req.Stackable,
+		UsageLimit:  req.UsageLimit,
+		StartsAt:    req.StartsAt,
+		ExpiresAt:   req.ExpiresAt,
+	}
+}
+
+// CreatePromotionHandler handles POST /v1/promotions
+func (h *OrderHandler) CreatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+
+	var req PromotionRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	created, err := h.scoped(r).CreatePromotion(req.Promotion())
+	if err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// ListPromotionsHandler handles GET /v1/promotions
+func (h *OrderHandler) ListPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+
+	promotions, err := h.scoped(r).ListPromotions()
+	if err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promotions)
+}
+
+// DeactivatePromotionHandler handles DELETE /v1/promotions/{id}
+func (h *OrderHandler) DeactivatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+
+	promotion, err := h.scoped(r).DeactivatePromotion(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promotion)
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+)
+
+// ReturnRequestBody is the body of POST /v1/orders/{id}/returns
+type ReturnRequestBody struct {
+	Items []models.ReturnItem `json:"items"`
+}
+
+// ReturnDecisionBody is the body of the staff approve/reject endpoints
+type ReturnDecisionBody struct {
+	Note string `json:"note"`
+}
+
+// RequestReturnHandler handles POST /v1/orders/{id}/returns
+func (h *OrderHandler) RequestReturnHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+
+	id := param(r, "id")
+	if id == "" {
+		writeProblem(w, r, http.StatusBadRequest, "missing_order_id", "Missing order id")
+		return
+	}
+
+	precondition, ok := h.ifMatch(w, r, id)
+	if !ok || !h.ownsOrder(w, r, id) {
+		return
+	}
+
+	var body ReturnRequestBody
+	if !h.decodeJSON(w, r, &body) {
+		return
+	}
+
+	rma, err := h.scoped(r).RequestReturn(id, body.Items, precondition)
+	if err != nil {
+		writeError(w, r, err, precondition)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rma)
+}
+
+// ApproveReturnHandler handles POST /v1/orders/{id}/returns/{return_id}/approve
+func (h *OrderHandler) ApproveReturnHandler(w http.ResponseWriter, r *http.Request) {
+	h.decideReturn(w, r, h.scoped(r).ApproveReturn)
+}
+
+// RejectReturnHandler handles POST /v1/orders/{id}/returns/{return_id}/reject
+func (h *OrderHandler) RejectReturnHandler(w http.ResponseWriter, r *http.Request) {
+	h.decideReturn(w, r, h.scoped(r).RejectReturn)
+}
+
+func (h *OrderHandler) decideReturn(w http.ResponseWriter, r *http.Request, decide func(string, string, string, *int64) (*models.ReturnRequest, error)) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+
+	id, returnID := param(r, "id"), param(r, "return_id")
+	if id == "" || returnID == "" {
+		writeProblem(w, r, http.StatusBadRequest, "missing_return_id", "Missing order id or return id")
+		return
+	}
+
+	precondition, ok := h.ifMatch(w, r, id)
+	if !ok {
+		return
+	}
+
+	var body ReturnDecisionBody
+	if r.ContentLength != 0 {
+		if !h.decodeJSON(w, r, &body) {
+			return
+		}
+	}
+
+	rma, err := decide(id, returnID, body.Note, precondition)
+	if err != nil {
+		writeError(w, r, err, precondition)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rma)
+}
+
+// ReceiveReturnHandler handles POST /v1/orders/{id}/returns/{return_id}/receive
+func (h *OrderHandler) ReceiveReturnHandler(w http.ResponseWriter, r *http.Request) {
+	h.completeReturn(w, r, h.scoped(r).ReceiveReturn)
+}
+
+// RefundReturnHandler handles POST /v1/orders/{id}/returns/{return_id}/refund
+func (h *OrderHandler) RefundReturnHandler(w http.ResponseWriter, r *http.Request) {
+	h.completeReturn(w, r, h.scoped(r).RefundReturn)
+}
+
+func (h *OrderHandler) completeReturn(w http.ResponseWriter, r *http.Request, complete func(string, string, *int64) (*models.ReturnRequest, error)) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+
+	id, returnID := param(r, "id"), param(r, "return_id")
+	if id == "" || returnID == "" {
+		writeProblem(w, r, http.StatusBadRequest, "missing_return_id", "Missing order id or return id")
+		return
+	}
+
+	precondition, ok := h.ifMatch(w, r, id)
+	if !ok {
+		return
+	}
+
+	rma, err := complete(id, returnID, precondition)
+	if err != nil {
+		// the items were received but the restock or the refund failed, both are retried via the refund endpoint
+		if rma != nil {
+			code := "refund_failed"
+			if !rma.Restocked() {
+				code = "restock_failed"
+			}
+			writeProblem(w, r, http.StatusBadGateway, code, err.Error())
+			return
+		}
+		writeError(w, r, err, precondition)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rma)
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"expvar"
+	"net/http"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/api"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/router"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+)
+
+// Routes registers the versioned API and the legacy query-parameter paths as deprecated aliases
+func (h *OrderHandler) Routes() http.Handler {
+	rt := router.New()
+
+	// Customers are limited to their own orders by the handlers, staff manage shipments and returns and
+	// admins the promotions. Order and promotion requests act for the caller's tenant. The carrier webhook
+	// is authenticated with its shared secret and finds orders across tenants.
+	anyRole := tenant.Guard(h.tenants, auth.Require(h.verifier, auth.RoleCustomer, auth.RoleSupport, auth.RoleAdmin))
+	staff := tenant.Guard(h.tenants, auth.Require(h.verifier, auth.RoleSupport, auth.RoleAdmin))
+	admin := auth.Require(h.verifier, auth.RoleAdmin)
+	tenantAdmin := tenant.Guard(h.tenants, admin)
+
+	rt.Handle("POST /v1/orders", anyRole(h.CreateOrderHandler))
+	rt.Handle("POST /v1/orders/quote", anyRole(h.QuoteOrderHandler))
+	rt.Handle("GET /v1/orders", anyRole(h.ListOrdersHandler))
+	rt.Handle("GET /v1/orders/{id}", anyRole(h.GetOrderHandler))
+	rt.Handle("PATCH /v1/orders/{id}", anyRole(h.AmendOrderHandler))
+	rt.Handle("POST /v1/orders/{id}/cancel", anyRole(h.CancelOrderHandler))
+	rt.Handle("POST /v1/orders/{id}/shipments", staff(h.CreateShipmentHandler))
+	rt.Handle("POST /v1/orders/{id}/returns", anyRole(h.RequestReturnHandler))
+	rt.Handle("POST /v1/orders/{id}/returns/{return_id}/approve", staff(h.ApproveReturnHandler))
+	rt.Handle("POST /v1/orders/{id}/returns/{return_id}/reject", staff(h.RejectReturnHandler))
+	rt.Handle("POST /v1/orders/{id}/returns/{return_id}/receive", staff(h.ReceiveReturnHandler))
+	rt.Handle("POST /v1/orders/{id}/returns/{return_id}/refund", staff(h.RefundReturnHandler))
+	rt.Handle("GET /v1/customers/{id}/orders", anyRole(h.ListCustomerOrdersHandler))
+	rt.Handle("POST /v1/shipments/events", h.CarrierEventHandler)
+	rt.Handle("POST /v1/promotions", tenantAdmin(h.CreatePromotionHandler))
+	rt.Handle("GET /v1/promotions", tenantAdmin(h.ListPromotionsHandler))
+	rt.Handle("DELETE /v1/promotions/{id}", tenantAdmin(h.DeactivatePromotionHandler))
+	rt.Handle("GET /openapi.json", api.Handler)
+	rt.Handle("GET /debug/vars", admin(expvar.Handler().ServeHTTP))
+
+	rt.Deprecated("POST /order", "/v1/orders", anyRole(h.CreateOrderHandler))
+	rt.Deprecated("POST /order/quote", "/v1/orders/quote", anyRole(h.QuoteOrderHandler))
+	rt.Deprecated("GET /order", "/v1/orders/{id}", anyRole(h.GetOrderHandler))
+	rt.Deprecated("PATCH /order", "/v1/orders/{id}", anyRole(h.AmendOrderHandler))
+	rt.Deprecated("GET /orders", "/v1/orders", anyRole(h.ListOrdersHandler))
+	rt.Deprecated("GET /customers/{id}/orders", "/v1/customers/{id}/orders", anyRole(h.ListCustomerOrdersHandler))
+	rt.Deprecated("DELETE /order/cancel", "/v1/orders/{id}/cancel", anyRole(h.CancelOrderHandler))
+	rt.Deprecated("POST /order/shipments", "/v1/orders/{id}/shipments", staff(h.CreateShipmentHandler))
+	rt.Deprecated("POST /shipments/events", "/v1/shipments/events", h.CarrierEventHandler)
+	rt.Deprecated("POST /order/returns", "/v1/orders/{id}/returns", anyRole(h.RequestReturnHandler))
+	rt.Deprecated("POST /order/returns/approve", "/v1/orders/{id}/returns/{return_id}/approve", staff(h.ApproveReturnHandler))
+	rt.Deprecated("POST /order/returns/reject", "/v1/orders/{id}/returns/{return_id}/reject", staff(h.RejectReturnHandler))
+	rt.Deprecated("POST /order/returns/receive", "/v1/orders/{id}/returns/{return_id}/receive", staff(h.ReceiveReturnHandler))
+	rt.Deprecated("POST /order/returns/refund", "/v1/orders/{id}/returns/{return_id}/refund", staff(h.RefundReturnHandler))
+
+	return rt
+}
+
+// param reads a route parameter, falling back to the query string used by the legacy paths
+func param(r *http.Request, name string) string {
+	if v := r.PathValue(name); v != "" {
+		return v
+	}
+	return r.URL.Query().Get(name)
+}
+
+// canSee reports whether the caller may see the orders of a customer
+func canSee(r *http.Request, customerID string) bool {
+	customer := auth.CustomerScope(r.Context())
+	return customer == "" || customer == customerID
+}
+
+// ownsOrder checks that customers only change their own orders. Other customers' orders are reported as
+// not found so their ids cannot be probed.
+func (h *OrderHandler) ownsOrder(w http.ResponseWriter, r *http.Request, id string) bool {
+	if auth.CustomerScope(r.Context()) == "" {
+		return true
+	}
+
+	order, err := h.scoped(r).GetOrderByID(id)
+	if err == nil && !canSee(r, order.CustomerID) {
+		err = service.ErrOrderNotFound
+	}
+	if err != nil {
+		writeError(w, r, err, nil)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+)
+
+// CreateShipmentHandler handles POST /v1/orders/{id}/shipments
+func (h *OrderHandler) CreateShipmentHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+
+	id := param(r, "id")
+	if id == "" {
+		writeProblem(w, r, http.StatusBadRequest, "missing_order_id", "Missing order id")
+		return
+	}
+
+	precondition, ok := h.ifMatch(w, r, id)
+	if !ok {
+		return
+	}
+
+	var shipment models.Shipment
+	if !h.decodeJSON(w, r, &shipment) {
+		return
+	}
+
+	created, err := h.scoped(r).CreateShipment(id, shipment, precondition)
+	if err != nil {
+		writeError(w, r, err, precondition)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// CarrierEventHandler handles POST /v1/shipments/events, the carrier tracking webhook
+func (h *OrderHandler) CarrierEventHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+
+	// Without a configured secret the webhook is closed rather than open to anyone
+	if h.carrierWebhookSecret == "" ||
+		subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Webhook-Secret")), []byte(h.carrierWebhookSecret)) != 1 {
+		writeProblem(w, r, http.StatusUnauthorized, "invalid_webhook_secret", "Invalid webhook secret")
+		return
+	}
+
+	var event models.CarrierEvent
+	if !h.decodeJSON(w, r, &event) {
+		return
+	}
+
+	order, err := h.service.HandleCarrierEvent(event)
+	if err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/problem"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/validation"
+)
+
+// OrderLimits bounds the size of incoming order payloads
+type OrderLimits struct {
+	MaxItems     int
+	MaxQuantity  int
+	MaxBodyBytes int64
+}
+
+// DefaultOrderLimits are used for every limit that is not configured
+func DefaultOrderLimits() OrderLimits {
+	return OrderLimits{MaxItems: 50, MaxQuantity: 1000, MaxBodyBytes: 1 << 20}
+}
+
+// OrderLimitsFromEnv reads ORDER_MAX_ITEMS, ORDER_MAX_QUANTITY and ORDER_MAX_BODY_BYTES
+func OrderLimitsFromEnv() OrderLimits {
+	limits := DefaultOrderLimits()
+	limits.MaxItems = int(positiveEnv("ORDER_MAX_ITEMS", int64(limits.MaxItems)))
+	limits.MaxQuantity = int(positiveEnv("ORDER_MAX_QUANTITY", int64(limits.MaxQuantity)))
+	limits.MaxBodyBytes = positiveEnv("ORDER_MAX_BODY_BYTES", limits.MaxBodyBytes)
+	return limits
+}
+
+// ForTenant applies the limits configured for the tenant
+func (l OrderLimits) ForTenant(t tenant.Tenant) OrderLimits {
+	if t.MaxItems > 0 {
+		l.MaxItems = t.MaxItems
+	}
+	if t.MaxQuantity > 0 {
+		l.MaxQuantity = t.MaxQuantity
+	}
+	return l
+}
+
+func positiveEnv(name string, fallback int64) int64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		log.Fatalf("invalid %s: %s", name, v)
+	}
+	return n
+}
+
+// CreateOrderRequest is the body of POST /v1/orders. Identifiers, prices, totals and status are assigned by the
+// service, so clients sending them are rejected as unknown fields.
+type CreateOrderRequest struct {
+	CustomerID string             `json:"customer_id"`
+	Items      []OrderItemRequest `json:"items"`
+	// ShipTo is where the order is delivered, the closest allocation rule picks warehouses near it
+	ShipTo *models.Location `json:"ship_to,omitempty"`
+	// CouponCodes are the coupons the customer redeems with the order
+	CouponCodes []string `json:"coupon_codes,omitempty"`
+	// Region is the ISO 3166 country or subdivision code the order ships to, its tax rates apply
+	Region string `json:"region,omitempty"`
+}
+
+// maxCouponCodes bounds the coupons an order may carry
+const maxCouponCodes = 5
+
+// regionCode matches ISO 3166 country (DE) and subdivision (US-CA) codes
+var regionCode = regexp.MustCompile(`^[A-Za-z]{2}(-[A-Za-z0-9]{1,3})?$`)
+
+// OrderItemRequest is a requested order line
+type OrderItemRequest struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Validate checks the request against the order limits and reports every invalid field
+func (req CreateOrderRequest) Validate(limits OrderLimits) error {
+	var v validation.Validator
+	v.Required("customer_id", req.CustomerID)
+	v.MaxLen("customer_id", req.CustomerID, 64)
+	v.Check(len(req.Items) > 0, "items", "must contain at least one item")
+	v.Check(len(req.Items) <= limits.MaxItems, "items", "must contain at most %d items", limits.MaxItems)
+	validateLines(&v, len(req.Items), func(i int) (string, int) { return req.Items[i].ProductID, req.Items[i].Quantity }, 1, limits.MaxQuantity)
+	if req.ShipTo != nil {
+		v.Check(req.ShipTo.Latitude >= -90 && req.ShipTo.Latitude <= 90, "ship_to.latitude", "must be between -90 and 90")
+		v.Check(req.ShipTo.Longitude >= -180 && req.ShipTo.Longitude <= 180, "ship_to.longitude", "must be between -180 and 180")
+	}
+	v.Check(len(req.CouponCodes) <= maxCouponCodes, "coupon_codes", "must contain at most %d codes", maxCouponCodes)
+	for i, code := range req.CouponCodes {
+		field := fmt.Sprintf("coupon_codes[%d]", i)
+		v.Required(field, code)
+		v.MaxLen(field, code, 64)
+	}
+	if req.Region != "" {
+		v.Check(regionCode.MatchString(req.Region), "region", "must be an ISO 3166 country or subdivision code like DE or US-CA")
+	}
+	return v.Err()
+}
+
+// Order converts the request into the order passed to the service
+func (req CreateOrderRequest) Order() models.Order {
+	order := models.Order{CustomerID: req.CustomerID, ShipTo: req.ShipTo, CouponCodes: req.CouponCodes, Region: strings.ToUpper(req.Region), Items: make([]models.LineItem, len(req.Items))}
+	for i, item := range req.Items {
+		order.Items[i] = models.LineItem{ProductID: item.ProductID, Quantity: item.Quantity}
+	}
+	return order
+}
+
+// validateAmendment applies the order limits to a PATCH /v1/orders/{id} body, quantity 0 removes a line
+func validateAmendment(amendment service.OrderAmendment, limits OrderLimits) error {
+	var v validation.Validator
+	v.Check(len(amendment.Items) > 0, "items", "must contain at least one item")
+	v.Check(len(amendment.Items) <= limits.MaxItems, "items", "must contain at most %d items", limits.MaxItems)
+	validateLines(&v, len(amendment.Items), func(i int) (string, int) { return amendment.Items[i].ProductID, amendment.Items[i].Quantity }, 0, limits.MaxQuantity)
+	return v.Err()
+}
+
+// validateLines checks every line has a product, a quantity within bounds and no product is listed twice
+func validateLines(v *validation.Validator, n int, line func(int) (string, int), minQuantity int, maxQuantity int) {
+	seen := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		productID, quantity := line(i)
+		field := fmt.Sprintf("items[%d]", i)
+		v.Required(field+".product_id", productID)
+		v.Between(field+".quantity", quantity, minQuantity, maxQuantity)
+		if first, dup := seen[productID]; dup {
+			v.Check(false, field+".product_id", "duplicates items[%d]", first)
+		} else if productID != "" {
+			seen[productID] = i
+		}
+	}
+}
+
+// decodeJSON reads a size-limited request body that must not contain unknown fields. It writes the
+// problem response itself and reports whether the handler can continue.
+func (h *OrderHandler) decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.limits.MaxBodyBytes))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err == nil && dec.More() {
+		err = errors.New("unexpected data after the JSON document")
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+			return false
+		}
+		writeProblem(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeValidationError sends the rejected fields of a request
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	var fieldErrs validation.Errors
+	if !errors.As(err, &fieldErrs) {
+		writeError(w, r, err, nil)
+		return
+	}
+	p := problem.New(r, http.StatusBadRequest, "validation_failed", "request contains invalid fields")
+	p.Errors = fieldErrs
+	problem.WriteDetails(w, p)
+}
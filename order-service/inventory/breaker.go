@@ -0,0 +1,110 @@
+package inventory
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails calls fast until the cooldown has passed
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe through to decide whether to close again
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker opens after failureThreshold consecutive failures and probes again after cooldown
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	failureThreshold int
+	cooldown         time.Duration
+	state            BreakerState
+	failures         int
+	openedAt         time.Time
+	probing          bool
+	onStateChange    func(BreakerState)
+}
+
+func NewCircuitBreaker(failureThreshold int, cooldown time.Duration, onStateChange func(BreakerState)) *CircuitBreaker {
+	if onStateChange == nil {
+		onStateChange = func(BreakerState) {}
+	}
+	return &CircuitBreaker{failureThreshold: failureThreshold, cooldown: cooldown, onStateChange: onStateChange}
+}
+
+// Allow reports whether a call may go through, ErrCircuitOpen when it must fail fast
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Success records a call that got an answer from inventory-service
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	b.setState(BreakerClosed)
+}
+
+// Failure records a call that did not get an answer, a failed probe opens the breaker again
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || b.failures >= b.failureThreshold {
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// State returns the current state of the breaker
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *CircuitBreaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	b.onStateChange(state)
+}
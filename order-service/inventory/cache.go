@@ -0,0 +1,181 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultCacheTTL is how long product metadata is cached when PRODUCT_CACHE_TTL is not set
+const DefaultCacheTTL = 5 * time.Minute
+
+// sharedKeyPrefix namespaces the products in the shared Redis tier
+const sharedKeyPrefix = "product-cache:"
+
+// ProductCache keeps product metadata (name, price, currency...) in process for a TTL, optionally backed by
+// a Redis tier shared by all order-service replicas. The stock of a cached product is stale by design.
+type ProductCache struct {
+	ttl    time.Duration
+	shared *redis.Client
+
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	product models.Product
+	expires time.Time
+}
+
+// NewProductCache returns a cache keeping products for ttl, shared is the optional Redis tier
+func NewProductCache(ttl time.Duration, shared *redis.Client) *ProductCache {
+	return &ProductCache{ttl: ttl, shared: shared, entries: map[string]cacheEntry{}}
+}
+
+// CacheTTLFromEnv reads PRODUCT_CACHE_TTL, 0 disables the cache
+func CacheTTLFromEnv() time.Duration {
+	v := os.Getenv("PRODUCT_CACHE_TTL")
+	if v == "" {
+		return DefaultCacheTTL
+	}
+	ttl, err := time.ParseDuration(v)
+	if err != nil || ttl < 0 {
+		log.Fatalf("invalid PRODUCT_CACHE_TTL: %s", v)
+	}
+	return ttl
+}
+
+// cacheKey keys products by tenant, the default tenant keeps the plain product ids
+func cacheKey(ctx context.Context, productID string) string {
+	if id := tenant.FromContext(ctx).ID; id != tenant.Default {
+		return id + "/" + productID
+	}
+	return productID
+}
+
+// Get returns the product of the tenant of ctx, looking in the shared tier when it is not cached locally
+func (c *ProductCache) Get(ctx context.Context, productID string) (*models.Product, bool) {
+	key := cacheKey(ctx, productID)
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		metrics.Add("cache_hits", 1)
+		return &entry.product, true
+	}
+
+	if c.shared != nil {
+		data, err := c.shared.Get(ctx, sharedKeyPrefix+key).Bytes()
+		switch {
+		case err == nil:
+			var product models.Product
+			if err := json.Unmarshal(data, &product); err == nil {
+				c.setLocal(key, product)
+				metrics.Add("cache_hits", 1)
+				return &product, true
+			}
+		case !errors.Is(err, redis.Nil):
+			log.Printf("product cache: shared tier read failed: %v", err)
+		}
+	}
+
+	metrics.Add("cache_misses", 1)
+	return nil, false
+}
+
+// Set caches the product of the tenant of ctx locally and in the shared tier
+func (c *ProductCache) Set(ctx context.Context, product models.Product) {
+	key := cacheKey(ctx, product.ID)
+	c.setLocal(key, product)
+	if c.shared == nil {
+		return
+	}
+
+	data, err := json.Marshal(product)
+	if err != nil {
+		return
+	}
+	if err := c.shared.Set(ctx, sharedKeyPrefix+key, data, c.ttl).Err(); err != nil {
+		log.Printf("product cache: shared tier write failed: %v", err)
+	}
+}
+
+func (c *ProductCache) setLocal(key string, product models.Product) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Expired entries are dropped on write so products no longer ordered do not pile up
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{product: product, expires: now.Add(c.ttl)}
+}
+
+// Invalidate drops the product of the tenant of ctx from both tiers
+func (c *ProductCache) Invalidate(ctx context.Context, productID string) {
+	key := cacheKey(ctx, productID)
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+	metrics.Add("cache_invalidations", 1)
+
+	if c.shared != nil {
+		if err := c.shared.Del(ctx, sharedKeyPrefix+key).Err(); err != nil {
+			log.Printf("product cache: shared tier delete failed: %v", err)
+		}
+	}
+}
+
+// cachingClient serves product metadata from the cache, stock reads and restocks always go to inventory-service
+type cachingClient struct {
+	next  Client
+	cache *ProductCache
+}
+
+func NewCachingClient(next Client, cache *ProductCache) Client {
+	return &cachingClient{next: next, cache: cache}
+}
+
+func (c *cachingClient) GetProduct(ctx context.Context, productID string) (*models.Product, error) {
+	if product, ok := c.cache.Get(ctx, productID); ok {
+		return product, nil
+	}
+
+	product, err := c.next.GetProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.Set(ctx, *product)
+	return product, nil
+}
+
+func (c *cachingClient) GetStock(ctx context.Context, productIDs []string) (map[string]models.StockLevel, error) {
+	return c.next.GetStock(ctx, productIDs)
+}
+
+func (c *cachingClient) Restock(ctx context.Context, productID string, warehouseID string, quantity int, reason string, orderID string) error {
+	return c.next.Restock(ctx, productID, warehouseID, quantity, reason, orderID)
+}
+
+func (c *cachingClient) Reserve(ctx context.Context, orderID string, lines []Line) error {
+	return c.next.Reserve(ctx, orderID, lines)
+}
+
+func (c *cachingClient) Release(ctx context.Context, orderID string, lines []Line, reason string) error {
+	return c.next.Release(ctx, orderID, lines, reason)
+}
+
+func (c *cachingClient) Commit(ctx context.Context, orderID string, lines []Line) error {
+	return c.next.Commit(ctx, orderID, lines)
+}
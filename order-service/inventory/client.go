@@ -0,0 +1,44 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+)
+
+var (
+	// ErrProductNotFound is returned when inventory-service does not know the product
+	ErrProductNotFound = errors.New("product not found")
+	// ErrUnavailable is returned when inventory-service could not be reached or failed to answer
+	ErrUnavailable = errors.New("inventory-service unavailable")
+	// ErrCircuitOpen is returned without calling inventory-service while the circuit breaker is open
+	ErrCircuitOpen = errors.New("inventory-service circuit breaker is open")
+	// ErrInsufficientStock is returned when a line of a reservation is not in stock
+	ErrInsufficientStock = errors.New("insufficient stock")
+)
+
+// Line is a quantity of a product moved for an order, at a warehouse when WarehouseID is set
+type Line struct {
+	ProductID   string
+	WarehouseID string
+	Quantity    int
+}
+
+// Client is how the order service reads products from and returns stock to inventory-service
+type Client interface {
+	// GetProduct returns the product, a cached copy may be served so its stock is not authoritative
+	GetProduct(ctx context.Context, productID string) (*models.Product, error)
+	// GetStock reads the current stock of the products, in total and per warehouse, in a single call.
+	// Unknown products are left out.
+	GetStock(ctx context.Context, productIDs []string) (map[string]models.StockLevel, error)
+	// Restock puts units of the order back into the stock of a warehouse, the unassigned stock when
+	// warehouseID is empty
+	Restock(ctx context.Context, productID string, warehouseID string, quantity int, reason string, orderID string) error
+	// Reserve takes the lines of the order out of stock, all or nothing
+	Reserve(ctx context.Context, orderID string, lines []Line) error
+	// Release puts units reserved for the order back into stock
+	Release(ctx context.Context, orderID string, lines []Line, reason string) error
+	// Commit records that units reserved for the order left with a shipment, the stock does not change
+	Commit(ctx context.Context, orderID string, lines []Line) error
+}
@@ -0,0 +1,55 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+// EventProductUpdated is published by inventory-service whenever a product changes
+const EventProductUpdated = "product.updated"
+
+// WatchProductEvents drops products from the cache as inventory-service announces changes on the stream.
+// Every replica reads the whole stream rather than sharing a consumer group, so each local cache sees every
+// event. Only events published after the watch started are read, it returns once ctx is done.
+func WatchProductEvents(ctx context.Context, rdb *redis.Client, streamKey string, cache *ProductCache) {
+	lastID := "$"
+	for ctx.Err() == nil {
+		streams, err := rdb.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{streamKey, lastID},
+			Count:   100,
+			Block:   5 * time.Second,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+				continue
+			}
+			log.Printf("product events: read failed: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				lastID = msg.ID
+				if msg.Values["event"] != EventProductUpdated {
+					continue
+				}
+				productID, ok := msg.Values["product_id"].(string)
+				if !ok {
+					continue
+				}
+				// Events published before tenants existed belong to the default tenant
+				tenantID, _ := msg.Values["tenant_id"].(string)
+				cache.Invalidate(tenant.NewContext(ctx, tenant.Tenant{ID: tenantID}), productID)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	inventoryv1 "github.com/dinesh-man/ecommerce-order-processing-system/pkg/pb/inventory/v1"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcClient talks to the inventory gRPC API
+type grpcClient struct {
+	client inventoryv1.InventoryServiceClient
+}
+
+func NewGRPCClient(conn grpc.ClientConnInterface) Client {
+	return &grpcClient{client: inventoryv1.NewInventoryServiceClient(conn)}
+}
+
+func (c *grpcClient) GetProduct(ctx context.Context, productID string) (*models.Product, error) {
+	resp, err := c.client.GetProduct(tenant.OutgoingContext(ctx), &inventoryv1.GetProductRequest{Id: productID})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+
+	p := resp.GetProduct()
+	product := &models.Product{
+		ID:          p.GetId(),
+		Name:        p.GetName(),
+		Description: p.GetDescription(),
+		Price:       p.GetPrice(),
+		Currency:    p.GetCurrency(),
+		Stock:       int(p.GetStock()),
+		Category:    p.GetCategory(),
+		Brand:       p.GetBrand(),
+		Rating:      p.GetRating(),
+		Version:     p.GetVersion(),
+	}
+	if backorder := p.GetBackorder(); backorder != nil {
+		product.Backorder = &models.BackorderPolicy{Mode: models.BackorderMode(backorder.GetMode())}
+		if backorder.GetAvailableAt() != nil {
+			availableAt := backorder.GetAvailableAt().AsTime()
+			product.Backorder.AvailableAt = &availableAt
+		}
+	}
+	return product, nil
+}
+
+func (c *grpcClient) GetStock(ctx context.Context, productIDs []string) (map[string]models.StockLevel, error) {
+	resp, err := c.client.BatchGetProducts(tenant.OutgoingContext(ctx), &inventoryv1.BatchGetProductsRequest{Ids: productIDs})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+
+	stock := make(map[string]models.StockLevel, len(resp.GetProducts()))
+	for _, p := range resp.GetProducts() {
+		level := models.StockLevel{Stock: int(p.GetStock())}
+		for _, held := range p.GetWarehouses() {
+			level.Warehouses = append(level.Warehouses, models.WarehouseStock{WarehouseID: held.GetWarehouseId(), Stock: int(held.GetStock())})
+		}
+		stock[p.GetId()] = level
+	}
+	return stock, nil
+}
+
+func (c *grpcClient) Restock(ctx context.Context, productID string, warehouseID string, quantity int, reason string, orderID string) error {
+	_, err := c.client.ReleaseStock(tenant.OutgoingContext(ctx), &inventoryv1.ReleaseStockRequest{
+		Lines:  []*inventoryv1.StockLine{{ProductId: productID, WarehouseId: warehouseID, Quantity: int64(quantity), OrderId: orderID}},
+		Reason: reason,
+	})
+	if err != nil {
+		return fromStatus(err)
+	}
+	return nil
+}
+
+func (c *grpcClient) Reserve(ctx context.Context, orderID string, lines []Line) error {
+	_, err := c.client.ReserveStock(tenant.OutgoingContext(ctx), &inventoryv1.ReserveStockRequest{Lines: toStockLines(orderID, lines)})
+	if err != nil {
+		return fromStatus(err)
+	}
+	return nil
+}
+
+func (c *grpcClient) Release(ctx context.Context, orderID string, lines []Line, reason string) error {
+	_, err := c.client.ReleaseStock(tenant.OutgoingContext(ctx), &inventoryv1.ReleaseStockRequest{Lines: toStockLines(orderID, lines), Reason: reason})
+	if err != nil {
+		return fromStatus(err)
+	}
+	return nil
+}
+
+func (c *grpcClient) Commit(ctx context.Context, orderID string, lines []Line) error {
+	_, err := c.client.CommitStock(tenant.OutgoingContext(ctx), &inventoryv1.CommitStockRequest{Lines: toStockLines(orderID, lines)})
+	if err != nil {
+		return fromStatus(err)
+	}
+	return nil
+}
+
+func toStockLines(orderID string, lines []Line) []*inventoryv1.StockLine {
+	out := make([]*inventoryv1.StockLine, len(lines))
+	for i, line := range lines {
+		out[i] = &inventoryv1.StockLine{ProductId: line.ProductID, WarehouseId: line.WarehouseID, Quantity: int64(line.Quantity), OrderId: orderID}
+	}
+	return out
+}
+
+func fromStatus(err error) error {
+	switch status.Code(err) {
+	case codes.NotFound, codes.InvalidArgument:
+		return ErrProductNotFound
+	case codes.FailedPrecondition:
+		return ErrInsufficientStock
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown, codes.ResourceExhausted:
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	default:
+		return err
+	}
+}
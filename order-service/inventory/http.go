@@ -0,0 +1,200 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+)
+
+// DefaultTimeout bounds a single request to inventory-service, retries included separately
+const DefaultTimeout = 2 * time.Second
+
+// httpClient talks to the inventory REST API
+type httpClient struct {
+	baseURL    string
+	serviceKey string
+	client     *http.Client
+}
+
+// NewHTTPClient returns a REST client whose requests give up after timeout (DefaultTimeout when zero).
+// Requests carry serviceKey to authenticate order-service unless it is empty.
+func NewHTTPClient(baseURL string, timeout time.Duration, serviceKey string) Client {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &httpClient{
+		baseURL:    baseURL,
+		serviceKey: serviceKey,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext,
+				MaxIdleConns:          100,
+				MaxIdleConnsPerHost:   20,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   timeout,
+				ResponseHeaderTimeout: timeout,
+			},
+		},
+	}
+}
+
+func (c *httpClient) GetProduct(ctx context.Context, productID string) (*models.Product, error) {
+	productURL := fmt.Sprintf("%s/v1/products/%s", c.baseURL, url.PathEscape(productID))
+	log.Println("fetching product details from inventory: ", productURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, productURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest:
+		return nil, ErrProductNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%w: status %d", ErrUnavailable, resp.StatusCode)
+	}
+
+	var product models.Product
+	if err := json.NewDecoder(resp.Body).Decode(&product); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode product JSON: %v", ErrUnavailable, err)
+	}
+	return &product, nil
+}
+
+func (c *httpClient) GetStock(ctx context.Context, productIDs []string) (map[string]models.StockLevel, error) {
+	stockURL := fmt.Sprintf("%s/v1/products?ids=%s", c.baseURL, url.QueryEscape(strings.Join(productIDs, ",")))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, stockURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrUnavailable, resp.StatusCode)
+	}
+
+	var products []models.Product
+	if err := json.NewDecoder(resp.Body).Decode(&products); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode products JSON: %v", ErrUnavailable, err)
+	}
+	stock := make(map[string]models.StockLevel, len(products))
+	for _, product := range products {
+		stock[product.ID] = models.StockLevel{Stock: product.Stock, Warehouses: product.Warehouses}
+	}
+	return stock, nil
+}
+
+func (c *httpClient) Restock(ctx context.Context, productID string, warehouseID string, quantity int, reason string, orderID string) error {
+	restock := map[string]interface{}{"quantity": quantity, "reason": reason}
+	if warehouseID != "" {
+		restock["warehouse_id"] = warehouseID
+	}
+	if orderID != "" {
+		restock["order_id"] = orderID
+	}
+	body, err := json.Marshal(restock)
+	if err != nil {
+		return err
+	}
+
+	restockURL := fmt.Sprintf("%s/v1/products/%s/restock", c.baseURL, url.PathEscape(productID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, restockURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrProductNotFound
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("%w: status %d", ErrUnavailable, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("inventory-service responded with %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *httpClient) Reserve(ctx context.Context, orderID string, lines []Line) error {
+	return c.moveStock(ctx, "reserve", orderID, lines, "")
+}
+
+func (c *httpClient) Release(ctx context.Context, orderID string, lines []Line, reason string) error {
+	return c.moveStock(ctx, "release", orderID, lines, reason)
+}
+
+func (c *httpClient) Commit(ctx context.Context, orderID string, lines []Line) error {
+	return c.moveStock(ctx, "commit", orderID, lines, "")
+}
+
+// moveStock posts the lines of the order to the /v1/stock endpoint of the movement
+func (c *httpClient) moveStock(ctx context.Context, movement string, orderID string, lines []Line, reason string) error {
+	stockLines := make([]map[string]interface{}, len(lines))
+	for i, line := range lines {
+		stockLines[i] = map[string]interface{}{"product_id": line.ProductID, "quantity": line.Quantity}
+		if line.WarehouseID != "" {
+			stockLines[i]["warehouse_id"] = line.WarehouseID
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{"order_id": orderID, "reason": reason, "lines": stockLines})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/stock/"+movement, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrProductNotFound
+	case resp.StatusCode == http.StatusConflict:
+		return ErrInsufficientStock
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("%w: status %d", ErrUnavailable, resp.StatusCode)
+	case resp.StatusCode >= http.StatusMultipleChoices:
+		return fmt.Errorf("inventory-service responded with %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *httpClient) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set(tenant.Header, tenant.FromContext(req.Context()).ID)
+	if c.serviceKey != "" {
+		req.Header.Set(auth.ServiceKeyHeader, c.serviceKey)
+	}
+	return c.client.Do(req)
+}
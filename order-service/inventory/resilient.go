@@ -0,0 +1,207 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+)
+
+// metrics are published on /debug/vars under "inventory_client"
+var (
+	metrics      = expvar.NewMap("inventory_client")
+	breakerState = new(expvar.String)
+)
+
+func init() {
+	breakerState.Set(BreakerClosed.String())
+	metrics.Set("breaker_state", breakerState)
+}
+
+// Config tunes the resilient inventory client
+type Config struct {
+	// Timeout bounds a single attempt
+	Timeout time.Duration
+	// MaxRetries is the number of extra attempts of idempotent reads
+	MaxRetries int
+	// BaseBackoff is doubled on every retry up to MaxBackoff, the actual wait is jittered
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// FailureThreshold consecutive failures open the breaker for Cooldown
+	FailureThreshold int
+	Cooldown         time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Timeout:          DefaultTimeout,
+		MaxRetries:       2,
+		BaseBackoff:      100 * time.Millisecond,
+		MaxBackoff:       time.Second,
+		FailureThreshold: 5,
+		Cooldown:         30 * time.Second,
+	}
+}
+
+// ConfigFromEnv reads INVENTORY_TIMEOUT, INVENTORY_MAX_RETRIES, INVENTORY_BREAKER_FAILURES and INVENTORY_BREAKER_COOLDOWN
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if v := os.Getenv("INVENTORY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid INVENTORY_TIMEOUT: %v", err)
+		}
+		cfg.Timeout = d
+	}
+	if v := os.Getenv("INVENTORY_MAX_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("invalid INVENTORY_MAX_RETRIES: %s", v)
+		}
+		cfg.MaxRetries = n
+	}
+	if v := os.Getenv("INVENTORY_BREAKER_FAILURES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid INVENTORY_BREAKER_FAILURES: %s", v)
+		}
+		cfg.FailureThreshold = n
+	}
+	if v := os.Getenv("INVENTORY_BREAKER_COOLDOWN"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid INVENTORY_BREAKER_COOLDOWN: %v", err)
+		}
+		cfg.Cooldown = d
+	}
+	return cfg
+}
+
+// resilientClient retries idempotent reads with jittered exponential backoff and guards every call with a
+// circuit breaker. Only ErrUnavailable counts as a failure, a product that does not exist is an answer.
+type resilientClient struct {
+	next    Client
+	cfg     Config
+	breaker *CircuitBreaker
+}
+
+func NewResilientClient(next Client, cfg Config) Client {
+	return &resilientClient{
+		next: next,
+		cfg:  cfg,
+		breaker: NewCircuitBreaker(cfg.FailureThreshold, cfg.Cooldown, func(state BreakerState) {
+			log.Printf("Inventory circuit breaker is now %s", state)
+			breakerState.Set(state.String())
+			if state == BreakerOpen {
+				metrics.Add("breaker_opened_total", 1)
+			}
+		}),
+	}
+}
+
+func (c *resilientClient) GetProduct(ctx context.Context, productID string) (*models.Product, error) {
+	var product *models.Product
+	err := c.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		product, err = c.next.GetProduct(ctx, productID)
+		return err
+	})
+	return product, err
+}
+
+func (c *resilientClient) GetStock(ctx context.Context, productIDs []string) (map[string]models.StockLevel, error) {
+	var stock map[string]models.StockLevel
+	err := c.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		stock, err = c.next.GetStock(ctx, productIDs)
+		return err
+	})
+	return stock, err
+}
+
+// Restock is not idempotent, a timed out request may have been applied, so it is never retried
+func (c *resilientClient) Restock(ctx context.Context, productID string, warehouseID string, quantity int, reason string, orderID string) error {
+	return c.call(ctx, false, func(ctx context.Context) error {
+		return c.next.Restock(ctx, productID, warehouseID, quantity, reason, orderID)
+	})
+}
+
+// Stock movements are not idempotent either and are never retried
+func (c *resilientClient) Reserve(ctx context.Context, orderID string, lines []Line) error {
+	return c.call(ctx, false, func(ctx context.Context) error {
+		return c.next.Reserve(ctx, orderID, lines)
+	})
+}
+
+func (c *resilientClient) Release(ctx context.Context, orderID string, lines []Line, reason string) error {
+	return c.call(ctx, false, func(ctx context.Context) error {
+		return c.next.Release(ctx, orderID, lines, reason)
+	})
+}
+
+func (c *resilientClient) Commit(ctx context.Context, orderID string, lines []Line) error {
+	return c.call(ctx, false, func(ctx context.Context) error {
+		return c.next.Commit(ctx, orderID, lines)
+	})
+}
+
+func (c *resilientClient) call(ctx context.Context, idempotent bool, fn func(context.Context) error) error {
+	attempts := 1
+	if idempotent {
+		attempts += c.cfg.MaxRetries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			metrics.Add("retries_total", 1)
+			select {
+			case <-time.After(c.backoff(attempt)):
+			case <-ctx.Done():
+				return err
+			}
+		}
+
+		if allowErr := c.breaker.Allow(); allowErr != nil {
+			metrics.Add("rejected_total", 1)
+			return allowErr
+		}
+
+		metrics.Add("requests_total", 1)
+		err = c.attempt(ctx, fn)
+		if !errors.Is(err, ErrUnavailable) {
+			c.breaker.Success()
+			return err
+		}
+		metrics.Add("failures_total", 1)
+		c.breaker.Failure()
+	}
+	return err
+}
+
+func (c *resilientClient) attempt(ctx context.Context, fn func(context.Context) error) error {
+	if c.cfg.Timeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// backoff doubles the base delay per attempt and picks a random wait in its upper half
+func (c *resilientClient) backoff(attempt int) time.Duration {
+	d := c.cfg.BaseBackoff << (attempt - 1)
+	if d > c.cfg.MaxBackoff || d <= 0 {
+		d = c.cfg.MaxBackoff
+	}
+	if d < 2 {
+		return d
+	}
+	return d/2 + rand.N(d/2)
+}
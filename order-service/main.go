@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,9 +12,23 @@ import (
 	"time"
 
 	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/rpc"
 	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/health"
 	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mongodb"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mtls"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	orderv1 "github.com/dinesh-man/ecommerce-order-processing-system/pkg/pb/order/v1"
 	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/redis-stream"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tax"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/warehouse"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
@@ -23,48 +38,129 @@ func main() {
 		log.Fatal("Collection name not specified")
 	}
 
-	inventoryServiceURL := os.Getenv("INVENTORY_SERVICE_URL")
-	if inventoryServiceURL == "" {
-		log.Fatal("Inventory-service URL not specified")
+	// Inventory is reached over REST by default, INVENTORY_TRANSPORT=grpc switches to the gRPC API.
+	// Either transport is wrapped with retries of reads and a circuit breaker.
+	// Calls carry SERVICE_API_KEY, the gRPC channel also uses mTLS when SERVICE_TLS_CERT and SERVICE_TLS_CA are set
+	inventoryConfig := inventory.ConfigFromEnv()
+	serviceKey := os.Getenv("SERVICE_API_KEY")
+	var inventoryClient inventory.Client
+	var inventoryConn *grpc.ClientConn
+	switch transport := os.Getenv("INVENTORY_TRANSPORT"); transport {
+	case "", "http":
+		inventoryServiceURL := os.Getenv("INVENTORY_SERVICE_URL")
+		if inventoryServiceURL == "" {
+			log.Fatal("Inventory-service URL not specified")
+		}
+		inventoryClient = inventory.NewHTTPClient(inventoryServiceURL, inventoryConfig.Timeout, serviceKey)
+	case "grpc":
+		inventoryGRPCAddr := os.Getenv("INVENTORY_GRPC_ADDR")
+		if inventoryGRPCAddr == "" {
+			log.Fatal("Inventory-service gRPC address not specified")
+		}
+		transportCreds := insecure.NewCredentials()
+		tlsConfig := mtls.ConfigFromEnv()
+		if tlsConfig.Enabled() {
+			clientTLS, err := mtls.ClientConfig(tlsConfig.CertPath, tlsConfig.CAPath)
+			if err != nil {
+				log.Fatalf("Failed to configure inventory gRPC mTLS: %v", err)
+			}
+			transportCreds = credentials.NewTLS(clientTLS)
+		}
+		dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(transportCreds)}
+		if serviceKey != "" {
+			dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(auth.ServiceKeyCredentials{Key: serviceKey, TLS: tlsConfig.Enabled()}))
+		}
+		conn, err := grpc.NewClient(inventoryGRPCAddr, dialOpts...)
+		if err != nil {
+			log.Fatalf("Failed to create inventory gRPC client: %v", err)
+		}
+		inventoryConn = conn
+		inventoryClient = inventory.NewGRPCClient(conn)
+	default:
+		log.Fatalf("invalid INVENTORY_TRANSPORT: %s", transport)
 	}
 
 	mongodb.InitMongoDB()
 	rdb, sk := redis_stream.InitRedis()
+	inventoryClient = inventory.NewResilientClient(inventoryClient, inventoryConfig)
+
+	// Product metadata is cached for PRODUCT_CACHE_TTL (0 disables it), PRODUCT_CACHE_SHARED=true adds a
+	// Redis tier shared by the replicas. Entries are dropped as soon as inventory-service publishes a change.
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if cacheTTL := inventory.CacheTTLFromEnv(); cacheTTL > 0 {
+		var shared *redis.Client
+		if os.Getenv("PRODUCT_CACHE_SHARED") == "true" {
+			shared = rdb
+		}
+		productCache := inventory.NewProductCache(cacheTTL, shared)
+		inventoryClient = inventory.NewCachingClient(inventoryClient, productCache)
 
-	orderService := service.NewOrderService(collectionName, inventoryServiceURL, rdb, sk)
-	orderHandler := handler.NewOrderHandler(orderService)
-
-	// Create and order or get order by /order?id=123
-	http.HandleFunc("/order", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodPost:
-			orderHandler.CreateOrderHandler(w, r)
-		case http.MethodGet:
-			orderHandler.GetOrderHandler(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		productStreamKey := os.Getenv("PRODUCT_STREAM_KEY")
+		if productStreamKey == "" {
+			productStreamKey = "product-events"
 		}
-	})
+		go inventory.WatchProductEvents(watchCtx, rdb, productStreamKey, productCache)
+	}
+
+	// Promotions and coupons are stored in PROMOTION_COLLECTION_NAME (promotions by default)
+	promotionCollection := os.Getenv("PROMOTION_COLLECTION_NAME")
+	if promotionCollection == "" {
+		promotionCollection = "promotions"
+	}
 
-	// list orders with optional /orders?status=
-	http.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			orderHandler.ListOrdersHandler(w, r)
-			return
+	// Order lines are allocated to a warehouse of WAREHOUSES_FILE with the ALLOCATION_RULE (priority by default),
+	// orders are taxed at the rates of TAX_RATES_FILE when it is set
+	orderService := service.NewOrderService(collectionName, inventoryClient, rdb, sk, payment.NewFakeGatewayFromEnv()).
+		WithAllocator(warehouse.AllocatorFromEnv()).
+		WithPromotions(promotionCollection).
+		WithTax(tax.ProviderFromEnv())
+	if err := orderService.EnsureIndexes(); err != nil {
+		log.Fatalf("Failed to create order indexes: %v", err)
+	}
+	// Order size limits come from ORDER_MAX_ITEMS, ORDER_MAX_QUANTITY and ORDER_MAX_BODY_BYTES
+	orderLimits := handler.OrderLimitsFromEnv()
+	// Callers authenticate with JWTs signed with AUTH_HS256_SECRET or a key of the AUTH_JWKS_FILE
+	verifier := auth.VerifierFromEnv()
+	// Requests act for the tenant of the caller's token or X-Tenant-ID, TENANTS_FILE lists the known tenants
+	// with their currency and order limits
+	tenants := tenant.RegistryFromEnv()
+	// Shared secret carriers must send with tracking events, without it the webhook would be open to anyone
+	carrierWebhookSecret := os.Getenv("CARRIER_WEBHOOK_SECRET")
+	if carrierWebhookSecret == "" {
+		log.Fatal("CARRIER_WEBHOOK_SECRET must be set")
+	}
+	orderHandler := handler.NewOrderHandler(orderService, carrierWebhookSecret, orderLimits, verifier, tenants)
+
+	// Liveness only covers the process, readiness pings MongoDB and Redis. Inventory-service is left out,
+	// its outages are handled by the circuit breaker.
+	probes := health.New(health.DefaultTimeout)
+	probes.AddReadiness("mongodb", mongodb.Ping)
+	probes.AddReadiness("redis", func(ctx context.Context) error { return rdb.Ping(ctx).Err() })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", probes.Live)
+	mux.HandleFunc("GET /readyz", probes.Ready)
+	mux.Handle("/", orderHandler.Routes())
+	server := &http.Server{Addr: ":8080", Handler: mux}
+
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":9090"
+	}
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(auth.UnaryServerInterceptor(verifier), tenant.UnaryServerInterceptor(tenants)))
+	orderv1.RegisterOrderServiceServer(grpcServer, rpc.NewOrderServer(orderService, orderLimits))
+
+	go func() {
+		lis, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			log.Fatalf("gRPC listen error: %v", err)
 		}
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	})
-
-	// Cancel order by /order/cancel?id=
-	http.HandleFunc("/order/cancel", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodDelete {
-			orderHandler.CancelOrderHandler(w, r)
-			return
+		log.Printf("Order gRPC server running on %s", grpcAddr)
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatalf("gRPC server error: %v", err)
 		}
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	})
-
-	server := &http.Server{Addr: ":8080"}
+	}()
 
 	go func() {
 		log.Println("Order service running on :8080")
@@ -80,12 +176,21 @@ func main() {
 	<-stop // Block until signal is received
 	log.Println("Shutdown signal received. Cleaning up...")
 
+	// Keep serving while the pod is taken out of the service endpoints
+	probes.Drain()
+	time.Sleep(health.DrainDelayFromEnv())
+
 	// Gracefully shutdown HTTP server
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
 		log.Printf("HTTP server shutdown error: %v", err)
 	}
+	grpcServer.GracefulStop()
+	stopWatch()
+	if inventoryConn != nil {
+		inventoryConn.Close()
+	}
 
 	// Disconnect MongoDB to release resources acquired for connection pooling
 	mongodb.DisconnectMongo()
@@ -0,0 +1,218 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	orderv1 "github.com/dinesh-man/ecommerce-order-processing-system/pkg/pb/order/v1"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/validation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// OrderServer serves the order gRPC API on top of the order service. Create requests go through the same
+// validation and limits as the HTTP API. Every role may call it, customers are limited to their own orders.
+type OrderServer struct {
+	orderv1.UnimplementedOrderServiceServer
+	service *service.OrderService
+	limits  handler.OrderLimits
+}
+
+func NewOrderServer(s *service.OrderService, limits handler.OrderLimits) *OrderServer {
+	return &OrderServer{service: s, limits: limits}
+}
+
+// scoped returns the service acting for the tenant of the call
+func (s *OrderServer) scoped(ctx context.Context) *service.OrderService {
+	return s.service.ForTenant(tenant.FromContext(ctx))
+}
+
+func (s *OrderServer) CreateOrder(ctx context.Context, req *orderv1.CreateOrderRequest) (*orderv1.CreateOrderResponse, error) {
+	create := handler.CreateOrderRequest{CustomerID: req.GetCustomerId(), CouponCodes: req.GetCouponCodes(), Region: req.GetRegion()}
+	if shipTo := req.GetShipTo(); shipTo != nil {
+		create.ShipTo = &models.Location{Latitude: shipTo.GetLatitude(), Longitude: shipTo.GetLongitude()}
+	}
+	for _, item := range req.GetItems() {
+		create.Items = append(create.Items, handler.OrderItemRequest{ProductID: item.GetProductId(), Quantity: int(item.GetQuantity())})
+	}
+	if customer := auth.CustomerScope(ctx); customer != "" {
+		if create.CustomerID != "" && create.CustomerID != customer {
+			return nil, status.Error(codes.PermissionDenied, "customers can only place orders for themselves")
+		}
+		create.CustomerID = customer
+	}
+	if err := create.Validate(s.limits.ForTenant(tenant.FromContext(ctx))); err != nil {
+		return nil, toStatus(err)
+	}
+
+	order, err := s.scoped(ctx).CreateOrder(create.Order())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &orderv1.CreateOrderResponse{Order: toProto(order)}, nil
+}
+
+func (s *OrderServer) GetOrder(ctx context.Context, req *orderv1.GetOrderRequest) (*orderv1.GetOrderResponse, error) {
+	order, err := s.customerOrder(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &orderv1.GetOrderResponse{Order: toProto(order)}, nil
+}
+
+// customerOrder loads an order, reporting other customers' orders as not found to customers
+func (s *OrderServer) customerOrder(ctx context.Context, id string) (*models.Order, error) {
+	order, err := s.scoped(ctx).GetOrderByID(id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if customer := auth.CustomerScope(ctx); customer != "" && customer != order.CustomerID {
+		return nil, toStatus(service.ErrOrderNotFound)
+	}
+	return order, nil
+}
+
+func (s *OrderServer) ListOrders(ctx context.Context, req *orderv1.ListOrdersRequest) (*orderv1.ListOrdersResponse, error) {
+	opts := service.ListOptions{
+		Filter: service.OrderFilter{
+			Status:     req.GetStatus(),
+			CustomerID: req.GetCustomerId(),
+			ProductID:  req.GetProductId(),
+		},
+		SortBy:     req.GetSort(),
+		Descending: req.GetDescending(),
+		Cursor:     req.GetCursor(),
+		PageSize:   req.GetPageSize(),
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = 10
+	}
+	if customer := auth.CustomerScope(ctx); customer != "" {
+		if opts.Filter.CustomerID != "" && opts.Filter.CustomerID != customer {
+			return nil, status.Error(codes.PermissionDenied, "customers can only list their own orders")
+		}
+		opts.Filter.CustomerID = customer
+	}
+
+	page, err := s.scoped(ctx).ListOrders(opts)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &orderv1.ListOrdersResponse{NextCursor: page.NextCursor, PrevCursor: page.PrevCursor, HasMore: page.HasMore}
+	for i := range page.Orders {
+		resp.Orders = append(resp.Orders, toProto(&page.Orders[i]))
+	}
+	return resp, nil
+}
+
+func (s *OrderServer) CancelOrder(ctx context.Context, req *orderv1.CancelOrderRequest) (*orderv1.CancelOrderResponse, error) {
+	if auth.CustomerScope(ctx) != "" {
+		if _, err := s.customerOrder(ctx, req.GetId()); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.scoped(ctx).CancelOrder(req.GetId(), req.ExpectedVersion); err != nil {
+		return nil, toStatus(err)
+	}
+	return &orderv1.CancelOrderResponse{}, nil
+}
+
+// toStatus maps service and validation errors to gRPC status codes, mirroring the HTTP problem mapping
+func toStatus(err error) error {
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		msgs := make([]string, len(fieldErrs))
+		for i, fe := range fieldErrs {
+			msgs[i] = fe.Field + " " + fe.Message
+		}
+		return status.Error(codes.InvalidArgument, strings.Join(msgs, "; "))
+	}
+
+	var svcErr *service.Error
+	if !errors.As(err, &svcErr) {
+		log.Printf("Order RPC failed: %v", err)
+		return status.Error(codes.Internal, "an unexpected error occurred")
+	}
+	if errors.Is(err, service.ErrVersionConflict) {
+		return status.Error(codes.Aborted, svcErr.Message)
+	}
+
+	switch svcErr.Kind {
+	case service.KindNotFound:
+		return status.Error(codes.NotFound, svcErr.Message)
+	case service.KindInvalidArgument:
+		return status.Error(codes.InvalidArgument, svcErr.Message)
+	case service.KindConflict, service.KindInsufficientStock:
+		return status.Error(codes.FailedPrecondition, svcErr.Message)
+	case service.KindUnavailable:
+		return status.Error(codes.Unavailable, svcErr.Message)
+	default:
+		return status.Error(codes.Internal, svcErr.Message)
+	}
+}
+
+func toProto(order *models.Order) *orderv1.Order {
+	pb := &orderv1.Order{
+		Id:           order.ID.Hex(),
+		CustomerId:   order.CustomerID,
+		Total:        order.Total,
+		Subtotal:     order.Subtotal,
+		CouponCodes:  order.CouponCodes,
+		TaxTotal:     order.TaxTotal,
+		TaxInclusive: order.TaxInclusive,
+		Currency:     order.Currency,
+		Region:       order.Region,
+		Status:       string(order.Status),
+		Version:      order.Version,
+		CreatedAt:    timestamppb.New(order.CreatedAt),
+		UpdatedAt:    timestamppb.New(order.UpdatedAt),
+	}
+	if order.Payment != nil {
+		pb.PaymentStatus = string(order.Payment.Status)
+	}
+	if order.ShipTo != nil {
+		pb.ShipTo = &orderv1.Location{Latitude: order.ShipTo.Latitude, Longitude: order.ShipTo.Longitude}
+	}
+	for _, item := range order.Items {
+		line := &orderv1.LineItem{ProductId: item.ProductID, Quantity: int64(item.Quantity), Price: item.Price, WarehouseId: item.WarehouseID}
+		if item.Backorder != nil {
+			line.Backorder = &orderv1.Backorder{Mode: string(item.Backorder.Mode), AvailableAt: timestampOf(item.Backorder.AvailableAt), ReleasedAt: timestampOf(item.Backorder.ReleasedAt)}
+		}
+		pb.Items = append(pb.Items, line)
+	}
+	for _, group := range order.Fulfilments {
+		fulfilment := &orderv1.FulfilmentGroup{Id: group.ID, WarehouseId: group.WarehouseID, Status: string(group.Status), UpdatedAt: timestamppb.New(group.UpdatedAt)}
+		for _, item := range group.Items {
+			fulfilment.Items = append(fulfilment.Items, &orderv1.OrderItem{ProductId: item.ProductID, Quantity: int64(item.Quantity)})
+		}
+		pb.Fulfilments = append(pb.Fulfilments, fulfilment)
+	}
+	for _, d := range order.Discounts {
+		pb.Discounts = append(pb.Discounts, &orderv1.DiscountLine{PromotionId: d.PromotionID, Code: d.Code, Description: d.Description, ProductId: d.ProductID, Amount: d.Amount})
+	}
+	for _, t := range order.Taxes {
+		pb.Taxes = append(pb.Taxes, &orderv1.TaxLine{ProductId: t.ProductID, Name: t.Name, Region: t.Region, Rate: t.Rate, Taxable: t.Taxable, Amount: t.Amount})
+	}
+	for _, change := range order.History {
+		pb.StatusHistory = append(pb.StatusHistory, &orderv1.StatusChange{Status: string(change.Status), Reason: change.Reason, ChangedAt: timestamppb.New(change.ChangedAt)})
+	}
+	return pb
+}
+
+// timestampOf converts an optional time, nil stays unset
+func timestampOf(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/warehouse"
+)
+
+// WithAllocator returns the service allocating order lines to warehouses with a
+func (s *OrderService) WithAllocator(a *warehouse.Allocator) *OrderService {
+	scoped := *s
+	scoped.allocator = a
+	return &scoped
+}
+
+// allocate picks the warehouse fulfilling an order line. Lines of products without warehouses, or whose
+// unassigned stock covers them, are left without one.
+func (s *OrderService) allocate(shipTo *models.Location, item models.LineItem, level models.StockLevel) (string, error) {
+	if warehouseID, ok := s.allocator.AllocateLevel(shipTo, item.Quantity, level); ok {
+		return warehouseID, nil
+	}
+	return "", insufficientStock("no warehouse holds %d units of product %s", item.Quantity, item.ProductID)
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OrderAmendment sets the quantity of line items of a PENDING order. A product not yet in the order is
+// added, a quantity of 0 removes the line. Version must be the version of the order the change is based on,
+// unless it is given through If-Match.
+type OrderAmendment struct {
+	Version int64             `json:"version"`
+	Items   []models.LineItem `json:"items"`
+}
+
+// AmendOrder applies an amendment to a PENDING order, revalidating stock for the changed lines
+func (s *OrderService) AmendOrder(id string, amendment OrderAmendment, ifMatch *int64) (*models.Order, error) {
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+
+	if len(amendment.Items) == 0 {
+		return nil, invalidArgument("invalid_items", "amendment must change at least one item")
+	}
+
+	expectedVersion := amendment.Version
+	if ifMatch != nil {
+		expectedVersion = *ifMatch
+	}
+
+	order, err := s.findOrder(ctx, id, &expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != models.Pending {
+		return nil, conflict("invalid_order_state", "order in %s status cannot be amended", order.Status)
+	}
+
+	var changed []string
+	for _, change := range amendment.Items {
+		if change.Quantity < 0 {
+			return nil, invalidArgument("invalid_items", "invalid quantity for product %s", change.ProductID)
+		}
+		if change.Quantity > 0 {
+			changed = append(changed, change.ProductID)
+		}
+	}
+
+	var stock map[string]models.StockLevel
+	if len(changed) > 0 {
+		if stock, err = s.fetchStock(changed); err != nil {
+			return nil, err
+		}
+	}
+
+	items := make([]models.LineItem, len(order.Items))
+	copy(items, order.Items)
+
+	for _, change := range amendment.Items {
+
+		idx := -1
+		for i := range items {
+			if items[i].ProductID == change.ProductID {
+				idx = i
+				break
+			}
+		}
+
+		if change.Quantity == 0 {
+			if idx < 0 {
+				return nil, invalidArgument("invalid_items", "product %s is not part of the order", change.ProductID)
+			}
+			items = append(items[:idx], items[idx+1:]...)
+			continue
+		}
+
+		product, err := s.fetchProduct(change.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		level, ok := stock[change.ProductID]
+		if !ok {
+			return nil, invalidArgument("product_not_found", "product %s does not exist", change.ProductID)
+		}
+		// The units the order already reserved are no longer in the stock, but remain available to it
+		if idx >= 0 {
+			level = withHeld(level, order.Items[idx])
+		}
+		if level.Stock < change.Quantity {
+			return nil, insufficientStock("insufficient stock for product %s. Available Stock: %d, Order Quantity: %d", change.ProductID, level.Stock, change.Quantity)
+		}
+		// Changed lines are allocated again, the warehouse may no longer hold the new quantity
+		warehouseID, err := s.allocate(order.ShipTo, models.LineItem{ProductID: change.ProductID, Quantity: change.Quantity}, level)
+		if err != nil {
+			return nil, err
+		}
+
+		// Existing lines keep the price captured when they were ordered, new lines use the current price
+		if idx < 0 {
+			if order.Currency != "" && product.Currency != "" && product.Currency != order.Currency {
+				return nil, invalidArgument("currency_mismatch", "product %s is priced in %s, order currency is %s", change.ProductID, product.Currency, order.Currency)
+			}
+			items = append(items, models.LineItem{ProductID: change.ProductID, Quantity: change.Quantity, Price: product.Price, WarehouseID: warehouseID})
+		} else {
+			items[idx].Quantity = change.Quantity
+			items[idx].WarehouseID = warehouseID
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, invalidArgument("invalid_items", "order must contain at least one item, cancel the order instead")
+	}
+
+	// Discounts and taxes are worked out again for the new lines, the coupons and region of the order still apply
+	priced := models.Order{Items: items, CouponCodes: order.CouponCodes, Region: order.Region}
+	for _, item := range items {
+		priced.Subtotal += item.Price * float64(item.Quantity)
+	}
+	priced.Total = priced.Subtotal
+	redeemed := redeemedBy(order)
+	if s.promotionCollection != "" || s.tax != nil {
+		products := make(map[string]*models.Product, len(items))
+		for _, item := range items {
+			if products[item.ProductID], err = s.fetchProduct(item.ProductID); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.applyPromotions(ctx, &priced, products, redeemed); err != nil {
+			return nil, err
+		}
+		if err := s.applyTax(ctx, &priced, products); err != nil {
+			return nil, err
+		}
+	}
+	// Only the difference to the stock the order already holds is reserved, units it no longer needs are
+	// released once the amendment is saved
+	reserve, release := changedLines(order.Items, items)
+	if err := s.reserveStock(ctx, order, reserve, reservedLines(order.Items)); err != nil {
+		return nil, err
+	}
+	counted, err := s.redeem(ctx, priced.Discounts, redeemed)
+	if err != nil {
+		s.releaseStock(order, reserve, "amendment not saved")
+		return nil, err
+	}
+
+	var amended models.Order
+	err = GetCollection(s.collectionName).FindOneAndUpdate(
+		ctx,
+		s.filter(bson.M{"_id": order.ID, "status": models.Pending, "version": mongodb.VersionFilter(order.Version)}),
+		bson.M{
+			"$set": bson.M{
+				"items":         items,
+				"subtotal":      priced.Subtotal,
+				"discounts":     priced.Discounts,
+				"taxes":         priced.Taxes,
+				"tax_total":     priced.TaxTotal,
+				"tax_inclusive": priced.TaxInclusive,
+				"total":         priced.Total,
+				"fulfilments":   models.FulfilmentGroups(items, order.Fulfilments, time.Now()),
+				"updated_at":    time.Now(),
+			},
+			"$inc": bson.M{"version": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&amended)
+	if err != nil {
+		s.unredeem(ctx, counted)
+		s.releaseStock(order, reserve, "amendment not saved")
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrVersionConflict
+		}
+		return nil, err
+	}
+
+	s.releaseStock(&amended, release, "order amended")
+
+	// Let the processor know the order changed so it works off the latest version
+	if err := s.publishOrderEvent(&amended, EventOrderAmended); err != nil {
+		log.Printf("failed to enqueue amended order: %v", err)
+	}
+
+	log.Printf("Order %s amended to version %d", amended.ID.Hex(), amended.Version)
+	return &amended, nil
+}
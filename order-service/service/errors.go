@@ -0,0 +1,62 @@
+package service
+
+import "fmt"
+
+// ErrorKind classifies domain errors so they can be reported consistently to clients
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindNotFound
+	KindInvalidArgument
+	KindConflict
+	KindInsufficientStock
+	KindUnavailable
+)
+
+// Error is a domain error of the order service. Code is a stable machine-readable identifier,
+// Message is safe to show to clients while Err keeps the underlying cause for logs.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var (
+	ErrInvalidOrderID = &Error{Kind: KindInvalidArgument, Code: "invalid_order_id", Message: "invalid order ID"}
+	ErrOrderNotFound  = &Error{Kind: KindNotFound, Code: "order_not_found", Message: "order not found"}
+	// ErrVersionConflict is returned when the order was modified since the version the caller based its change on
+	ErrVersionConflict = &Error{Kind: KindConflict, Code: "version_conflict", Message: "order was modified concurrently, reload it and retry"}
+)
+
+func notFound(code string, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func invalidArgument(code string, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindInvalidArgument, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func conflict(code string, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func insufficientStock(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindInsufficientStock, Code: "insufficient_stock", Message: fmt.Sprintf(format, args...)}
+}
+
+func unavailable(code string, err error, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindUnavailable, Code: code, Message: fmt.Sprintf(format, args...), Err: err}
+}
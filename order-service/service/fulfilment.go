@@ -0,0 +1,145 @@
+package service
+
+import (
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+)
+
+// groupsOf returns the fulfilment groups of an order. Orders placed before groups existed are fulfilled as
+// a single group without an id, which is processed along with the order.
+func groupsOf(order *models.Order) []models.FulfilmentGroup {
+	if len(order.Fulfilments) > 0 {
+		return order.Fulfilments
+	}
+
+	group := models.FulfilmentGroup{Status: models.FulfilmentPending}
+	if order.Status != models.Pending {
+		group.Status = models.FulfilmentProcessing
+	}
+	for _, item := range order.Items {
+		group.Items = append(group.Items, models.ShipmentItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+	return []models.FulfilmentGroup{group}
+}
+
+// shipmentGroup picks the fulfilment group a new shipment packs items of. The group is named by the
+// shipment, found from its items, or is the only group with unshipped items.
+func shipmentGroup(order *models.Order, shipment *models.Shipment) (*models.FulfilmentGroup, error) {
+	groups := groupsOf(order)
+
+	if shipment.FulfilmentID != "" {
+		for i := range groups {
+			if groups[i].ID == shipment.FulfilmentID {
+				return &groups[i], nil
+			}
+		}
+		return nil, notFound("fulfilment_not_found", "fulfilment group %s not found", shipment.FulfilmentID)
+	}
+
+	if len(shipment.Items) > 0 {
+		var group *models.FulfilmentGroup
+		for _, item := range shipment.Items {
+			found := groupOfProduct(groups, item.ProductID)
+			if found == nil {
+				return nil, invalidArgument("invalid_shipment", "product %s is not part of the order", item.ProductID)
+			}
+			if group != nil && found.ID != group.ID {
+				return nil, invalidArgument("invalid_shipment", "a shipment can only pack items of one fulfilment group")
+			}
+			group = found
+		}
+		return group, nil
+	}
+
+	var open []*models.FulfilmentGroup
+	for i := range groups {
+		for _, qty := range unshippedInGroup(order, &groups[i]) {
+			if qty > 0 {
+				open = append(open, &groups[i])
+				break
+			}
+		}
+	}
+	switch len(open) {
+	case 0:
+		return nil, conflict("invalid_order_state", "all items of the order are already shipped")
+	case 1:
+		return open[0], nil
+	default:
+		return nil, invalidArgument("fulfilment_required", "order is fulfilled from %d warehouses, fulfilment_id is required", len(open))
+	}
+}
+
+func groupOfProduct(groups []models.FulfilmentGroup, productID string) *models.FulfilmentGroup {
+	for i := range groups {
+		for _, item := range groups[i].Items {
+			if item.ProductID == productID {
+				return &groups[i]
+			}
+		}
+	}
+	return nil
+}
+
+// unshippedInGroup returns the quantity of every line of the group not yet assigned to a shipment
+func unshippedInGroup(order *models.Order, group *models.FulfilmentGroup) map[string]int {
+	remaining := make(map[string]int)
+	for _, item := range group.Items {
+		remaining[item.ProductID] += item.Quantity
+	}
+	for _, shipment := range order.Shipments {
+		if shipment.FulfilmentID != group.ID {
+			continue
+		}
+		for _, item := range shipment.Items {
+			remaining[item.ProductID] -= item.Quantity
+		}
+	}
+	return remaining
+}
+
+// groupShippingStatus derives the status of a group from its shipments: SHIPPED once every item left the
+// warehouse and DELIVERED once every shipment arrived. Groups with items still to ship keep their status.
+func groupShippingStatus(order *models.Order, group *models.FulfilmentGroup) models.FulfilmentStatus {
+	for _, qty := range unshippedInGroup(order, group) {
+		if qty > 0 {
+			return group.Status
+		}
+	}
+
+	shipped, delivered, shipments := true, true, 0
+	for _, shipment := range order.Shipments {
+		if shipment.FulfilmentID != group.ID {
+			continue
+		}
+		shipments++
+		if shipment.ShippedAt == nil {
+			shipped = false
+		}
+		if shipment.Status != models.ShipmentDelivered {
+			delivered = false
+		}
+	}
+
+	switch {
+	case shipments == 0:
+		return group.Status
+	case delivered:
+		return models.FulfilmentDelivered
+	case shipped:
+		return models.FulfilmentShipped
+	default:
+		return group.Status
+	}
+}
+
+// setFulfilmentStatus moves every group that is not cancelled to status
+func setFulfilmentStatus(order *models.Order, status models.FulfilmentStatus, now time.Time) {
+	for i := range order.Fulfilments {
+		if order.Fulfilments[i].Status != models.FulfilmentCancelled {
+			order.Fulfilments[i].Status = status
+			order.Fulfilments[i].UpdatedAt = now
+		}
+	}
+}
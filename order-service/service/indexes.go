@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// orderIndexes back the ListOrders filters and the lookups done by the order workflows. Every query is
+// scoped to a tenant, so tenant_id leads the keys.
+var orderIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "customer_id", Value: 1}, {Key: "created_at", Value: -1}}, Options: options.Index().SetName("tenant_customer_created_at")},
+	{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "customer_id", Value: 1}, {Key: "total", Value: 1}}, Options: options.Index().SetName("tenant_customer_total")},
+	{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}}, Options: options.Index().SetName("tenant_status_created_at")},
+	{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "items.product_id", Value: 1}, {Key: "created_at", Value: -1}}, Options: options.Index().SetName("tenant_product_created_at")},
+	{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}}, Options: options.Index().SetName("tenant_created_at")},
+	{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "updated_at", Value: -1}}, Options: options.Index().SetName("tenant_updated_at")},
+	{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "total", Value: 1}}, Options: options.Index().SetName("tenant_total")},
+	// carrier webhook looks orders up by tracking number across tenants, so a tracking number may only be used once
+	{Keys: bson.D{{Key: "shipments.tracking_number", Value: 1}}, Options: options.Index().SetName("shipment_tracking_number_unique").SetUnique(true).
+		SetPartialFilterExpression(bson.M{"shipments.tracking_number": bson.M{"$exists": true}})},
+}
+
+// EnsureIndexes creates the order and promotion collection indexes, existing indexes are left untouched
+func (s *OrderService) EnsureIndexes() error {
+	collection := GetCollection(s.collectionName)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	names, err := collection.Indexes().CreateMany(ctx, orderIndexes)
+	if err != nil {
+		return err
+	}
+	log.Printf("MongoDB indexes ensured on %s: %v", s.collectionName, names)
+
+	if s.promotionCollection != "" {
+		names, err := GetCollection(s.promotionCollection).Indexes().CreateMany(ctx, promotionIndexes)
+		if err != nil {
+			return err
+		}
+		log.Printf("MongoDB indexes ensured on %s: %v", s.promotionCollection, names)
+	}
+	return nil
+}
@@ -6,11 +6,15 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"time"
 
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
 	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
 	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mongodb"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tax"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/warehouse"
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -21,172 +25,510 @@ import (
 var GetCollection = mongodb.GetCollection
 
 type OrderService struct {
-	collectionName      string
-	inventoryServiceURL string
-	rdb                 *redis.Client
-	streamKey           string
+	collectionName string
+	inventory      inventory.Client
+	rdb            *redis.Client
+	streamKey      string
+	payments       payment.Provider
+	tenant         tenant.Tenant
+	allocator      *warehouse.Allocator
+	// promotionCollection stores the promotions, orders are not discounted when it is empty
+	promotionCollection string
+	tax                 tax.Provider
 }
 
-func NewOrderService(collectionName string, inventoryServiceURL string, rc *redis.Client, sk string) *OrderService {
+// NewOrderService returns the service of the default tenant
+func NewOrderService(collectionName string, inventoryClient inventory.Client, rc *redis.Client, sk string, payments payment.Provider) *OrderService {
 	return &OrderService{
-		collectionName:      collectionName,
-		inventoryServiceURL: inventoryServiceURL,
-		rdb:                 rc,
-		streamKey:           sk,
+		collectionName: collectionName,
+		inventory:      inventoryClient,
+		rdb:            rc,
+		streamKey:      sk,
+		payments:       payments,
+		tenant:         tenant.Tenant{ID: tenant.Default},
 	}
 }
 
+// ForTenant returns the service acting for t. Every query is restricted to the tenant's orders and the
+// calls to inventory-service name the tenant.
+func (s *OrderService) ForTenant(t tenant.Tenant) *OrderService {
+	if t.ID == "" {
+		t.ID = tenant.Default
+	}
+	scoped := *s
+	scoped.tenant = t
+	return &scoped
+}
+
+// filter scopes a query to the tenant of the service
+func (s *OrderService) filter(filter bson.M) bson.M {
+	return tenant.Filter(s.tenant.ID, filter)
+}
+
+// withTimeout returns a context acting for the tenant of the service
+func (s *OrderService) withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(tenant.NewContext(context.Background(), s.tenant), timeout)
+}
+
+// Events published to the order stream
+const (
+	EventOrderCreated = "order.created"
+	EventOrderAmended = "order.amended"
+)
+
 // CreateOrder inserts a new order
 func (s *OrderService) CreateOrder(order models.Order) (*models.Order, error) {
 
 	collection := GetCollection(s.collectionName)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := s.withTimeout(5 * time.Second)
 	defer cancel()
 
-	//Validate stock availability from inventory-service for each order
-	for _, item := range order.Items {
+	products, err := s.priceItems(&order)
+	if err != nil {
+		return &order, err
+	}
+	if err := s.applyPromotions(ctx, &order, products, nil); err != nil {
+		return &order, err
+	}
+	if err := s.applyTax(ctx, &order, products); err != nil {
+		return &order, err
+	}
+
+	order.ID = primitive.NewObjectID()
+	order.TenantID = s.tenant.ID
+	order.Status = "PENDING"
+	order.Version = 1
+	order.CreatedAt = time.Now()
+	order.UpdatedAt = time.Now()
+	order.History = []models.StatusChange{{Status: models.Pending, Reason: "order placed", ChangedAt: order.CreatedAt}}
+	if models.WaitingForStock(order.Items) {
+		order.Status = models.Backordered
+		order.History[0].Status = models.Backordered
+		order.History[0].Reason = "order placed, waiting for stock"
+	}
+	order.Fulfilments = models.FulfilmentGroups(order.Items, nil, order.CreatedAt)
+
+	// Stock and limited promotions are taken before the order exists, a failed insert gives them back
+	reserved := reservedLines(order.Items)
+	if err := s.reserveStock(ctx, &order, reserved, nil); err != nil {
+		return &order, err
+	}
+	redeemed, err := s.redeem(ctx, order.Discounts, nil)
+	if err != nil {
+		s.releaseStock(&order, reserved, "order not placed")
+		return &order, err
+	}
+	if _, err := collection.InsertOne(ctx, order); err != nil {
+		s.unredeem(ctx, redeemed)
+		s.releaseStock(&order, reserved, "order not placed")
+		return nil, err
+	}
+
+	// Backordered orders are only processed once order-processor released them
+	if order.Status == models.Backordered {
+		log.Printf("Order %s backordered until its products are restocked", order.ID.Hex())
+		return &order, nil
+	}
+
+	// Enqueue the order in redis stream for further processing
+	if err := s.publishOrderEvent(&order, EventOrderCreated); err != nil {
+		log.Printf("failed to enqueue order: %v", err)
+	} else {
+		log.Printf("Order %s enqueued successfully\n", order.ID.Hex())
+	}
+
+	return &order, nil
+}
+
+// priceItems validates the lines of a new order against inventory-service, captures their price and
+// warehouse and sums the subtotal. It returns the products of the order by id.
+func (s *OrderService) priceItems(order *models.Order) (map[string]*models.Product, error) {
+	// Stock is validated against inventory-service in one call, product metadata may come from the cache
+	productIDs := make([]string, len(order.Items))
+	for i, item := range order.Items {
+		productIDs[i] = item.ProductID
+	}
+	stock, err := s.fetchStock(productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	products := make(map[string]*models.Product, len(order.Items))
+	order.Subtotal = 0
+	for i, item := range order.Items {
 
-		productURL := fmt.Sprintf("%s/product?id=%s", s.inventoryServiceURL, item.ProductID)
-		log.Println("fetching product details from inventory: ", productURL)
+		product, err := s.fetchProduct(item.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		products[item.ProductID] = product
 
-		resp, err := http.Get(productURL)
-		if err != nil || resp.StatusCode != http.StatusOK {
-			return &order, fmt.Errorf("failed to fetch products from inventory-service")
+		level, ok := stock[item.ProductID]
+		if !ok {
+			return nil, invalidArgument("product_not_found", "product %s does not exist", item.ProductID)
+		}
+		// Lines of backorderable products that are short wait for a restock instead, they are allocated
+		// no warehouse
+		var warehouseID string
+		order.Items[i].Backorder = nil
+		if level.Stock < item.Quantity {
+			if product.Backorder == nil {
+				return nil, insufficientStock("insufficient stock for product %s, order auto cancelled. Available Stock: %d, Order Quantity: %d", item.ProductID, level.Stock, item.Quantity)
+			}
+			order.Items[i].Backorder = &models.BackorderLine{Mode: product.Backorder.Mode, AvailableAt: product.Backorder.AvailableAt}
+		} else if warehouseID, err = s.allocate(order.ShipTo, item, level); err != nil {
+			return nil, err
 		}
-		defer resp.Body.Close()
 
-		var product models.Product
-		if err := json.NewDecoder(resp.Body).Decode(&product); err != nil {
-			return &order, fmt.Errorf("failed to decode product JSON: %w", err)
+		// Tenants with a currency only sell in that currency
+		if s.tenant.Currency != "" && product.Currency != s.tenant.Currency {
+			return nil, invalidArgument("currency_mismatch", "product %s is priced in %s, orders are placed in %s", item.ProductID, product.Currency, s.tenant.Currency)
 		}
 
-		if product.Stock < item.Quantity {
-			return &order, fmt.Errorf("insufficient stock for product %s, order auto cancelled. Available Stock: %d, Order Quantity: %d", item.ProductID, product.Stock, item.Quantity)
+		// Price is captured at order time so later catalog changes don't alter the amount to be paid
+		order.Items[i].Price = product.Price
+		order.Items[i].WarehouseID = warehouseID
+		order.Subtotal += product.Price * float64(item.Quantity)
+		if order.Currency == "" {
+			order.Currency = product.Currency
 		}
 	}
+	return products, nil
+}
 
-	order.ID = primitive.NewObjectID()
-	order.Status = "PENDING"
-	order.CreatedAt = time.Now()
-	order.UpdatedAt = time.Now()
-	_, err := collection.InsertOne(ctx, order)
+// fetchProduct retrieves the product details, possibly cached, from inventory-service
+func (s *OrderService) fetchProduct(productID string) (*models.Product, error) {
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+
+	product, err := s.inventory.GetProduct(ctx, productID)
+	if errors.Is(err, inventory.ErrProductNotFound) {
+		return nil, invalidArgument("product_not_found", "product %s does not exist", productID)
+	}
 	if err != nil {
-		return nil, err
+		return nil, inventoryUnavailable(err)
 	}
+	return product, nil
+}
 
+// fetchStock reads the current stock of the products from inventory-service, unknown products are left out
+func (s *OrderService) fetchStock(productIDs []string) (map[string]models.StockLevel, error) {
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+
+	stock, err := s.inventory.GetStock(ctx, productIDs)
+	if err != nil {
+		return nil, inventoryUnavailable(err)
+	}
+	return stock, nil
+}
+
+func inventoryUnavailable(err error) error {
+	if errors.Is(err, inventory.ErrCircuitOpen) {
+		return unavailable("inventory_unavailable", err, "inventory-service is unhealthy, try again later")
+	}
+	return unavailable("inventory_unavailable", err, "failed to fetch products from inventory-service")
+}
+
+// publishOrderEvent adds the order to the redis stream consumed by order-processor. The version lets the
+// processor recognise messages about an outdated state of the order.
+func (s *OrderService) publishOrderEvent(order *models.Order, event string) error {
 	itemsJSON, err := json.Marshal(order.Items)
 	if err != nil {
-		log.Printf("failed to marshal products: %v", err)
-		return &order, fmt.Errorf("failed to marshal products: %w", err)
+		return fmt.Errorf("failed to marshal products: %w", err)
 	}
 
-	// Enqueue the order in redis stream for further processing
 	args := &redis.XAddArgs{
 		Stream: s.streamKey,
 		Values: map[string]interface{}{
-			"order_id": order.ID.Hex(),
-			"products": string(itemsJSON)},
+			"event":     event,
+			"order_id":  order.ID.Hex(),
+			"tenant_id": s.tenant.ID,
+			"version":   order.Version,
+			"products":  string(itemsJSON)},
 	}
+	return s.rdb.XAdd(context.Background(), args).Err()
+}
 
-	if err := s.rdb.XAdd(context.Background(), args).Err(); err != nil {
-		log.Printf("failed to enqueue order: %v", err)
-	} else {
-		log.Printf("Order %s enqueued successfully\n", order.ID.Hex())
+// findOrder loads an order for a read-modify-write operation. When ifMatch is set the order must still be
+// at that version.
+func (s *OrderService) findOrder(ctx context.Context, orderID string, ifMatch *int64) (*models.Order, error) {
+	objID, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return nil, ErrInvalidOrderID
 	}
 
+	var order models.Order
+	if err := GetCollection(s.collectionName).FindOne(ctx, s.filter(bson.M{"_id": objID})).Decode(&order); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	if ifMatch != nil && *ifMatch != order.Version {
+		return nil, ErrVersionConflict
+	}
 	return &order, nil
 }
 
+// updateOrder applies update to the order only if it is still at the version that was read, and bumps
+// the version. The in-memory order follows the new version so it can be updated again.
+func (s *OrderService) updateOrder(ctx context.Context, order *models.Order, update bson.M) error {
+	update["$inc"] = bson.M{"version": 1}
+
+	res, err := GetCollection(s.collectionName).UpdateOne(ctx, s.filter(bson.M{"_id": order.ID, "version": mongodb.VersionFilter(order.Version)}), update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrVersionConflict
+	}
+	order.Version++
+	return nil
+}
+
 // GetOrderByID fetches an order by its ID
 func (s *OrderService) GetOrderByID(id string) (*models.Order, error) {
 	collection := GetCollection(s.collectionName)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := s.withTimeout(5 * time.Second)
 	defer cancel()
 
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, errors.New("invalid order ID")
+		return nil, ErrInvalidOrderID
 	}
 
 	var order models.Order
-	err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&order)
+	err = collection.FindOne(ctx, s.filter(bson.M{"_id": objID})).Decode(&order)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return &models.Order{}, nil
+			return nil, ErrOrderNotFound
 		}
 		return nil, err
 	}
 	return &order, nil
 }
 
-// ListOrders fetches all orders, optionally filtered by status and cursor-based pagination
-func (s *OrderService) ListOrders(status string, cursor string, pageSize int64) ([]models.Order, string, error) {
+// OrderFilter narrows down the orders returned by ListOrders, zero values are ignored
+type OrderFilter struct {
+	Status      string
+	CustomerID  string
+	ProductID   string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	MinTotal    *float64
+	MaxTotal    *float64
+}
+
+// bson converts the filter into a MongoDB query
+func (f OrderFilter) bson() bson.M {
+	filter := bson.M{}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+	if f.CustomerID != "" {
+		filter["customer_id"] = f.CustomerID
+	}
+	if f.ProductID != "" {
+		filter["items.product_id"] = f.ProductID
+	}
+
+	createdAt := bson.M{}
+	if !f.CreatedFrom.IsZero() {
+		createdAt["$gte"] = f.CreatedFrom
+	}
+	if !f.CreatedTo.IsZero() {
+		createdAt["$lt"] = f.CreatedTo
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+
+	total := bson.M{}
+	if f.MinTotal != nil {
+		total["$gte"] = *f.MinTotal
+	}
+	if f.MaxTotal != nil {
+		total["$lte"] = *f.MaxTotal
+	}
+	if len(total) > 0 {
+		filter["total"] = total
+	}
+	return filter
+}
+
+// ListOrders fetches the orders matching the filter, sorted by created_at, updated_at or total, with
+// bidirectional cursor-based pagination. Pages hold at most MaxPageSize orders.
+func (s *OrderService) ListOrders(opts ListOptions) (*OrderPage, error) {
 	collection := GetCollection(s.collectionName)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := s.withTimeout(5 * time.Second)
 	defer cancel()
 
-	filter := bson.M{}
-	if status != "" {
-		filter["status"] = status
+	opts.PageSize = min(opts.PageSize, MaxPageSize)
+
+	baseFilter := s.filter(opts.Filter.bson())
+
+	// If cursor is provided, it dictates the sort and the starting point
+	cur := pageCursor{SortBy: opts.SortBy, Descending: opts.Descending}
+	if cur.SortBy == "" {
+		cur.SortBy = SortByCreatedAt
+	}
+	if err := validateSortField(cur.SortBy); err != nil {
+		return nil, err
 	}
 
-	// If cursor is provided, use it as starting point (ObjectID)
-	if cursor != "" {
-		lastID, err := primitive.ObjectIDFromHex(cursor)
+	filter := baseFilter
+	if opts.Cursor != "" {
+		decoded, err := decodePageCursor(opts.Cursor)
 		if err != nil {
-			return nil, "", fmt.Errorf("invalid cursor")
+			return nil, err
 		}
-		filter["_id"] = bson.M{"$gt": lastID} // fetch documents with _id > lastID
+		cur = decoded
+		filter = bson.M{"$and": bson.A{baseFilter, cur.bson()}}
 	}
 
-	// Sorted by _id ascending to maintain consistent pagination
+	direction := 1
+	if !cur.ascending() {
+		direction = -1
+	}
+
+	// One extra order is fetched to know whether another page exists in the scan direction
 	findOptions := options.Find().
-		SetSort(bson.D{{Key: "_id", Value: 1}}).
-		SetLimit(pageSize)
+		SetSort(bson.D{{Key: cur.SortBy, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(opts.PageSize + 1)
 
-	cur, err := collection.Find(ctx, filter, findOptions)
+	cursor, err := collection.Find(ctx, filter, findOptions)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	defer cur.Close(ctx)
+	defer cursor.Close(ctx)
 
 	var orders []models.Order
-	if err := cur.All(ctx, &orders); err != nil {
-		return nil, "", err
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+
+	more := int64(len(orders)) > opts.PageSize
+	if more {
+		orders = orders[:opts.PageSize]
+	}
+
+	// Backward pages are scanned in reverse, restore the requested order
+	if cur.Backward {
+		for i, j := 0, len(orders)-1; i < j; i, j = i+1, j-1 {
+			orders[i], orders[j] = orders[j], orders[i]
+		}
 	}
 
-	var nextCursor string
+	page := &OrderPage{Orders: orders}
 	if len(orders) > 0 {
-		lastOrder := orders[len(orders)-1]
-		nextCursor = lastOrder.ID.Hex()
+		first, last := orders[0], orders[len(orders)-1]
+		hasNext, hasPrev := more, opts.Cursor != ""
+		if cur.Backward {
+			hasNext, hasPrev = true, more
+		}
+		if hasNext {
+			page.NextCursor = newPageCursor(cur.SortBy, cur.Descending, false, last).encode()
+		}
+		if hasPrev {
+			page.PrevCursor = newPageCursor(cur.SortBy, cur.Descending, true, first).encode()
+		}
+		page.HasMore = hasNext
 	}
 
-	return orders, nextCursor, nil
+	if opts.IncludeTotal {
+		count, err := collection.CountDocuments(ctx, baseFilter)
+		if err != nil {
+			return nil, err
+		}
+		page.TotalCount = &count
+	}
+
+	return page, nil
 }
 
-// CancelOrder deletes the order but only if it’s still in PENDING status.
-func (s *OrderService) CancelOrder(id string) error {
+// CancelOrder deletes the order if it’s still in PENDING or BACKORDERED status. Orders already PROCESSING are marked
+// CANCELLED and their authorized payment is voided. Either way the stock reserved for the order is released.
+// When ifMatch is set the order must still be at that version.
+func (s *OrderService) CancelOrder(id string, ifMatch *int64) error {
 	collection := GetCollection(s.collectionName)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := s.withTimeout(5 * time.Second)
 	defer cancel()
 
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return errors.New("invalid order ID")
+		return ErrInvalidOrderID
 	}
 
-	// Only delete if status is PENDING
-	res, err := collection.DeleteOne(
+	filter := s.filter(bson.M{"_id": objID})
+	if ifMatch != nil {
+		if _, err := s.findOrder(ctx, id, ifMatch); err != nil {
+			return err
+		}
+		filter["version"] = mongodb.VersionFilter(*ifMatch)
+	}
+
+	// PENDING and BACKORDERED orders have no payment yet, so they can simply be deleted and their stock
+	// given back
+	var deleted models.Order
+	filter["status"] = bson.M{"$in": bson.A{models.Pending, models.Backordered}}
+	err = collection.FindOneAndDelete(ctx, filter).Decode(&deleted)
+	if err == nil {
+		s.releaseStock(&deleted, reservedLines(deleted.Items), "order cancelled")
+		return nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	// PROCESSING orders hold a payment. It is voided or refunded before the order is cancelled, so an
+	// unreachable gateway leaves the order PROCESSING and the cancellation can be retried.
+	var order models.Order
+	filter["status"] = models.Processing
+	if err := collection.FindOne(ctx, filter).Decode(&order); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			current, findErr := s.findOrder(ctx, id, nil)
+			if findErr != nil {
+				return findErr
+			}
+			return conflict("order_not_cancellable", "order cannot be cancelled in %s status", current.Status)
+		}
+		return err
+	}
+
+	now := time.Now()
+	set := bson.M{"status": models.Cancelled, "updated_at": now}
+	if order.Payment != nil {
+		if err := payment.Refund(ctx, s.payments, order.Payment, order.Total); err != nil {
+			return unavailable("payment_unavailable", err, "failed to refund payment for order %s", order.ID.Hex())
+		}
+		set["payment"] = order.Payment
+	}
+	// None of the fulfilment groups ships anymore
+	if len(order.Fulfilments) > 0 {
+		setFulfilmentStatus(&order, models.FulfilmentCancelled, now)
+		set["fulfilments"] = order.Fulfilments
+	}
+
+	updated, err := collection.UpdateOne(
 		ctx,
-		bson.M{"_id": objID, "status": "PENDING"},
+		s.filter(bson.M{"_id": order.ID, "status": models.Processing, "version": mongodb.VersionFilter(order.Version)}),
+		bson.M{
+			"$set":  set,
+			"$push": bson.M{"status_history": models.StatusChange{Status: models.Cancelled, Reason: "cancelled by customer", ChangedAt: now}},
+			"$inc":  bson.M{"version": 1},
+		},
 	)
 	if err != nil {
 		return err
 	}
-	if res.DeletedCount == 0 {
-		return errors.New("order cannot be cancelled (either not PENDING or not found)")
+	if updated.MatchedCount == 0 {
+		return ErrVersionConflict
 	}
-
+	if order.Payment != nil {
+		log.Printf("Payment for order %s is now %s", order.ID.Hex(), order.Payment.Status)
+	}
+	s.releaseStock(&order, reservedLines(order.Items), "order cancelled")
 	return nil
 }
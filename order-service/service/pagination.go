@@ -0,0 +1,133 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sort fields supported by ListOrders
+const (
+	SortByCreatedAt = "created_at"
+	SortByUpdatedAt = "updated_at"
+	SortByTotal     = "total"
+)
+
+// MaxPageSize caps the orders of a ListOrders page, larger page sizes are lowered to it
+const MaxPageSize = 100
+
+var errInvalidCursor = &Error{Kind: KindInvalidArgument, Code: "invalid_cursor", Message: "invalid cursor"}
+
+// ListOptions controls filtering, sorting and pagination of ListOrders
+type ListOptions struct {
+	Filter     OrderFilter
+	SortBy     string
+	Descending bool
+	// Cursor is a next_cursor or prev_cursor of a previous page. It carries its own sort, so SortBy
+	// and Descending are ignored when it is set.
+	Cursor       string
+	PageSize     int64
+	IncludeTotal bool
+}
+
+// OrderPage is a single page of ListOrders results
+type OrderPage struct {
+	Orders     []models.Order `json:"orders"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	PrevCursor string         `json:"prev_cursor,omitempty"`
+	HasMore    bool           `json:"has_more"`
+	TotalCount *int64         `json:"total_count,omitempty"`
+}
+
+// pageCursor is the decoded form of the opaque cursors handed to clients. It records the sort key value
+// and ID of the boundary order so pages stay stable while orders are inserted.
+type pageCursor struct {
+	SortBy     string  `json:"s"`
+	Descending bool    `json:"d,omitempty"`
+	Backward   bool    `json:"b,omitempty"`
+	ID         string  `json:"id"`
+	Time       string  `json:"t,omitempty"`
+	Total      float64 `json:"v,omitempty"`
+}
+
+func newPageCursor(sortBy string, descending bool, backward bool, order models.Order) pageCursor {
+	c := pageCursor{SortBy: sortBy, Descending: descending, Backward: backward, ID: order.ID.Hex()}
+	switch sortBy {
+	case SortByCreatedAt:
+		c.Time = order.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case SortByUpdatedAt:
+		c.Time = order.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case SortByTotal:
+		c.Total = order.Total
+	}
+	return c
+}
+
+func (c pageCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodePageCursor(value string) (pageCursor, error) {
+	var c pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return c, errInvalidCursor
+	}
+	if err := validateSortField(c.SortBy); err != nil {
+		return c, errInvalidCursor
+	}
+	if _, err := primitive.ObjectIDFromHex(c.ID); err != nil {
+		return c, errInvalidCursor
+	}
+	if c.SortBy != SortByTotal {
+		if _, err := time.Parse(time.RFC3339Nano, c.Time); err != nil {
+			return c, errInvalidCursor
+		}
+	}
+	return c, nil
+}
+
+// keyValue returns the sort key value stored in the cursor
+func (c pageCursor) keyValue() interface{} {
+	if c.SortBy == SortByTotal {
+		return c.Total
+	}
+	t, _ := time.Parse(time.RFC3339Nano, c.Time)
+	return t
+}
+
+// ascending reports whether the query following this cursor scans the sort key in ascending order
+func (c pageCursor) ascending() bool {
+	return c.Descending == c.Backward
+}
+
+// bson returns the condition selecting the orders after the cursor in scan order, ties on the sort key
+// are broken by _id
+func (c pageCursor) bson() bson.M {
+	id, _ := primitive.ObjectIDFromHex(c.ID)
+	op := "$gt"
+	if !c.ascending() {
+		op = "$lt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{c.SortBy: bson.M{op: c.keyValue()}},
+		bson.M{c.SortBy: c.keyValue(), "_id": bson.M{op: id}},
+	}}
+}
+
+func validateSortField(sortBy string) error {
+	switch sortBy {
+	case SortByCreatedAt, SortByUpdatedAt, SortByTotal:
+		return nil
+	default:
+		return invalidArgument("invalid_sort", "unsupported sort field: %s", sortBy)
+	}
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// capturePayment settles the authorized payment of an order once it has shipped. It reports whether the
+// payment changed, the caller saves it. Payments captured already, by an earlier delivery of the same carrier
+// event, are left alone.
+func (s *OrderService) capturePayment(ctx context.Context, order *models.Order) (bool, error) {
+	if order.Payment == nil || order.Payment.Status != models.PaymentAuthorized {
+		return false, nil
+	}
+	if err := payment.Capture(ctx, s.payments, order.Payment); err != nil {
+		return false, unavailable("payment_unavailable", err, "failed to capture payment for order %s", order.ID.Hex())
+	}
+	return true, nil
+}
+
+func (s *OrderService) savePayment(ctx context.Context, order *models.Order) error {
+	if err := s.updateOrder(ctx, order, bson.M{"$set": bson.M{"payment": order.Payment}}); err != nil {
+		return err
+	}
+	log.Printf("Payment for order %s is now %s", order.ID.Hex(), order.Payment.Status)
+	return nil
+}
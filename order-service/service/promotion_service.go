@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/promotion"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrPromotionsDisabled is returned by the promotion operations of a service without a promotions collection
+var ErrPromotionsDisabled = &Error{Kind: KindUnavailable, Code: "promotions_disabled", Message: "promotions are not enabled"}
+
+// promotionIndexes make coupon codes unique per tenant and back the lookup of the promotions of an order
+var promotionIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "code", Value: 1}},
+		Options: options.Index().SetName("tenant_code").SetUnique(true).SetPartialFilterExpression(bson.M{"code": bson.M{"$exists": true}}),
+	},
+	{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "active", Value: 1}, {Key: "created_at", Value: 1}}, Options: options.Index().SetName("tenant_active_created_at")},
+}
+
+// WithPromotions returns the service discounting orders with the promotions stored in collectionName
+func (s *OrderService) WithPromotions(collectionName string) *OrderService {
+	scoped := *s
+	scoped.promotionCollection = collectionName
+	return &scoped
+}
+
+// normalizeCode makes coupon codes case-insensitive
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CreatePromotion stores a new active promotion of the tenant. Its coupon code, if any, must not be taken.
+func (s *OrderService) CreatePromotion(p models.Promotion) (*models.Promotion, error) {
+	if s.promotionCollection == "" {
+		return nil, ErrPromotionsDisabled
+	}
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+
+	p.ID = primitive.NewObjectID()
+	p.TenantID = s.tenant.ID
+	p.Code = normalizeCode(p.Code)
+	p.UsageCount = 0
+	p.Active = true
+	p.CreatedAt = time.Now()
+	if _, err := GetCollection(s.promotionCollection).InsertOne(ctx, p); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, conflict("duplicate_coupon_code", "coupon code %s is already taken", p.Code)
+		}
+		return nil, err
+	}
+
+	log.Printf("Promotion %s (%s) created for tenant %s", p.ID.Hex(), p.Type, s.tenant.ID)
+	return &p, nil
+}
+
+// ListPromotions returns the promotions of the tenant, the newest first
+func (s *OrderService) ListPromotions() ([]models.Promotion, error) {
+	if s.promotionCollection == "" {
+		return nil, ErrPromotionsDisabled
+	}
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+
+	cursor, err := GetCollection(s.promotionCollection).Find(ctx, s.filter(bson.M{}), options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	promotions := []models.Promotion{}
+	if err := cursor.All(ctx, &promotions); err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
+
+// DeactivatePromotion stops a promotion from applying to new orders. It is kept so the discounts of the
+// orders that used it can still be traced back to it.
+func (s *OrderService) DeactivatePromotion(id string) (*models.Promotion, error) {
+	if s.promotionCollection == "" {
+		return nil, ErrPromotionsDisabled
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, notFound("promotion_not_found", "promotion not found")
+	}
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+
+	var p models.Promotion
+	err = GetCollection(s.promotionCollection).FindOneAndUpdate(
+		ctx,
+		s.filter(bson.M{"_id": objID}),
+		bson.M{"$set": bson.M{"active": false}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&p)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, notFound("promotion_not_found", "promotion not found")
+		}
+		return nil, err
+	}
+	log.Printf("Promotion %s deactivated", id)
+	return &p, nil
+}
+
+// Quote works out the price of an order the way CreateOrder would, discounts and taxes included, without
+// placing it or using up coupons
+func (s *OrderService) Quote(order models.Order) (*models.OrderQuote, error) {
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+
+	products, err := s.priceItems(&order)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyPromotions(ctx, &order, products, nil); err != nil {
+		return nil, err
+	}
+	if err := s.applyTax(ctx, &order, products); err != nil {
+		return nil, err
+	}
+
+	quote := &models.OrderQuote{
+		Items:        order.Items,
+		Subtotal:     order.Subtotal,
+		Discounts:    order.Discounts,
+		Taxes:        order.Taxes,
+		TaxTotal:     order.TaxTotal,
+		TaxInclusive: order.TaxInclusive,
+		Total:        order.Total,
+		Currency:     order.Currency,
+		Region:       order.Region,
+		CouponCodes:  order.CouponCodes,
+	}
+	if quote.Discounts == nil {
+		quote.Discounts = []models.DiscountLine{}
+	}
+	if quote.Taxes == nil {
+		quote.Taxes = []models.TaxLine{}
+	}
+	return quote, nil
+}
+
+// applyPromotions works out the discounts of the order from its coupon codes and the promotions without a
+// code, and sets its total. Unknown, unusable or inapplicable coupons fail the order. Promotions in
+// redeemed were already counted for the order and are not held to their usage limit again.
+func (s *OrderService) applyPromotions(ctx context.Context, order *models.Order, products map[string]*models.Product, redeemed map[string]bool) error {
+	var codes []string
+	for _, code := range order.CouponCodes {
+		if code = normalizeCode(code); code != "" && !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	order.CouponCodes = codes
+	order.Discounts = nil
+	order.Total = order.Subtotal
+
+	if s.promotionCollection == "" {
+		if len(codes) > 0 {
+			return invalidArgument("invalid_coupon", "coupon codes are not accepted")
+		}
+		return nil
+	}
+
+	cursor, err := GetCollection(s.promotionCollection).Find(ctx,
+		s.filter(bson.M{"$or": bson.A{bson.M{"code": bson.M{"$exists": false}, "active": true}, bson.M{"code": bson.M{"$in": codes}}}}),
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	var promotions []models.Promotion
+	if err := cursor.All(ctx, &promotions); err != nil {
+		return err
+	}
+
+	lines := make([]promotion.Line, len(order.Items))
+	for i, item := range order.Items {
+		lines[i] = promotion.Line{ProductID: item.ProductID, Quantity: item.Quantity, Price: item.Price}
+		if product := products[item.ProductID]; product != nil {
+			lines[i].Category = product.Category
+			lines[i].Brand = product.Brand
+		}
+	}
+
+	now := time.Now()
+	usable := make([]models.Promotion, 0, len(promotions))
+	found := make(map[string]bool, len(codes))
+	for _, p := range promotions {
+		if redeemed[p.ID.Hex()] {
+			p.UsageLimit = 0
+		}
+		err := promotion.Check(&p, now)
+		if p.Code == "" {
+			if err == nil {
+				usable = append(usable, p)
+			}
+			continue
+		}
+
+		found[p.Code] = true
+		if err != nil {
+			return invalidArgument("invalid_coupon", "coupon %s cannot be used: %v", p.Code, err)
+		}
+		if len(promotion.Discounts(&p, lines)) == 0 {
+			return invalidArgument("coupon_not_applicable", "coupon %s does not apply to the order", p.Code)
+		}
+		usable = append(usable, p)
+	}
+	for _, code := range codes {
+		if !found[code] {
+			return invalidArgument("invalid_coupon", "coupon %s does not exist", code)
+		}
+	}
+
+	order.Discounts = promotion.Best(usable, lines)
+	if len(order.Discounts) > 0 {
+		order.Total = math.Round((order.Subtotal-promotion.Total(order.Discounts))*100) / 100
+	}
+	return nil
+}
+
+// redeem counts a use of every promotion discounting the order that is not in redeemed yet. A promotion
+// that reached its usage limit meanwhile fails the order, the uses counted so far are given back. It returns
+// the promotions it counted.
+func (s *OrderService) redeem(ctx context.Context, discounts []models.DiscountLine, redeemed map[string]bool) ([]primitive.ObjectID, error) {
+	if s.promotionCollection == "" {
+		return nil, nil
+	}
+
+	var counted []primitive.ObjectID
+	for _, d := range discounts {
+		if redeemed[d.PromotionID] {
+			continue
+		}
+		objID, err := primitive.ObjectIDFromHex(d.PromotionID)
+		if err != nil || slices.Contains(counted, objID) {
+			continue
+		}
+
+		res, err := GetCollection(s.promotionCollection).UpdateOne(ctx,
+			s.filter(bson.M{"_id": objID, "$or": bson.A{
+				bson.M{"usage_limit": bson.M{"$exists": false}},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$usage_count", "$usage_limit"}}},
+			}}),
+			bson.M{"$inc": bson.M{"usage_count": 1}})
+		if err == nil && res.ModifiedCount == 0 {
+			err = conflict("promotion_used_up", "promotion %s reached its usage limit", d.Description)
+		}
+		if err != nil {
+			s.unredeem(ctx, counted)
+			return nil, err
+		}
+		counted = append(counted, objID)
+	}
+	return counted, nil
+}
+
+// unredeem gives back the uses redeem counted for an order that was not saved
+func (s *OrderService) unredeem(ctx context.Context, ids []primitive.ObjectID) {
+	for _, id := range ids {
+		if _, err := GetCollection(s.promotionCollection).UpdateOne(ctx, s.filter(bson.M{"_id": id}), bson.M{"$inc": bson.M{"usage_count": -1}}); err != nil {
+			log.Printf("Failed to give back a use of promotion %s: %v", id.Hex(), err)
+		}
+	}
+}
+
+// redeemedBy returns the promotions the order was counted for
+func redeemedBy(order *models.Order) map[string]bool {
+	redeemed := make(map[string]bool, len(order.Discounts))
+	for _, d := range order.Discounts {
+		redeemed[d.PromotionID] = true
+	}
+	return redeemed
+}
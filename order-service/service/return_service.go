@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RequestReturn opens a return request for delivered line items of an order
+func (s *OrderService) RequestReturn(orderID string, items []models.ReturnItem, ifMatch *int64) (*models.ReturnRequest, error) {
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+
+	order, err := s.findOrder(ctx, orderID, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	switch order.Status {
+	case models.Delivered, models.ReturnRequested, models.Returned, models.Refunded:
+	default:
+		return nil, conflict("invalid_order_state", "order in %s status cannot be returned", order.Status)
+	}
+	if len(items) == 0 {
+		return nil, invalidArgument("invalid_items", "return must contain at least one item")
+	}
+
+	prices := paidPrices(order)
+
+	returnable := returnableQuantities(order)
+	rma := models.ReturnRequest{
+		ID:          uuid.NewString(),
+		Status:      models.ReturnPending,
+		RequestedAt: time.Now(),
+	}
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return nil, invalidArgument("invalid_items", "invalid quantity for product %s", item.ProductID)
+		}
+		if item.Reason == "" {
+			return nil, invalidArgument("invalid_items", "missing return reason for product %s", item.ProductID)
+		}
+		if item.Quantity > returnable[item.ProductID] {
+			return nil, invalidArgument("invalid_items", "product %s has only %d returnable units", item.ProductID, returnable[item.ProductID])
+		}
+		returnable[item.ProductID] -= item.Quantity
+
+		// Refunds are computed per line from the price paid at order time
+		item.RefundAmount = math.Round(prices[item.ProductID]*float64(item.Quantity)*100) / 100
+		rma.RefundTotal += item.RefundAmount
+		rma.Items = append(rma.Items, item)
+	}
+
+	order.Returns = append(order.Returns, rma)
+	if err := s.saveReturns(ctx, order, "return requested"); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Return %s requested for order %s", rma.ID, orderID)
+	return &rma, nil
+}
+
+// ApproveReturn lets staff accept a requested return so the customer can ship the items back
+func (s *OrderService) ApproveReturn(orderID string, returnID string, note string, ifMatch *int64) (*models.ReturnRequest, error) {
+	return s.decideReturn(orderID, returnID, models.ReturnApproved, note, ifMatch)
+}
+
+// RejectReturn lets staff decline a requested return
+func (s *OrderService) RejectReturn(orderID string, returnID string, note string, ifMatch *int64) (*models.ReturnRequest, error) {
+	return s.decideReturn(orderID, returnID, models.ReturnRejected, note, ifMatch)
+}
+
+func (s *OrderService) decideReturn(orderID string, returnID string, decision models.ReturnStatus, note string, ifMatch *int64) (*models.ReturnRequest, error) {
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+
+	order, err := s.findOrder(ctx, orderID, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	rma, err := findReturn(order, returnID)
+	if err != nil {
+		return nil, err
+	}
+	if rma.Status != models.ReturnPending {
+		return nil, conflict("invalid_return_state", "return in %s status cannot be %s", rma.Status, decision)
+	}
+
+	now := time.Now()
+	rma.Status = decision
+	rma.Note = note
+	rma.DecidedAt = &now
+
+	if err := s.saveReturns(ctx, order, "return "+string(decision)); err != nil {
+		return nil, err
+	}
+	return rma, nil
+}
+
+// ReceiveReturn records the arrival of the returned items, restocks them through inventory-service
+// and refunds the customer. Items inventory-service could not take back stay pending and are restocked
+// again when the refund is retried.
+func (s *OrderService) ReceiveReturn(orderID string, returnID string, ifMatch *int64) (*models.ReturnRequest, error) {
+	ctx, cancel := s.withTimeout(10 * time.Second)
+	defer cancel()
+
+	order, err := s.findOrder(ctx, orderID, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	rma, err := findReturn(order, returnID)
+	if err != nil {
+		return nil, err
+	}
+	if rma.Status != models.ReturnApproved {
+		return nil, conflict("invalid_return_state", "return in %s status cannot be received", rma.Status)
+	}
+
+	now := time.Now()
+	rma.ReceivedAt = &now
+	if err := s.restockReturn(ctx, order, rma, "returned items received"); err != nil {
+		return rma, err
+	}
+
+	if err := s.refundReturn(ctx, order, rma); err != nil {
+		return rma, err
+	}
+	return rma, nil
+}
+
+// RefundReturn retries the restock and the refund of a received return whose restock or refund previously failed
+func (s *OrderService) RefundReturn(orderID string, returnID string, ifMatch *int64) (*models.ReturnRequest, error) {
+	ctx, cancel := s.withTimeout(10 * time.Second)
+	defer cancel()
+
+	order, err := s.findOrder(ctx, orderID, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	rma, err := findReturn(order, returnID)
+	if err != nil {
+		return nil, err
+	}
+	if rma.Status != models.ReturnReceived {
+		return nil, conflict("invalid_return_state", "return in %s status cannot be refunded", rma.Status)
+	}
+
+	if !rma.Restocked() {
+		if err := s.restockReturn(ctx, order, rma, "restock retried"); err != nil {
+			return rma, err
+		}
+	}
+
+	if err := s.refundReturn(ctx, order, rma); err != nil {
+		return rma, err
+	}
+	return rma, nil
+}
+
+func (s *OrderService) refundReturn(ctx context.Context, order *models.Order, rma *models.ReturnRequest) error {
+	// Line refunds are rounded one by one, together they may exceed what is left of the captured amount
+	if p := order.Payment; p != nil && p.Status == models.PaymentCaptured {
+		if remaining := math.Round((p.Amount-p.RefundedAmount)*100) / 100; rma.RefundTotal > remaining {
+			log.Printf("Refund of return %s capped from %.2f to the remaining %.2f", rma.ID, rma.RefundTotal, remaining)
+			rma.RefundTotal = remaining
+		}
+	}
+
+	// The return is saved REFUNDING first, so a refund whose outcome failed to save is never paid twice
+	rma.Status = models.ReturnRefunding
+	if err := s.saveReturns(ctx, order, "refund started"); err != nil {
+		return err
+	}
+	if order.Payment != nil {
+		if err := payment.Refund(ctx, s.payments, order.Payment, rma.RefundTotal); err != nil {
+			rma.Status = models.ReturnReceived
+			if saveErr := s.saveReturns(ctx, order, "refund failed"); saveErr != nil {
+				log.Printf("Failed to reopen the refund of return %s: %v", rma.ID, saveErr)
+			}
+			return unavailable("payment_unavailable", err, "failed to refund payment for order %s", order.ID.Hex())
+		}
+	}
+
+	now := time.Now()
+	rma.Status = models.ReturnRefunded
+	rma.RefundedAt = &now
+	return s.saveReturns(ctx, order, fmt.Sprintf("refunded %.2f %s", rma.RefundTotal, order.Currency))
+}
+
+// saveReturns persists the return requests, the payment they refunded and the order status they imply
+func (s *OrderService) saveReturns(ctx context.Context, order *models.Order, reason string) error {
+	previousStatus := order.Status
+	order.Status = returnsOrderStatus(order)
+	order.UpdatedAt = time.Now()
+
+	set := bson.M{"returns": order.Returns, "status": order.Status, "updated_at": order.UpdatedAt}
+	if order.Payment != nil {
+		set["payment"] = order.Payment
+	}
+	update := bson.M{"$set": set}
+	if order.Status != previousStatus {
+		change := models.StatusChange{Status: order.Status, Reason: reason, ChangedAt: order.UpdatedAt}
+		order.History = append(order.History, change)
+		update["$push"] = bson.M{"status_history": change}
+	}
+
+	return s.updateOrder(ctx, order, update)
+}
+
+// restockReturn puts the items of the return that are not back in stock yet into inventory-service, marks
+// them restocked and saves the return RECEIVED. The return is saved RESTOCKING first, so a restock whose
+// outcome failed to save is never repeated. Items that fail stay pending, the first failure is returned.
+func (s *OrderService) restockReturn(ctx context.Context, order *models.Order, rma *models.ReturnRequest, reason string) error {
+	rma.Status = models.ReturnRestocking
+	if err := s.saveReturns(ctx, order, reason); err != nil {
+		return err
+	}
+
+	var restockErr error
+	for i := range rma.Items {
+		item := &rma.Items[i]
+		if item.Restocked {
+			continue
+		}
+		if err := s.restockProduct(order, item.ProductID, item.Quantity, "return "+rma.ID); err != nil {
+			log.Printf("Failed to restock %d units of %s for return %s: %v", item.Quantity, item.ProductID, rma.ID, err)
+			if restockErr == nil {
+				restockErr = unavailable("inventory_unavailable", err, "failed to restock product %s of return %s", item.ProductID, rma.ID)
+			}
+			continue
+		}
+		item.Restocked = true
+	}
+
+	rma.Status = models.ReturnReceived
+	if err := s.saveReturns(ctx, order, "returned items restocked"); err != nil {
+		return err
+	}
+	return restockErr
+}
+
+// restockProduct puts returned units of the order back into the inventory-service stock of the warehouse
+// they shipped from
+func (s *OrderService) restockProduct(order *models.Order, productID string, quantity int, reason string) error {
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+	return s.inventory.Restock(ctx, productID, shippedFrom(order, productID), quantity, reason, order.ID.Hex())
+}
+
+// shippedFrom returns the warehouse allocated to the order line of the product, returns go back there
+func shippedFrom(order *models.Order, productID string) string {
+	for _, item := range order.Items {
+		if item.ProductID == productID {
+			return item.WarehouseID
+		}
+	}
+	return ""
+}
+
+func findReturn(order *models.Order, returnID string) (*models.ReturnRequest, error) {
+	for i := range order.Returns {
+		if order.Returns[i].ID == returnID {
+			return &order.Returns[i], nil
+		}
+	}
+	return nil, notFound("return_not_found", "return not found")
+}
+
+// returnableQuantities returns the delivered quantity of every order line not already part of a return
+func returnableQuantities(order *models.Order) map[string]int {
+	returnable := make(map[string]int)
+	for _, item := range order.Items {
+		returnable[item.ProductID] += item.Quantity
+	}
+	for _, rma := range order.Returns {
+		if rma.Status == models.ReturnRejected {
+			continue
+		}
+		for _, item := range rma.Items {
+			returnable[item.ProductID] -= item.Quantity
+		}
+	}
+	return returnable
+}
+
+// returnsOrderStatus derives the status of a delivered order from its return requests
+func returnsOrderStatus(order *models.Order) models.OrderStatus {
+	status := models.Delivered
+	for _, rma := range order.Returns {
+		switch rma.Status {
+		case models.ReturnPending, models.ReturnApproved:
+			return models.ReturnRequested
+		case models.ReturnRestocking, models.ReturnReceived, models.ReturnRefunding:
+			status = models.Returned
+		case models.ReturnRefunded:
+			if status == models.Delivered {
+				status = models.Refunded
+			}
+		}
+	}
+	return status
+}
+
+// paidPrices returns the unit price paid for every product of the order, taxes charged on top of the prices
+// included
+func paidPrices(order *models.Order) map[string]float64 {
+	prices := netPrices(order)
+	if order.TaxInclusive {
+		return prices
+	}
+	quantities := make(map[string]int, len(order.Items))
+	for _, item := range order.Items {
+		quantities[item.ProductID] += item.Quantity
+	}
+	for _, t := range order.Taxes {
+		if quantities[t.ProductID] > 0 {
+			prices[t.ProductID] += t.Amount / float64(quantities[t.ProductID])
+		}
+	}
+	return prices
+}
+
+// netPrices returns the unit price of every product of the order once discounted. Discounts of a product lower
+// its price, discounts of the whole order are spread over the products by their share of the subtotal.
+func netPrices(order *models.Order) map[string]float64 {
+	var subtotal, orderDiscount float64
+	lineDiscount := make(map[string]float64)
+	for _, item := range order.Items {
+		subtotal += item.Price * float64(item.Quantity)
+	}
+	for _, d := range order.Discounts {
+		if d.ProductID != "" {
+			lineDiscount[d.ProductID] += d.Amount
+		} else {
+			orderDiscount += d.Amount
+		}
+	}
+
+	prices := make(map[string]float64, len(order.Items))
+	for _, item := range order.Items {
+		prices[item.ProductID] = item.Price
+		if item.Quantity == 0 || subtotal == 0 {
+			continue
+		}
+		amount := item.Price * float64(item.Quantity)
+		paid := amount - lineDiscount[item.ProductID] - orderDiscount*amount/subtotal
+		prices[item.ProductID] = math.Max(paid, 0) / float64(item.Quantity)
+	}
+	return prices
+}
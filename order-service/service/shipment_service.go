@@ -0,0 +1,269 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CreateShipment registers a shipment for some or all remaining line items of a fulfilment group of a
+// PROCESSING or PARTIALLY_SHIPPED order. When no items are given, every unshipped quantity of the group is
+// packed into the shipment.
+func (s *OrderService) CreateShipment(orderID string, shipment models.Shipment, ifMatch *int64) (*models.Shipment, error) {
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+
+	if shipment.Carrier == "" || shipment.TrackingNumber == "" {
+		return nil, invalidArgument("invalid_shipment", "carrier and tracking number are required")
+	}
+
+	order, err := s.findOrder(ctx, orderID, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != models.Processing && order.Status != models.PartiallyShipped {
+		return nil, conflict("invalid_order_state", "order in %s status cannot be shipped", order.Status)
+	}
+
+	group, err := shipmentGroup(order, &shipment)
+	if err != nil {
+		return nil, err
+	}
+	if group.Status != models.FulfilmentProcessing {
+		return nil, conflict("invalid_fulfilment_state", "fulfilment group in %s status cannot be shipped", group.Status)
+	}
+
+	remaining := unshippedInGroup(order, group)
+	if len(shipment.Items) == 0 {
+		for _, item := range group.Items {
+			if qty := remaining[item.ProductID]; qty > 0 {
+				shipment.Items = append(shipment.Items, models.ShipmentItem{ProductID: item.ProductID, Quantity: qty})
+				remaining[item.ProductID] = 0
+			}
+		}
+		if len(shipment.Items) == 0 {
+			return nil, conflict("invalid_order_state", "all items of the fulfilment group are already shipped")
+		}
+	} else {
+		for _, item := range shipment.Items {
+			if item.Quantity <= 0 {
+				return nil, invalidArgument("invalid_shipment", "invalid quantity for product %s", item.ProductID)
+			}
+			if item.Quantity > remaining[item.ProductID] {
+				return nil, invalidArgument("invalid_shipment", "product %s has only %d unshipped units", item.ProductID, remaining[item.ProductID])
+			}
+			remaining[item.ProductID] -= item.Quantity
+		}
+	}
+
+	for _, existing := range order.Shipments {
+		if existing.TrackingNumber == shipment.TrackingNumber {
+			return nil, conflict("duplicate_tracking_number", "tracking number %s is already used", shipment.TrackingNumber)
+		}
+	}
+
+	now := time.Now()
+	shipment.ID = uuid.NewString()
+	shipment.FulfilmentID = group.ID
+	shipment.Status = models.LabelCreated
+	shipment.CreatedAt = now
+	shipment.ShippedAt = nil
+	shipment.DeliveredAt = nil
+	shipment.Events = []models.TrackingEvent{{Status: models.LabelCreated, Description: "Shipment created", OccurredAt: now}}
+
+	err = s.updateOrder(ctx, order, bson.M{
+		"$push": bson.M{"shipments": shipment},
+		"$set":  bson.M{"updated_at": now},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		// carrier events find their order by tracking number, so it is unique across all tenants
+		return nil, conflict("duplicate_tracking_number", "tracking number %s is already used", shipment.TrackingNumber)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Shipment %s (%s %s) created for order %s", shipment.ID, shipment.Carrier, shipment.TrackingNumber, orderID)
+	return &shipment, nil
+}
+
+// HandleCarrierEvent records a carrier tracking event and advances the fulfilment groups and the order to
+// SHIPPED once every line item is with the carrier, and to DELIVERED once every shipment has been delivered.
+// Orders with only some groups shipped are PARTIALLY_SHIPPED. The payment is captured on the move to SHIPPED or
+// DELIVERED, a failed capture leaves the order untouched and is reported as unavailable for the carrier to retry.
+func (s *OrderService) HandleCarrierEvent(event models.CarrierEvent) (*models.Order, error) {
+	collection := GetCollection(s.collectionName)
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+
+	if event.TrackingNumber == "" {
+		return nil, invalidArgument("invalid_carrier_event", "tracking number is required")
+	}
+	switch event.Status {
+	case models.InTransit, models.OutForDelivery, models.ShipmentDelivered, models.ShipmentException:
+	default:
+		return nil, invalidArgument("invalid_carrier_event", "unsupported carrier status: %s", event.Status)
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	// Carriers do not know about tenants, tracking numbers are looked up across all of them and the order
+	// is then updated for its own tenant
+	var order models.Order
+	if err := collection.FindOne(ctx, bson.M{"shipments.tracking_number": event.TrackingNumber}).Decode(&order); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, notFound("shipment_not_found", "no shipment found for tracking number")
+		}
+		return nil, err
+	}
+	s = s.ForTenant(tenant.Tenant{ID: order.TenantID})
+
+	var pickedUp []*models.Shipment
+	for i := range order.Shipments {
+		shipment := &order.Shipments[i]
+		if shipment.TrackingNumber != event.TrackingNumber {
+			continue
+		}
+		if event.Carrier != "" && event.Carrier != shipment.Carrier {
+			return nil, invalidArgument("invalid_carrier_event", "carrier does not match shipment")
+		}
+		tracked := models.TrackingEvent{
+			Status:      event.Status,
+			Description: event.Description,
+			Location:    event.Location,
+			OccurredAt:  event.OccurredAt,
+		}
+		// Carriers redeliver events they got no answer for, the history keeps them once
+		if !hasTrackingEvent(shipment.Events, tracked) {
+			shipment.Events = append(shipment.Events, tracked)
+		}
+		// A delivered shipment never goes back in transit, late scans are only kept as history
+		if shipment.Status != models.ShipmentDelivered {
+			shipment.Status = event.Status
+		}
+		if shipment.ShippedAt == nil && event.Status != models.ShipmentException {
+			shipment.ShippedAt = &event.OccurredAt
+			pickedUp = append(pickedUp, shipment)
+		}
+		if event.Status == models.ShipmentDelivered && shipment.DeliveredAt == nil {
+			shipment.DeliveredAt = &event.OccurredAt
+		}
+	}
+
+	previousStatus := order.Status
+	order.UpdatedAt = time.Now()
+	order.Status = shipmentOrderStatus(&order, order.UpdatedAt)
+
+	set := bson.M{"shipments": order.Shipments, "status": order.Status, "updated_at": order.UpdatedAt}
+	if len(order.Fulfilments) > 0 {
+		set["fulfilments"] = order.Fulfilments
+	}
+	update := bson.M{"$set": set}
+	if order.Status != previousStatus {
+		change := models.StatusChange{Status: order.Status, Reason: "carrier event " + string(event.Status), ChangedAt: order.UpdatedAt}
+		order.History = append(order.History, change)
+		update["$push"] = bson.M{"status_history": change}
+	}
+
+	if err := s.updateOrder(ctx, &order, update); err != nil {
+		return nil, err
+	}
+
+	if order.Status != previousStatus {
+		log.Printf("Order %s moved from %s to %s", order.ID.Hex(), previousStatus, order.Status)
+	}
+	// The reserved stock of a shipment is committed once the carrier picked it up
+	for _, shipment := range pickedUp {
+		s.commitStock(&order, shipmentLines(&order, shipment))
+	}
+
+	// The payment is captured as soon as the goods have left the warehouses, only once the shipment is saved
+	// so a failed write never leaves a capture behind. A failed capture is retried with the carrier's
+	// redelivery of the event, the reloaded order is shipped already and its payment still authorized.
+	if order.Status == models.Shipped || order.Status == models.Delivered {
+		captured, err := s.capturePayment(ctx, &order)
+		if err != nil {
+			return nil, err
+		}
+		if captured {
+			if err := s.savePayment(ctx, &order); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &order, nil
+}
+
+// hasTrackingEvent reports whether events holds event, times compare at the millisecond precision MongoDB
+// stores them with
+func hasTrackingEvent(events []models.TrackingEvent, event models.TrackingEvent) bool {
+	for _, e := range events {
+		if e.Status == event.Status && e.OccurredAt.Truncate(time.Millisecond).Equal(event.OccurredAt.Truncate(time.Millisecond)) {
+			return true
+		}
+	}
+	return false
+}
+
+// shipmentOrderStatus updates the fulfilment groups from their shipments and derives the order status from
+// them: PARTIALLY_SHIPPED while only some groups left their warehouse, SHIPPED once all did and DELIVERED
+// once all arrived. Cancelled groups are left out.
+func shipmentOrderStatus(order *models.Order, now time.Time) models.OrderStatus {
+	switch order.Status {
+	case models.Processing, models.PartiallyShipped, models.Shipped:
+	default:
+		return order.Status
+	}
+
+	// Orders without groups are fulfilled as a whole
+	if len(order.Fulfilments) == 0 {
+		switch groupShippingStatus(order, &groupsOf(order)[0]) {
+		case models.FulfilmentDelivered:
+			return models.Delivered
+		case models.FulfilmentShipped:
+			return models.Shipped
+		default:
+			return order.Status
+		}
+	}
+
+	active, shipped, delivered := 0, 0, 0
+	for i := range order.Fulfilments {
+		group := &order.Fulfilments[i]
+		if group.Status == models.FulfilmentCancelled {
+			continue
+		}
+		if status := groupShippingStatus(order, group); status != group.Status {
+			group.Status = status
+			group.UpdatedAt = now
+		}
+
+		active++
+		switch group.Status {
+		case models.FulfilmentDelivered:
+			delivered++
+			shipped++
+		case models.FulfilmentShipped:
+			shipped++
+		}
+	}
+
+	switch {
+	case active > 0 && delivered == active:
+		return models.Delivered
+	case active > 0 && shipped == active:
+		return models.Shipped
+	case shipped > 0:
+		return models.PartiallyShipped
+	default:
+		return order.Status
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+)
+
+// reservedLines returns the stock the line items hold in inventory-service. Every line is reserved when the
+// order is placed, except backordered lines that still wait for stock: order-processor reserves those when
+// it releases them.
+func reservedLines(items []models.LineItem) []inventory.Line {
+	var lines []inventory.Line
+	for _, item := range items {
+		if item.Backorder.Waiting() {
+			continue
+		}
+		lines = append(lines, inventory.Line{ProductID: item.ProductID, WarehouseID: item.WarehouseID, Quantity: item.Quantity})
+	}
+	return lines
+}
+
+// shipmentLines returns the stock that leaves with a shipment, from the warehouse of each order line
+func shipmentLines(order *models.Order, shipment *models.Shipment) []inventory.Line {
+	lines := make([]inventory.Line, 0, len(shipment.Items))
+	for _, item := range shipment.Items {
+		lines = append(lines, inventory.Line{ProductID: item.ProductID, WarehouseID: shippedFrom(order, item.ProductID), Quantity: item.Quantity})
+	}
+	return lines
+}
+
+// withHeld returns the stock level of the product with the units the line item reserved added back, at the
+// warehouse it was allocated to
+func withHeld(level models.StockLevel, item models.LineItem) models.StockLevel {
+	if item.Backorder.Waiting() {
+		return level
+	}
+	held := models.StockLevel{Stock: level.Stock + item.Quantity, Warehouses: make([]models.WarehouseStock, len(level.Warehouses))}
+	copy(held.Warehouses, level.Warehouses)
+	for i := range held.Warehouses {
+		if item.WarehouseID != "" && held.Warehouses[i].WarehouseID == item.WarehouseID {
+			held.Warehouses[i].Stock += item.Quantity
+		}
+	}
+	return held
+}
+
+// changedLines compares the stock reserved for the old and the new line items of an amended order. It returns
+// the units to reserve on top and the units to give back, per product and warehouse.
+func changedLines(before, after []models.LineItem) (reserve []inventory.Line, release []inventory.Line) {
+	type key struct{ productID, warehouseID string }
+	delta := make(map[key]int)
+	var keys []key
+	add := func(lines []inventory.Line, sign int) {
+		for _, line := range lines {
+			k := key{line.ProductID, line.WarehouseID}
+			if _, ok := delta[k]; !ok {
+				keys = append(keys, k)
+			}
+			delta[k] += sign * line.Quantity
+		}
+	}
+	add(reservedLines(after), 1)
+	add(reservedLines(before), -1)
+
+	for _, k := range keys {
+		switch d := delta[k]; {
+		case d > 0:
+			reserve = append(reserve, inventory.Line{ProductID: k.productID, WarehouseID: k.warehouseID, Quantity: d})
+		case d < 0:
+			release = append(release, inventory.Line{ProductID: k.productID, WarehouseID: k.warehouseID, Quantity: -d})
+		}
+	}
+	return reserve, release
+}
+
+// reserveStock takes the lines of the order out of inventory-service stock, all or nothing. held is the stock
+// the order reserved before, nil for a new order.
+//
+// A failure other than a conflict may come after inventory-service took the stock. Releases for an order
+// never put back more than it holds, so the lines are released again, except those adding to stock the order
+// already held: releasing them would also give that stock away when the reservation did not happen.
+func (s *OrderService) reserveStock(ctx context.Context, order *models.Order, lines []inventory.Line, held []inventory.Line) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	err := s.inventory.Reserve(ctx, order.ID.Hex(), lines)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, inventory.ErrInsufficientStock):
+		return insufficientStock("insufficient stock for the order, it was taken by another order meanwhile")
+	case errors.Is(err, inventory.ErrProductNotFound):
+		return invalidArgument("product_not_found", "a product of the order does not exist")
+	default:
+		release, uncertain := splitHeld(lines, held)
+		s.releaseStock(order, release, "reservation failed")
+		if len(uncertain) > 0 {
+			log.Printf("Reservation of stock %+v for order %s may have been made: %v", uncertain, order.ID.Hex(), err)
+		}
+		return inventoryUnavailable(err)
+	}
+}
+
+// splitHeld separates the lines of products and warehouses the order holds no stock of from the others
+func splitHeld(lines []inventory.Line, held []inventory.Line) (fresh []inventory.Line, adding []inventory.Line) {
+	type key struct{ productID, warehouseID string }
+	holds := make(map[key]bool, len(held))
+	for _, line := range held {
+		holds[key{line.ProductID, line.WarehouseID}] = true
+	}
+	for _, line := range lines {
+		if holds[key{line.ProductID, line.WarehouseID}] {
+			adding = append(adding, line)
+		} else {
+			fresh = append(fresh, line)
+		}
+	}
+	return fresh, adding
+}
+
+// releaseStock gives stock reserved for the order back to inventory-service. The order has already changed,
+// so a failure is logged with the lines to release by hand rather than failing the request.
+func (s *OrderService) releaseStock(order *models.Order, lines []inventory.Line, reason string) {
+	if len(lines) == 0 {
+		return
+	}
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+	if err := s.inventory.Release(ctx, order.ID.Hex(), lines, reason); err != nil {
+		log.Printf("Failed to release stock %+v of order %s (%s): %v", lines, order.ID.Hex(), reason, err)
+	}
+}
+
+// commitStock records in the inventory-service ledger that reserved stock left with a shipment. It does not
+// change the stock, so a failure is only logged.
+func (s *OrderService) commitStock(order *models.Order, lines []inventory.Line) {
+	if len(lines) == 0 {
+		return
+	}
+	ctx, cancel := s.withTimeout(5 * time.Second)
+	defer cancel()
+	if err := s.inventory.Commit(ctx, order.ID.Hex(), lines); err != nil {
+		log.Printf("Failed to commit stock %+v of order %s: %v", lines, order.ID.Hex(), err)
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"math"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tax"
+)
+
+// WithTax returns the service charging the taxes p works out, orders are not taxed when it is nil
+func (s *OrderService) WithTax(p tax.Provider) *OrderService {
+	scoped := *s
+	scoped.tax = p
+	return &scoped
+}
+
+// applyTax works out the taxes of the order on what it pays for every line once discounted, and adds them to
+// its total unless the prices include them
+func (s *OrderService) applyTax(ctx context.Context, order *models.Order, products map[string]*models.Product) error {
+	order.Taxes = nil
+	order.TaxTotal = 0
+	order.TaxInclusive = false
+	if s.tax == nil {
+		return nil
+	}
+
+	prices := netPrices(order)
+	lines := make([]tax.Line, 0, len(order.Items))
+	for _, item := range order.Items {
+		line := tax.Line{ProductID: item.ProductID, Quantity: item.Quantity, Amount: math.Round(prices[item.ProductID]*float64(item.Quantity)*100) / 100}
+		if product := products[item.ProductID]; product != nil {
+			line.Category = product.Category
+		}
+		lines = append(lines, line)
+	}
+
+	taxes, err := s.tax.Calculate(ctx, order.Region, lines)
+	if err != nil {
+		return unavailable("tax_unavailable", err, "taxes of the order could not be calculated")
+	}
+	order.Taxes = taxes
+	order.TaxTotal = tax.Total(taxes)
+	order.TaxInclusive = s.tax.Inclusive()
+	if !order.TaxInclusive {
+		order.Total = math.Round((order.Total+order.TaxTotal)*100) / 100
+	}
+	return nil
+}
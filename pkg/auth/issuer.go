@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// NewClaims returns the claims of a token for role that expires after ttl
+func NewClaims(role, customerID, subject string, ttl time.Duration) Claims {
+	now := time.Now()
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		Role:       role,
+		CustomerID: customerID,
+	}
+}
+
+// SignHS256 issues a token signed with a shared secret
+func SignHS256(secret []byte, claims Claims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// SignRS256 issues a token signed with an RSA key published under kid in the JWKS
+func SignRS256(key *rsa.PrivateKey, kid string, claims Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key)
+}
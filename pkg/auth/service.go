@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/problem"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RoleService is the role of internal callers authenticated with a service key or client certificate. It
+// cannot be claimed by a JWT.
+const RoleService = "service"
+
+// ServiceKeyHeader carries the service key of internal HTTP calls, gRPC calls use the lower case metadata key
+const ServiceKeyHeader = "X-Service-Key"
+
+const serviceKeyMetadata = "x-service-key"
+
+// KeyReloadInterval is how often a key ring file is checked for rotated keys
+const KeyReloadInterval = 30 * time.Second
+
+// ServiceKey is an entry of the key ring file. Keys are rotated by adding the new key, moving the callers
+// over and then removing the old key or letting it expire.
+type ServiceKey struct {
+	ID        string     `json:"id"`
+	Key       string     `json:"key"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type ringKey struct {
+	id      string
+	digest  [sha256.Size]byte
+	expires time.Time
+}
+
+// KeyRing holds the service keys a server accepts, several keys are valid at the same time during a rotation
+type KeyRing struct {
+	path string
+
+	mu      sync.RWMutex
+	keys    []ringKey
+	modTime time.Time
+}
+
+// LoadKeyRing reads a JSON key ring file: {"keys": [{"id": "2025-06", "key": "...", "expires_at": "..."}]}
+func LoadKeyRing(path string) (*KeyRing, error) {
+	k := &KeyRing{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// KeyRingFromEnv loads the key ring of SERVICE_KEYS_FILE, nil when it is not set
+func KeyRingFromEnv() *KeyRing {
+	path := os.Getenv("SERVICE_KEYS_FILE")
+	if path == "" {
+		return nil
+	}
+	keys, err := LoadKeyRing(path)
+	if err != nil {
+		log.Fatalf("Failed to load service keys: %v", err)
+	}
+	return keys
+}
+
+// RequireServiceAuth stops a service whose internal API would be open to any pod, i.e. neither service
+// keys nor mTLS are configured, unless AUTH_DISABLED=true
+func RequireServiceAuth(keys *KeyRing, mTLS bool) {
+	if keys != nil || mTLS {
+		return
+	}
+	if os.Getenv("AUTH_DISABLED") != "true" {
+		log.Fatal("SERVICE_KEYS_FILE or SERVICE_TLS_CERT and SERVICE_TLS_CA not specified, set AUTH_DISABLED=true to run without service authentication")
+	}
+	log.Println("WARNING: service authentication is disabled")
+}
+
+// Reload re-reads the key ring file when it changed since the last load
+func (k *KeyRing) Reload() error {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return fmt.Errorf("failed to read service keys: %w", err)
+	}
+	k.mu.RLock()
+	unchanged := info.ModTime().Equal(k.modTime)
+	k.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return fmt.Errorf("failed to read service keys: %w", err)
+	}
+	var file struct {
+		Keys []ServiceKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse service keys: %w", err)
+	}
+
+	keys := make([]ringKey, 0, len(file.Keys))
+	for _, key := range file.Keys {
+		if key.ID == "" || len(key.Key) < 16 {
+			return fmt.Errorf("service key %q needs an id and at least 16 characters", key.ID)
+		}
+		entry := ringKey{id: key.ID, digest: sha256.Sum256([]byte(key.Key))}
+		if key.ExpiresAt != nil {
+			entry.expires = *key.ExpiresAt
+		}
+		keys = append(keys, entry)
+	}
+	if len(keys) == 0 {
+		return errors.New("no service keys configured")
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.modTime = info.ModTime()
+	k.mu.Unlock()
+	log.Printf("Loaded %d service keys", len(keys))
+	return nil
+}
+
+// Watch reloads the key ring every interval until ctx is done, so a rotated secret is picked up without a restart
+func (k *KeyRing) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Reload(); err != nil {
+				log.Printf("Keeping the previous service keys: %v", err)
+			}
+		}
+	}
+}
+
+// Verify returns the id of the key, keys past their expiry are refused
+func (k *KeyRing) Verify(key string) (string, bool) {
+	digest := sha256.Sum256([]byte(key))
+	now := time.Now()
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	id, ok := "", false
+	for _, entry := range k.keys {
+		// Every key is compared so the timing does not reveal which one matched
+		if subtle.ConstantTimeCompare(digest[:], entry.digest[:]) == 1 && (entry.expires.IsZero() || now.Before(entry.expires)) {
+			id, ok = entry.id, true
+		}
+	}
+	return id, ok
+}
+
+func serviceClaims(id string) *Claims {
+	claims := &Claims{Role: RoleService}
+	claims.Subject = id
+	return claims
+}
+
+// ServiceOr authenticates internal callers by their service key and hands other requests to guard, e.g. an
+// admin-only Require. A wrong key is rejected outright. A nil key ring only applies guard.
+func ServiceOr(keys *KeyRing, guard func(http.HandlerFunc) http.HandlerFunc) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		guarded := guard(next)
+		if keys == nil {
+			return guarded
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(ServiceKeyHeader)
+			if key == "" {
+				guarded(w, r)
+				return
+			}
+			id, ok := keys.Verify(key)
+			if !ok {
+				log.Printf("Rejected invalid service key on %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+				problem.Write(w, r, http.StatusUnauthorized, "invalid_service_key", "the service key is not valid")
+				return
+			}
+			next(w, r.WithContext(NewContext(r.Context(), serviceClaims(id))))
+		}
+	}
+}
+
+// ServiceUnaryInterceptor only admits internal callers to a gRPC server: peers that presented a verified
+// client certificate (mTLS) or calls with a valid service key. Authentication is disabled when there are
+// neither keys nor mTLS, which requires AUTH_DISABLED=true in the services.
+func ServiceUnaryInterceptor(keys *KeyRing, mTLS bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if p, ok := peer.FromContext(ctx); ok {
+			if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+				return handler(NewContext(ctx, serviceClaims(tlsInfo.State.PeerCertificates[0].Subject.CommonName)), req)
+			}
+		}
+		if keys == nil {
+			if mTLS {
+				return nil, status.Error(codes.Unauthenticated, "a client certificate is required")
+			}
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(serviceKeyMetadata)
+		if len(values) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "a service key or client certificate is required")
+		}
+		id, ok := keys.Verify(values[0])
+		if !ok {
+			log.Printf("Rejected invalid service key on %s", info.FullMethod)
+			return nil, status.Error(codes.Unauthenticated, "the service key is not valid")
+		}
+		return handler(NewContext(ctx, serviceClaims(id)), req)
+	}
+}
+
+// ServiceKeyCredentials attaches a service key to every gRPC call
+type ServiceKeyCredentials struct {
+	Key string
+	// TLS is set when the channel is encrypted, keys are otherwise sent in the clear within the cluster
+	TLS bool
+}
+
+func (c ServiceKeyCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{serviceKeyMetadata: c.Key}, nil
+}
+
+func (c ServiceKeyCredentials) RequireTransportSecurity() bool {
+	return c.TLS
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config selects the keys tokens are verified with. HS256 tokens are checked with HMACSecret, RS256 tokens
+// with the public key of their kid in the JWKS file.
+type Config struct {
+	HMACSecret []byte
+	JWKSFile   string
+	// Issuer and Audience are enforced when set
+	Issuer   string
+	Audience string
+}
+
+// ConfigFromEnv reads AUTH_HS256_SECRET, AUTH_JWKS_FILE, AUTH_ISSUER and AUTH_AUDIENCE
+func ConfigFromEnv() Config {
+	return Config{
+		HMACSecret: []byte(os.Getenv("AUTH_HS256_SECRET")),
+		JWKSFile:   os.Getenv("AUTH_JWKS_FILE"),
+		Issuer:     os.Getenv("AUTH_ISSUER"),
+		Audience:   os.Getenv("AUTH_AUDIENCE"),
+	}
+}
+
+// VerifierFromEnv builds the verifier of a service. Running without keys requires AUTH_DISABLED=true so
+// an unprotected deployment is always deliberate, nil is returned in that case.
+func VerifierFromEnv() *Verifier {
+	cfg := ConfigFromEnv()
+	if len(cfg.HMACSecret) == 0 && cfg.JWKSFile == "" {
+		if os.Getenv("AUTH_DISABLED") != "true" {
+			log.Fatal("AUTH_HS256_SECRET or AUTH_JWKS_FILE not specified, set AUTH_DISABLED=true to run without authentication")
+		}
+		log.Println("WARNING: authentication is disabled")
+		return nil
+	}
+
+	v, err := NewVerifier(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
+	return v
+}
+
+// Verifier validates bearer tokens
+type Verifier struct {
+	secret  []byte
+	keys    map[string]*rsa.PublicKey
+	options []jwt.ParserOption
+}
+
+func NewVerifier(cfg Config) (*Verifier, error) {
+	v := &Verifier{secret: cfg.HMACSecret}
+	if cfg.JWKSFile != "" {
+		keys, err := LoadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+	}
+	if len(v.secret) == 0 && len(v.keys) == 0 {
+		return nil, errors.New("no verification key configured")
+	}
+
+	v.options = []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if cfg.Issuer != "" {
+		v.options = append(v.options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		v.options = append(v.options, jwt.WithAudience(cfg.Audience))
+	}
+	return v, nil
+}
+
+// Verify checks the signature, expiry, issuer and audience of a token and returns its claims
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	claims := &Claims{}
+	if _, err := jwt.ParseWithClaims(token, claims, v.key, v.options...); err != nil {
+		return nil, err
+	}
+
+	switch claims.Role {
+	case RoleCustomer:
+		if claims.CustomerID == "" {
+			return nil, errors.New("customer token without customer_id")
+		}
+	case RoleSupport, RoleAdmin:
+	default:
+		return nil, fmt.Errorf("unknown role %q", claims.Role)
+	}
+	return claims, nil
+}
+
+// key picks the verification key matching the algorithm of the token
+func (v *Verifier) key(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		if len(v.secret) == 0 {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return v.secret, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := token.Header["kid"].(string)
+		key, ok := v.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+}
+
+// JWK is an RSA public key of a JSON Web Key Set
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadJWKS reads the RSA public keys of a JWKS file by key id
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key %s: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent of key %s: %w", k.Kid, err)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no RSA keys")
+	}
+	return keys, nil
+}
+
+// PublicJWK describes an RSA public key for a JWKS file
+func PublicJWK(kid string, key *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: jwt.SigningMethodRS256.Alg(),
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
@@ -0,0 +1,92 @@
+package etag
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidIfMatch is returned for an If-Match header that is not a list of ETags
+	ErrInvalidIfMatch = errors.New("invalid If-Match header")
+	// ErrNoStrongETag is returned when If-Match lists no strong ETag of a version, so it matches no document
+	ErrNoStrongETag = errors.New("If-Match lists no strong ETag")
+)
+
+// Format returns the strong ETag of a document version
+func Format(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Set writes the ETag header of a document version
+func Set(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", Format(version))
+}
+
+// IfMatch returns the document version required by the If-Match header of the request.
+// It returns nil when the header is absent or "*".
+//
+// The header may list several ETags. If-Match uses the strong comparison (RFC 7232 §3.1), so weak ETags and
+// ETags of no version never match and are skipped. When the others name different versions, current is asked
+// for the version the document has now and the listed one matching it is required, the first listed one when
+// none does.
+func IfMatch(r *http.Request, current func() (int64, error)) (*int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return nil, nil
+	}
+
+	var versions []int64
+	for _, tag := range strings.Split(value, ",") {
+		version, ok, err := parse(strings.TrimSpace(tag))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, ErrNoStrongETag
+	}
+
+	for _, version := range versions[1:] {
+		if version != versions[0] {
+			return match(versions, current), nil
+		}
+	}
+	return &versions[0], nil
+}
+
+// parse reads the version of an ETag, ok is false for weak ETags and ETags that name no version. Anything but
+// an ETag is an ErrInvalidIfMatch.
+func parse(tag string) (version int64, ok bool, err error) {
+	opaque, weak := strings.CutPrefix(tag, "W/")
+	if len(opaque) < 2 || !strings.HasPrefix(opaque, `"`) || !strings.HasSuffix(opaque, `"`) || strings.Contains(opaque[1:len(opaque)-1], `"`) {
+		return 0, false, ErrInvalidIfMatch
+	}
+	if weak {
+		return 0, false, nil
+	}
+	version, err = strconv.ParseInt(opaque[1:len(opaque)-1], 10, 64)
+	if err != nil {
+		return 0, false, nil
+	}
+	return version, true, nil
+}
+
+// match returns the listed version the document currently has. The write stays conditioned on it, so a
+// concurrent change between the lookup and the write still fails the precondition.
+func match(versions []int64, current func() (int64, error)) *int64 {
+	if current != nil {
+		if version, err := current(); err == nil {
+			for i := range versions {
+				if versions[i] == version {
+					return &versions[i]
+				}
+			}
+		}
+	}
+	return &versions[0]
+}
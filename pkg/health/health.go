@@ -0,0 +1,184 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout bounds every check of a probe
+const DefaultTimeout = 2 * time.Second
+
+// Probe statuses
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+// CheckFunc verifies a dependency, it must give up once ctx is done
+type CheckFunc func(ctx context.Context) error
+
+// Result is the outcome of a single check
+type Result struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// Report is the body of /healthz and /readyz
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]Result      `json:"checks,omitempty"`
+	Info   map[string]interface{} `json:"info,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check CheckFunc
+}
+
+// Health serves the liveness (/healthz) and readiness (/readyz) probes of a service. Liveness only covers
+// the process itself, so an outage of a dependency makes the pod unready instead of restarting it.
+type Health struct {
+	timeout time.Duration
+
+	mu        sync.RWMutex
+	liveness  []namedCheck
+	readiness []namedCheck
+	info      map[string]func() interface{}
+
+	draining atomic.Bool
+}
+
+// New returns probes whose checks are bounded by timeout (DefaultTimeout when zero)
+func New(timeout time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Health{timeout: timeout, info: map[string]func() interface{}{}}
+}
+
+// AddLiveness registers a check run by /healthz
+func (h *Health) AddLiveness(name string, check CheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness = append(h.liveness, namedCheck{name: name, check: check})
+}
+
+// AddReadiness registers a check run by /readyz, typically a ping of MongoDB or Redis
+func (h *Health) AddReadiness(name string, check CheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness = append(h.readiness, namedCheck{name: name, check: check})
+}
+
+// AddInfo reports the value returned by fn under info in both probes
+func (h *Health) AddInfo(name string, fn func() interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.info[name] = fn
+}
+
+// Drain makes /readyz fail so the pod is taken out of load balancing while it shuts down
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Live handles GET /healthz
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	checks := h.liveness
+	h.mu.RUnlock()
+
+	h.write(w, h.run(r.Context(), checks))
+}
+
+// Ready handles GET /readyz
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	checks := h.readiness
+	h.mu.RUnlock()
+
+	report := h.run(r.Context(), checks)
+	if h.draining.Load() {
+		report.Status = StatusDraining
+	}
+	h.write(w, report)
+}
+
+// run executes the checks concurrently, each with its own timeout
+func (h *Health) run(ctx context.Context, checks []namedCheck) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.check(checkCtx)
+			result := Result{Status: StatusOK, LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = StatusUnavailable
+				result.Error = err.Error()
+				if errors.Is(checkCtx.Err(), context.DeadlineExceeded) {
+					result.Error = "timed out after " + h.timeout.String()
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = result
+			if err != nil {
+				report.Status = StatusUnavailable
+			}
+		}()
+	}
+	wg.Wait()
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.info) > 0 {
+		report.Info = make(map[string]interface{}, len(h.info))
+		for name, fn := range h.info {
+			report.Info[name] = fn()
+		}
+	}
+	return report
+}
+
+func (h *Health) write(w http.ResponseWriter, report Report) {
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// DrainDelayFromEnv reads SHUTDOWN_DRAIN_DELAY, how long a service keeps serving after it turned unready
+// so the load balancers notice before the listener closes. Defaults to 5s.
+func DrainDelayFromEnv() time.Duration {
+	v := os.Getenv("SHUTDOWN_DRAIN_DELAY")
+	if v == "" {
+		return 5 * time.Second
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Fatalf("invalid SHUTDOWN_DRAIN_DELAY: %s", v)
+	}
+	return d
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// BackorderMode tells how a product keeps selling once its stock runs out
+type BackorderMode string
+
+const (
+	// Backorder accepts orders for a product that is temporarily out of stock
+	Backorder BackorderMode = "BACKORDER"
+	// PreOrder accepts orders for a product that is not released yet
+	PreOrder BackorderMode = "PRE_ORDER"
+)
+
+// BackorderPolicy lets a product be ordered beyond its stock. AvailableAt is when the product is expected
+// to be in stock, it is only informative.
+type BackorderPolicy struct {
+	Mode        BackorderMode `bson:"mode" json:"mode"`
+	AvailableAt *time.Time    `bson:"available_at,omitempty" json:"available_at,omitempty"`
+}
+
+// BackorderLine marks an order line accepted without stock. The line waits for a restock until ReleasedAt
+// is set.
+type BackorderLine struct {
+	Mode        BackorderMode `bson:"mode" json:"mode"`
+	AvailableAt *time.Time    `bson:"available_at,omitempty" json:"available_at,omitempty"`
+	ReleasedAt  *time.Time    `bson:"released_at,omitempty" json:"released_at,omitempty"`
+}
+
+// Waiting reports whether the line still waits for stock
+func (l *BackorderLine) Waiting() bool {
+	return l != nil && l.ReleasedAt == nil
+}
+
+// WaitingForStock reports whether any of the lines still waits for stock
+func WaitingForStock(items []LineItem) bool {
+	for _, item := range items {
+		if item.Backorder.Waiting() {
+			return true
+		}
+	}
+	return false
+}
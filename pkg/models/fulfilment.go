@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FulfilmentStatus type defines the states of a fulfilment group
+type FulfilmentStatus string
+
+const (
+	FulfilmentPending    FulfilmentStatus = "PENDING"
+	FulfilmentProcessing FulfilmentStatus = "PROCESSING"
+	FulfilmentShipped    FulfilmentStatus = "SHIPPED"
+	FulfilmentDelivered  FulfilmentStatus = "DELIVERED"
+	FulfilmentCancelled  FulfilmentStatus = "CANCELLED"
+)
+
+// FulfilmentGroup is the sub-order of the lines allocated to one warehouse. Each group is processed, shipped
+// and tracked on its own, the order status aggregates the status of its groups. Orders placed before groups
+// existed have none and are fulfilled as a whole.
+type FulfilmentGroup struct {
+	ID          string           `bson:"id" json:"id"`
+	WarehouseID string           `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"`
+	Items       []ShipmentItem   `bson:"items" json:"items"`
+	Status      FulfilmentStatus `bson:"status" json:"status"`
+	UpdatedAt   time.Time        `bson:"updated_at" json:"updated_at"`
+}
+
+// FulfilmentGroups splits the order lines into a group per allocated warehouse. A group of previous keeps
+// its id while its warehouse still fulfils lines of the order.
+func FulfilmentGroups(items []LineItem, previous []FulfilmentGroup, now time.Time) []FulfilmentGroup {
+	ids := make(map[string]string, len(previous))
+	for _, group := range previous {
+		ids[group.WarehouseID] = group.ID
+	}
+
+	var groups []FulfilmentGroup
+	byWarehouse := make(map[string]int)
+	for _, item := range items {
+		i, ok := byWarehouse[item.WarehouseID]
+		if !ok {
+			id := ids[item.WarehouseID]
+			if id == "" {
+				id = uuid.NewString()
+			}
+			groups = append(groups, FulfilmentGroup{ID: id, WarehouseID: item.WarehouseID, Status: FulfilmentPending, UpdatedAt: now})
+			i = len(groups) - 1
+			byWarehouse[item.WarehouseID] = i
+		}
+		groups[i].Items = append(groups[i].Items, ShipmentItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+	return groups
+}
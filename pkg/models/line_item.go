@@ -5,4 +5,8 @@ type LineItem struct {
 	ProductID string  `bson:"product_id" json:"product_id"`
 	Quantity  int     `bson:"quantity" json:"quantity"`
 	Price     float64 `bson:"price" json:"price"`
+	// WarehouseID is the warehouse allocated to fulfil the line, empty for products without warehouses
+	WarehouseID string `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"`
+	// Backorder is set on lines accepted while the product was out of stock
+	Backorder *BackorderLine `bson:"backorder,omitempty" json:"backorder,omitempty"`
 }
@@ -6,12 +6,30 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Order represents a customer order
+// Order represents a customer order. Total is what the customer pays, Subtotal the price of the items before
+// the discounts and taxes. TaxTotal is part of Total, added on top of the prices unless TaxInclusive.
 type Order struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	CustomerID string             `bson:"customer_id" json:"customer_id"`
-	Items      []LineItem         `bson:"items" json:"items"`
-	Status     OrderStatus        `bson:"status" json:"status"`
-	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID     string             `bson:"tenant_id,omitempty" json:"-"`
+	CustomerID   string             `bson:"customer_id" json:"customer_id"`
+	Items        []LineItem         `bson:"items" json:"items"`
+	Subtotal     float64            `bson:"subtotal,omitempty" json:"subtotal,omitempty"`
+	CouponCodes  []string           `bson:"coupon_codes,omitempty" json:"coupon_codes,omitempty"`
+	Discounts    []DiscountLine     `bson:"discounts,omitempty" json:"discounts,omitempty"`
+	Taxes        []TaxLine          `bson:"taxes,omitempty" json:"taxes,omitempty"`
+	TaxTotal     float64            `bson:"tax_total,omitempty" json:"tax_total,omitempty"`
+	TaxInclusive bool               `bson:"tax_inclusive,omitempty" json:"tax_inclusive,omitempty"`
+	Total        float64            `bson:"total" json:"total"`
+	Currency     string             `bson:"currency" json:"currency"`
+	Region       string             `bson:"region,omitempty" json:"region,omitempty"`
+	ShipTo       *Location          `bson:"ship_to,omitempty" json:"ship_to,omitempty"`
+	Status       OrderStatus        `bson:"status" json:"status"`
+	Version      int64              `bson:"version" json:"version"`
+	Payment      *Payment           `bson:"payment,omitempty" json:"payment,omitempty"`
+	Fulfilments  []FulfilmentGroup  `bson:"fulfilments,omitempty" json:"fulfilments,omitempty"`
+	Shipments    []Shipment         `bson:"shipments,omitempty" json:"shipments,omitempty"`
+	Returns      []ReturnRequest    `bson:"returns,omitempty" json:"returns,omitempty"`
+	History      []StatusChange     `bson:"status_history,omitempty" json:"status_history,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
 }
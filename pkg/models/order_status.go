@@ -1,12 +1,26 @@
 package models
 
+import "time"
+
 // OrderStatus type defines allowed statuses
 type OrderStatus string
 
 const (
-	Pending    OrderStatus = "PENDING"
-	Processing OrderStatus = "PROCESSING"
-	Shipped    OrderStatus = "SHIPPED"
-	Delivered  OrderStatus = "DELIVERED"
-	Cancelled  OrderStatus = "CANCELLED"
+	Backordered      OrderStatus = "BACKORDERED"
+	Pending          OrderStatus = "PENDING"
+	Processing       OrderStatus = "PROCESSING"
+	PartiallyShipped OrderStatus = "PARTIALLY_SHIPPED"
+	Shipped          OrderStatus = "SHIPPED"
+	Delivered        OrderStatus = "DELIVERED"
+	Cancelled        OrderStatus = "CANCELLED"
+	ReturnRequested  OrderStatus = "RETURN_REQUESTED"
+	Returned         OrderStatus = "RETURNED"
+	Refunded         OrderStatus = "REFUNDED"
 )
+
+// StatusChange is an entry of the order status history
+type StatusChange struct {
+	Status    OrderStatus `bson:"status" json:"status"`
+	Reason    string      `bson:"reason,omitempty" json:"reason,omitempty"`
+	ChangedAt time.Time   `bson:"changed_at" json:"changed_at"`
+}
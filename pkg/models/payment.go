@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// PaymentStatus type defines allowed payment states
+type PaymentStatus string
+
+const (
+	PaymentAuthorized PaymentStatus = "AUTHORIZED"
+	PaymentDeclined   PaymentStatus = "DECLINED"
+	PaymentCaptured   PaymentStatus = "CAPTURED"
+	PaymentRefunded   PaymentStatus = "REFUNDED"
+	PaymentVoided     PaymentStatus = "VOIDED"
+)
+
+// Payment represents the payment record of an order
+type Payment struct {
+	Provider       string        `bson:"provider" json:"provider"`
+	TransactionID  string        `bson:"transaction_id,omitempty" json:"transaction_id,omitempty"`
+	Amount         float64       `bson:"amount" json:"amount"`
+	Currency       string        `bson:"currency" json:"currency"`
+	Status         PaymentStatus `bson:"status" json:"status"`
+	FailureReason  string        `bson:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	RefundedAmount float64       `bson:"refunded_amount,omitempty" json:"refunded_amount,omitempty"`
+	AuthorizedAt   *time.Time    `bson:"authorized_at,omitempty" json:"authorized_at,omitempty"`
+	CapturedAt     *time.Time    `bson:"captured_at,omitempty" json:"captured_at,omitempty"`
+	RefundedAt     *time.Time    `bson:"refunded_at,omitempty" json:"refunded_at,omitempty"`
+	UpdatedAt      time.Time     `bson:"updated_at" json:"updated_at"`
+}
@@ -11,4 +11,14 @@ type Product struct {
 	Category    string  `json:"category"`
 	Brand       string  `json:"brand"`
 	Rating      float64 `json:"rating"`
+	Version     int64   `json:"version"`
+	TenantID    string  `bson:"tenant_id,omitempty" json:"-"`
+	// Warehouses breaks Stock down by the warehouses holding it, Stock is always the total
+	Warehouses []WarehouseStock `bson:"warehouses,omitempty" json:"warehouses,omitempty"`
+	// Thresholds are the reorder points of the product, the inventory defaults apply when they are not set
+	Thresholds *StockThresholds `bson:"thresholds,omitempty" json:"thresholds,omitempty"`
+	// StockStatus is the status the low-stock checker last alerted about
+	StockStatus StockStatus `bson:"stock_status,omitempty" json:"-"`
+	// Backorder lets the product be ordered beyond its stock
+	Backorder *BackorderPolicy `bson:"backorder,omitempty" json:"backorder,omitempty"`
 }
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PromotionType is the rule a promotion discounts by
+type PromotionType string
+
+const (
+	// PercentOff takes Percent percent off the matching lines
+	PercentOff PromotionType = "PERCENT_OFF"
+	// AmountOff takes Amount off the matching lines, at most their total
+	AmountOff PromotionType = "AMOUNT_OFF"
+	// BuyXGetY gives GetQuantity units for free for every BuyQuantity units bought of a matching product
+	BuyXGetY PromotionType = "BUY_X_GET_Y"
+)
+
+// Promotion is a discount rule. Promotions with a Code are coupons that only apply to orders naming them,
+// the others apply to every order they match. ProductIDs, Categories and Brands restrict the lines a
+// promotion discounts, a line matching any of them qualifies and no restriction means every line does.
+type Promotion struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID    string             `bson:"tenant_id,omitempty" json:"-"`
+	Name        string             `bson:"name" json:"name"`
+	Code        string             `bson:"code,omitempty" json:"code,omitempty"`
+	Type        PromotionType      `bson:"type" json:"type"`
+	Percent     float64            `bson:"percent,omitempty" json:"percent,omitempty"`
+	Amount      float64            `bson:"amount,omitempty" json:"amount,omitempty"`
+	BuyQuantity int                `bson:"buy_quantity,omitempty" json:"buy_quantity,omitempty"`
+	GetQuantity int                `bson:"get_quantity,omitempty" json:"get_quantity,omitempty"`
+	ProductIDs  []string           `bson:"product_ids,omitempty" json:"product_ids,omitempty"`
+	Categories  []string           `bson:"categories,omitempty" json:"categories,omitempty"`
+	Brands      []string           `bson:"brands,omitempty" json:"brands,omitempty"`
+	// MinSubtotal is the amount the matching lines must reach for the promotion to apply
+	MinSubtotal float64 `bson:"min_subtotal,omitempty" json:"min_subtotal,omitempty"`
+	// Stackable promotions combine with each other, the others only apply on their own
+	Stackable bool `bson:"stackable" json:"stackable"`
+	// UsageLimit caps how many orders may redeem the promotion, 0 means no limit
+	UsageLimit int        `bson:"usage_limit,omitempty" json:"usage_limit,omitempty"`
+	UsageCount int        `bson:"usage_count" json:"usage_count"`
+	StartsAt   *time.Time `bson:"starts_at,omitempty" json:"starts_at,omitempty"`
+	ExpiresAt  *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	Active     bool       `bson:"active" json:"active"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+}
+
+// DiscountLine is a discount granted to an order. Discounts of a single product name it, the others
+// apply to the whole order.
+type DiscountLine struct {
+	PromotionID string  `bson:"promotion_id" json:"promotion_id"`
+	Code        string  `bson:"code,omitempty" json:"code,omitempty"`
+	Description string  `bson:"description" json:"description"`
+	ProductID   string  `bson:"product_id,omitempty" json:"product_id,omitempty"`
+	Amount      float64 `bson:"amount" json:"amount"`
+}
+
+// OrderQuote is what an order would cost, worked out without placing it
+type OrderQuote struct {
+	Items        []LineItem     `json:"items"`
+	Subtotal     float64        `json:"subtotal"`
+	Discounts    []DiscountLine `json:"discounts"`
+	Taxes        []TaxLine      `json:"taxes"`
+	TaxTotal     float64        `json:"tax_total"`
+	TaxInclusive bool           `json:"tax_inclusive"`
+	Total        float64        `json:"total"`
+	Currency     string         `json:"currency"`
+	Region       string         `json:"region,omitempty"`
+	CouponCodes  []string       `json:"coupon_codes,omitempty"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// ReturnStatus type defines the states of a return request (RMA)
+type ReturnStatus string
+
+const (
+	ReturnPending  ReturnStatus = "REQUESTED"
+	ReturnApproved ReturnStatus = "APPROVED"
+	ReturnRejected ReturnStatus = "REJECTED"
+	ReturnReceived ReturnStatus = "RECEIVED"
+	ReturnRefunded ReturnStatus = "REFUNDED"
+	// ReturnRestocking and ReturnRefunding are saved before inventory-service or the payment gateway is
+	// called. A return left in them lost the outcome of that call and is not retried automatically.
+	ReturnRestocking ReturnStatus = "RESTOCKING"
+	ReturnRefunding  ReturnStatus = "REFUNDING"
+)
+
+// ReturnItem is an order line the customer sends back
+type ReturnItem struct {
+	ProductID    string  `bson:"product_id" json:"product_id"`
+	Quantity     int     `bson:"quantity" json:"quantity"`
+	Reason       string  `bson:"reason" json:"reason"`
+	RefundAmount float64 `bson:"refund_amount" json:"refund_amount"`
+	Restocked    bool    `bson:"restocked" json:"restocked"`
+}
+
+// ReturnRequest represents a return merchandise authorization for some line items of an order
+type ReturnRequest struct {
+	ID          string       `bson:"id" json:"id"`
+	Items       []ReturnItem `bson:"items" json:"items"`
+	Status      ReturnStatus `bson:"status" json:"status"`
+	Note        string       `bson:"note,omitempty" json:"note,omitempty"`
+	RefundTotal float64      `bson:"refund_total" json:"refund_total"`
+	RequestedAt time.Time    `bson:"requested_at" json:"requested_at"`
+	DecidedAt   *time.Time   `bson:"decided_at,omitempty" json:"decided_at,omitempty"`
+	ReceivedAt  *time.Time   `bson:"received_at,omitempty" json:"received_at,omitempty"`
+	RefundedAt  *time.Time   `bson:"refunded_at,omitempty" json:"refunded_at,omitempty"`
+}
+
+// Restocked reports whether every item of the return is back in stock
+func (r *ReturnRequest) Restocked() bool {
+	for _, item := range r.Items {
+		if !item.Restocked {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// ShipmentStatus type defines the carrier states of a shipment
+type ShipmentStatus string
+
+const (
+	LabelCreated      ShipmentStatus = "LABEL_CREATED"
+	InTransit         ShipmentStatus = "IN_TRANSIT"
+	OutForDelivery    ShipmentStatus = "OUT_FOR_DELIVERY"
+	ShipmentDelivered ShipmentStatus = "DELIVERED"
+	ShipmentException ShipmentStatus = "EXCEPTION"
+)
+
+// ShipmentItem is the quantity of an order line packed in a shipment
+type ShipmentItem struct {
+	ProductID string `bson:"product_id" json:"product_id"`
+	Quantity  int    `bson:"quantity" json:"quantity"`
+}
+
+// TrackingEvent is a single carrier scan of a shipment
+type TrackingEvent struct {
+	Status      ShipmentStatus `bson:"status" json:"status"`
+	Description string         `bson:"description,omitempty" json:"description,omitempty"`
+	Location    string         `bson:"location,omitempty" json:"location,omitempty"`
+	OccurredAt  time.Time      `bson:"occurred_at" json:"occurred_at"`
+}
+
+// Shipment represents a parcel handed to a carrier for (part of) an order
+type Shipment struct {
+	ID string `bson:"id" json:"id"`
+	// FulfilmentID is the fulfilment group the shipment belongs to, empty for orders without groups
+	FulfilmentID   string          `bson:"fulfilment_id,omitempty" json:"fulfilment_id,omitempty"`
+	Carrier        string          `bson:"carrier" json:"carrier"`
+	TrackingNumber string          `bson:"tracking_number" json:"tracking_number"`
+	Items          []ShipmentItem  `bson:"items" json:"items"`
+	Status         ShipmentStatus  `bson:"status" json:"status"`
+	Events         []TrackingEvent `bson:"events" json:"events"`
+	CreatedAt      time.Time       `bson:"created_at" json:"created_at"`
+	ShippedAt      *time.Time      `bson:"shipped_at,omitempty" json:"shipped_at,omitempty"`
+	DeliveredAt    *time.Time      `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+}
+
+// CarrierEvent is the payload carriers post to the tracking webhook
+type CarrierEvent struct {
+	Carrier        string         `json:"carrier"`
+	TrackingNumber string         `json:"tracking_number"`
+	Status         ShipmentStatus `json:"status"`
+	Description    string         `json:"description"`
+	Location       string         `json:"location"`
+	OccurredAt     time.Time      `json:"occurred_at"`
+}
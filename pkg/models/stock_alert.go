@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// StockStatus tells how a product's stock compares to its thresholds
+type StockStatus string
+
+const (
+	InStock    StockStatus = "IN_STOCK"
+	LowStock   StockStatus = "LOW_STOCK"
+	OutOfStock StockStatus = "OUT_OF_STOCK"
+)
+
+// StockThresholds are the reorder points of a product: at or below LowStock units it runs low, at or below
+// OutOfStock units it counts as sold out
+type StockThresholds struct {
+	LowStock   int `bson:"low_stock" json:"low_stock"`
+	OutOfStock int `bson:"out_of_stock" json:"out_of_stock"`
+}
+
+// Status returns the status of stock against the thresholds
+func (t StockThresholds) Status(stock int) StockStatus {
+	switch {
+	case stock <= t.OutOfStock:
+		return OutOfStock
+	case stock <= t.LowStock:
+		return LowStock
+	default:
+		return InStock
+	}
+}
+
+// LowStockItem is a product of the low-stock report
+type LowStockItem struct {
+	ProductID  string          `json:"product_id"`
+	Name       string          `json:"name"`
+	Stock      int             `json:"stock"`
+	Status     StockStatus     `json:"status"`
+	Thresholds StockThresholds `json:"thresholds"`
+}
+
+// LowStockAlert is sent when a product's stock crosses one of its thresholds
+type LowStockAlert struct {
+	Event      string          `json:"event"`
+	TenantID   string          `json:"tenant_id"`
+	ProductID  string          `json:"product_id"`
+	Name       string          `json:"name"`
+	Stock      int             `json:"stock"`
+	Status     StockStatus     `json:"status"`
+	Thresholds StockThresholds `json:"thresholds"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
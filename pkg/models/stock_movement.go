@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MovementType is the kind of change a stock movement records
+type MovementType string
+
+const (
+	// MovementOpening is the stock a product held before the ledger recorded its first movement
+	MovementOpening     MovementType = "OPENING"
+	MovementReservation MovementType = "RESERVATION"
+	// MovementCommit marks reserved units as gone for good, reservations already took them out of stock
+	MovementCommit     MovementType = "COMMIT"
+	MovementRelease    MovementType = "RELEASE"
+	MovementAdjustment MovementType = "ADJUSTMENT"
+	MovementRestock    MovementType = "RESTOCK"
+)
+
+// StockMovement is an entry of the append-only stock ledger. Quantity is the signed change of the product
+// stock, so the movements of a product add up to its current stock. Commits carry the quantity of the
+// reservation they settle and are left out of the sum.
+type StockMovement struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID    string             `bson:"tenant_id,omitempty" json:"-"`
+	ProductID   string             `bson:"product_id" json:"product_id"`
+	WarehouseID string             `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"`
+	Type        MovementType       `bson:"type" json:"type"`
+	Quantity    int                `bson:"quantity" json:"quantity"`
+	// StockAfter is the product stock right after the movement
+	StockAfter int       `bson:"stock_after" json:"stock_after"`
+	Reason     string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	Actor      string    `bson:"actor,omitempty" json:"actor,omitempty"`
+	OrderID    string    `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	OccurredAt time.Time `bson:"occurred_at" json:"occurred_at"`
+}
+
+// StockDiscrepancy is a product whose stock does not match the sum of its ledger movements
+type StockDiscrepancy struct {
+	TenantID  string `json:"tenant_id"`
+	ProductID string `json:"product_id"`
+	Stock     int    `json:"stock"`
+	Ledger    int    `json:"ledger"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// TaxLine is the tax charged on an order line. Taxable is the line amount the rate applies to, net of the
+// discounts and of the tax itself.
+type TaxLine struct {
+	ProductID string  `bson:"product_id" json:"product_id"`
+	Name      string  `bson:"name" json:"name"`
+	Region    string  `bson:"region,omitempty" json:"region,omitempty"`
+	Rate      float64 `bson:"rate" json:"rate"`
+	Taxable   float64 `bson:"taxable" json:"taxable"`
+	Amount    float64 `bson:"amount" json:"amount"`
+}
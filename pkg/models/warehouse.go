@@ -0,0 +1,44 @@
+package models
+
+// Location is a point on the globe, used to find the warehouse closest to a customer
+type Location struct {
+	Latitude  float64 `bson:"latitude" json:"latitude"`
+	Longitude float64 `bson:"longitude" json:"longitude"`
+}
+
+// Warehouse is a location inventory is held at and shipped from
+type Warehouse struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name,omitempty"`
+	Location *Location `json:"location,omitempty"`
+	// Priority orders warehouses for the priority allocation rule, lower numbers are preferred
+	Priority int `json:"priority"`
+}
+
+// WarehouseStock is the stock of a product held at one warehouse
+type WarehouseStock struct {
+	WarehouseID string `bson:"warehouse_id" json:"warehouse_id"`
+	Stock       int    `bson:"stock" json:"stock"`
+}
+
+// StockLevel is the current stock of a product, in total and per warehouse
+type StockLevel struct {
+	Stock      int
+	Warehouses []WarehouseStock
+}
+
+// WarehouseAvailability is the stock of a product at one warehouse along with the warehouse details
+type WarehouseAvailability struct {
+	Warehouse
+	Stock int `json:"stock"`
+}
+
+// Availability is the stock of a product broken down by warehouse
+type Availability struct {
+	ProductID string `json:"product_id"`
+	Stock     int    `json:"stock"`
+	// Unassigned is the stock not held at any warehouse, products created before warehouses existed keep
+	// all of their stock there
+	Unassigned int                     `json:"unassigned"`
+	Warehouses []WarehouseAvailability `json:"warehouses"`
+}
@@ -3,13 +3,17 @@ package mongodb
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"log"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mtls"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 var (
@@ -38,9 +42,9 @@ func InitMongoDB() *mongo.Client {
 
 	once.Do(func() {
 		// Load X.509 client cert (public + private in same file)
-		cert, err := tls.LoadX509KeyPair(certPath, certPath)
+		cert, err := mtls.LoadCertificate(certPath)
 		if err != nil {
-			log.Fatalf("Failed to load X.509 certificate: %v", err)
+			log.Fatal(err)
 		}
 
 		// TLS config
@@ -83,6 +87,14 @@ func GetCollection(name string) *mongo.Collection {
 	return mongoClient.Database(databaseName).Collection(name)
 }
 
+// Ping checks that the MongoDB deployment is reachable, it is used by the readiness probes
+func Ping(ctx context.Context) error {
+	if mongoClient == nil {
+		return errors.New("MongoDB client not initialized")
+	}
+	return mongoClient.Ping(ctx, readpref.Primary())
+}
+
 func DisconnectMongo() {
 	if mongoClient != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -94,3 +106,12 @@ func DisconnectMongo() {
 		}
 	}
 }
+
+// VersionFilter matches a document version for optimistic concurrency checks.
+// Documents written before versioning was introduced have no version field and count as version 0.
+func VersionFilter(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
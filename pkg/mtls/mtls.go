@@ -0,0 +1,83 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// LoadCertificate reads a certificate and its private key from a single PEM file, the layout of the
+// MongoDB client certificate
+func LoadCertificate(path string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(path, path)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to load X.509 certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// LoadCAPool reads the certificate authorities peers are verified against
+func LoadCAPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("CA bundle contains no certificates")
+	}
+	return pool, nil
+}
+
+// ServerConfig requires clients to present a certificate issued by the CA
+func ServerConfig(certPath, caPath string) (*tls.Config, error) {
+	cert, err := LoadCertificate(certPath)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := LoadCAPool(caPath)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ClientConfig presents the certificate to servers and verifies them against the CA
+func ClientConfig(certPath, caPath string) (*tls.Config, error) {
+	cert, err := LoadCertificate(certPath)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := LoadCAPool(caPath)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Config is the mutual TLS setup of internal gRPC traffic
+type Config struct {
+	CertPath string
+	CAPath   string
+}
+
+// Enabled reports whether mutual TLS is configured
+func (c Config) Enabled() bool {
+	return c.CertPath != "" && c.CAPath != ""
+}
+
+// ConfigFromEnv reads SERVICE_TLS_CERT (certificate and key in one PEM file) and SERVICE_TLS_CA
+func ConfigFromEnv() Config {
+	return Config{CertPath: os.Getenv("SERVICE_TLS_CERT"), CAPath: os.Getenv("SERVICE_TLS_CA")}
+}
@@ -0,0 +1,115 @@
+package payment
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Behaviour controls how the fake gateway answers every request
+type Behaviour string
+
+const (
+	Approve Behaviour = "approve"
+	Decline Behaviour = "decline"
+	Timeout Behaviour = "timeout"
+)
+
+// FakeGateway is a local payment gateway used until a real provider is integrated
+type FakeGateway struct {
+	behaviour    Behaviour
+	latency      time.Duration
+	declineAbove float64
+}
+
+// NewFakeGateway creates a gateway with fixed behaviour. Authorizations above declineAbove are declined
+// regardless of behaviour, a zero value disables the limit.
+func NewFakeGateway(behaviour Behaviour, latency time.Duration, declineAbove float64) *FakeGateway {
+	return &FakeGateway{behaviour: behaviour, latency: latency, declineAbove: declineAbove}
+}
+
+// NewFakeGatewayFromEnv configures the fake gateway from PAYMENT_GATEWAY_BEHAVIOUR,
+// PAYMENT_GATEWAY_LATENCY and PAYMENT_DECLINE_ABOVE
+func NewFakeGatewayFromEnv() *FakeGateway {
+	behaviour := Behaviour(os.Getenv("PAYMENT_GATEWAY_BEHAVIOUR"))
+	switch behaviour {
+	case Approve, Decline, Timeout:
+	case "":
+		behaviour = Approve
+	default:
+		log.Fatalf("invalid PAYMENT_GATEWAY_BEHAVIOUR: %s", behaviour)
+	}
+
+	var latency time.Duration
+	if v := os.Getenv("PAYMENT_GATEWAY_LATENCY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid PAYMENT_GATEWAY_LATENCY: %v", err)
+		}
+		latency = d
+	}
+
+	var declineAbove float64
+	if v := os.Getenv("PAYMENT_DECLINE_ABOVE"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			log.Fatalf("invalid PAYMENT_DECLINE_ABOVE: %v", err)
+		}
+		declineAbove = f
+	}
+
+	return NewFakeGateway(behaviour, latency, declineAbove)
+}
+
+func (g *FakeGateway) Name() string {
+	return "fake"
+}
+
+func (g *FakeGateway) Authorize(ctx context.Context, orderID string, amount float64, currency string) (string, error) {
+	if err := g.respond(ctx); err != nil {
+		return "", err
+	}
+	if g.declineAbove > 0 && amount > g.declineAbove {
+		return "", ErrDeclined
+	}
+	log.Printf("fake gateway authorized %.2f %s for order %s", amount, currency, orderID)
+	return "fake_" + uuid.NewString(), nil
+}
+
+func (g *FakeGateway) Capture(ctx context.Context, transactionID string, amount float64) error {
+	return g.respond(ctx)
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, transactionID string, amount float64) error {
+	return g.respond(ctx)
+}
+
+func (g *FakeGateway) Void(ctx context.Context, transactionID string) error {
+	return g.respond(ctx)
+}
+
+// respond simulates network latency and the configured outcome
+func (g *FakeGateway) respond(ctx context.Context) error {
+	wait := g.latency
+	if g.behaviour == Timeout {
+		// never answer, the caller's deadline decides when to give up
+		wait = time.Hour
+	}
+
+	if wait > 0 {
+		select {
+		case <-ctx.Done():
+			return ErrTimeout
+		case <-time.After(wait):
+		}
+	}
+
+	if g.behaviour == Decline {
+		return ErrDeclined
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+)
+
+var (
+	ErrDeclined = errors.New("payment declined")
+	ErrTimeout  = errors.New("payment gateway timeout")
+)
+
+// Provider is implemented by every payment gateway integration
+type Provider interface {
+	Name() string
+	// Authorize reserves the amount on the customer's payment method and returns the gateway transaction ID
+	Authorize(ctx context.Context, orderID string, amount float64, currency string) (string, error)
+	Capture(ctx context.Context, transactionID string, amount float64) error
+	Refund(ctx context.Context, transactionID string, amount float64) error
+	// Void releases an authorization that was never captured
+	Void(ctx context.Context, transactionID string) error
+}
+
+// Authorize requests an authorization for the order total and returns the resulting payment record.
+// A declined authorization is reported through the record status, any other failure is returned as error.
+func Authorize(ctx context.Context, p Provider, order *models.Order) (*models.Payment, error) {
+	now := time.Now()
+	record := &models.Payment{
+		Provider:  p.Name(),
+		Amount:    order.Total,
+		Currency:  order.Currency,
+		UpdatedAt: now,
+	}
+
+	txID, err := p.Authorize(ctx, order.ID.Hex(), order.Total, order.Currency)
+	switch {
+	case errors.Is(err, ErrDeclined):
+		record.Status = models.PaymentDeclined
+		record.FailureReason = err.Error()
+		return record, nil
+	case err != nil:
+		return nil, err
+	}
+
+	record.TransactionID = txID
+	record.Status = models.PaymentAuthorized
+	record.AuthorizedAt = &now
+	return record, nil
+}
+
+// Capture settles a previously authorized payment
+func Capture(ctx context.Context, p Provider, record *models.Payment) error {
+	if record.Status != models.PaymentAuthorized {
+		return errors.New("payment is not in AUTHORIZED state")
+	}
+	if err := p.Capture(ctx, record.TransactionID, record.Amount); err != nil {
+		return err
+	}
+	now := time.Now()
+	record.Status = models.PaymentCaptured
+	record.CapturedAt = &now
+	record.UpdatedAt = now
+	return nil
+}
+
+// Refund returns the given amount to the customer. Authorizations that were never captured are voided instead.
+func Refund(ctx context.Context, p Provider, record *models.Payment, amount float64) error {
+	now := time.Now()
+	switch record.Status {
+	case models.PaymentAuthorized:
+		if err := p.Void(ctx, record.TransactionID); err != nil {
+			return err
+		}
+		record.Status = models.PaymentVoided
+	case models.PaymentCaptured:
+		if amount <= 0 || record.RefundedAmount+amount > record.Amount {
+			return errors.New("refund amount exceeds captured amount")
+		}
+		if err := p.Refund(ctx, record.TransactionID, amount); err != nil {
+			return err
+		}
+		record.RefundedAmount += amount
+		if record.RefundedAmount >= record.Amount {
+			record.Status = models.PaymentRefunded
+		}
+		record.RefundedAt = &now
+	case models.PaymentRefunded:
+		return errors.New("payment already refunded")
+	default:
+		return nil
+	}
+	record.UpdatedAt = now
+	return nil
+}
@@ -0,0 +1,47 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/validation"
+)
+
+// ContentType is the media type of RFC 7807 problem documents
+const ContentType = "application/problem+json"
+
+// Details is an RFC 7807 problem document extended with a stable machine-readable error code
+type Details struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	// Errors lists the rejected fields of a request that failed validation
+	Errors validation.Errors `json:"errors,omitempty"`
+}
+
+// New builds the problem document of an error code
+func New(r *http.Request, status int, code string, detail string) *Details {
+	return &Details{
+		Type:     "urn:problem-type:" + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	}
+}
+
+// Write sends a problem document
+func Write(w http.ResponseWriter, r *http.Request, status int, code string, detail string) {
+	WriteDetails(w, New(r, status, code, detail))
+}
+
+// WriteDetails sends a prepared problem document
+func WriteDetails(w http.ResponseWriter, p *Details) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
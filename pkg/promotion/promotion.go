@@ -0,0 +1,175 @@
+package promotion
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+)
+
+// Errors reported by Check for promotions an order cannot use
+var (
+	ErrInactive   = errors.New("promotion is not active")
+	ErrNotStarted = errors.New("promotion has not started yet")
+	ErrExpired    = errors.New("promotion has expired")
+	ErrUsedUp     = errors.New("promotion reached its usage limit")
+)
+
+// Line is an order line as the promotion rules see it
+type Line struct {
+	ProductID string
+	Category  string
+	Brand     string
+	Quantity  int
+	Price     float64
+}
+
+// Check reports whether the promotion can be used at now
+func Check(p *models.Promotion, now time.Time) error {
+	switch {
+	case !p.Active:
+		return ErrInactive
+	case p.StartsAt != nil && now.Before(*p.StartsAt):
+		return ErrNotStarted
+	case p.ExpiresAt != nil && !now.Before(*p.ExpiresAt):
+		return ErrExpired
+	case p.UsageLimit > 0 && p.UsageCount >= p.UsageLimit:
+		return ErrUsedUp
+	}
+	return nil
+}
+
+// Discounts returns the discounts the promotion grants on lines, none when no line matches or the matching
+// lines stay below the minimum subtotal. Percentages and free units are granted per product, so are amounts
+// off restricted to some products, categories or brands: they are split over the matching products by their
+// share of the subtotal. Only an amount off the whole order names no product.
+func Discounts(p *models.Promotion, lines []Line) []models.DiscountLine {
+	var matching []Line
+	var subtotal float64
+	for _, line := range lines {
+		if matches(p, line) {
+			matching = append(matching, line)
+			subtotal += line.Price * float64(line.Quantity)
+		}
+	}
+	if len(matching) == 0 || subtotal < p.MinSubtotal {
+		return nil
+	}
+
+	var discounts []models.DiscountLine
+	grant := func(productID string, amount float64) {
+		if amount = round(amount); amount > 0 {
+			discounts = append(discounts, models.DiscountLine{PromotionID: p.ID.Hex(), Code: p.Code, Description: p.Name, ProductID: productID, Amount: amount})
+		}
+	}
+	switch p.Type {
+	case models.PercentOff:
+		for _, line := range matching {
+			grant(line.ProductID, line.Price*float64(line.Quantity)*p.Percent/100)
+		}
+	case models.AmountOff:
+		amount := round(math.Min(p.Amount, subtotal))
+		if !restricted(p) {
+			grant("", amount)
+			break
+		}
+		// The last line gets what rounding left over, the shares add up to the amount
+		left := amount
+		for i, line := range matching {
+			share := round(amount * line.Price * float64(line.Quantity) / subtotal)
+			if i == len(matching)-1 {
+				share = left
+			}
+			share = math.Min(share, left)
+			grant(line.ProductID, share)
+			left = round(left - share)
+		}
+	case models.BuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return nil
+		}
+		for _, line := range matching {
+			free := line.Quantity / (p.BuyQuantity + p.GetQuantity) * p.GetQuantity
+			grant(line.ProductID, float64(free)*line.Price)
+		}
+	}
+	return discounts
+}
+
+// Best picks the discounts an order gets out of the promotions: the stackable ones together or a single
+// other one, whichever saves more. A product is never discounted below zero and neither is the order.
+func Best(promotions []models.Promotion, lines []Line) []models.DiscountLine {
+	var stacked, best []models.DiscountLine
+	for i := range promotions {
+		discounts := Discounts(&promotions[i], lines)
+		if promotions[i].Stackable {
+			stacked = append(stacked, discounts...)
+		} else if Total(discounts) > Total(best) {
+			best = discounts
+		}
+	}
+	if Total(stacked) >= Total(best) {
+		best = stacked
+	}
+	return capped(best, lines)
+}
+
+// Total sums the discounts
+func Total(discounts []models.DiscountLine) float64 {
+	var total float64
+	for _, d := range discounts {
+		total += d.Amount
+	}
+	return round(total)
+}
+
+// capped trims the discounts that would take a product or the order below zero
+func capped(discounts []models.DiscountLine, lines []Line) []models.DiscountLine {
+	left := make(map[string]float64, len(lines))
+	var orderLeft float64
+	for _, line := range lines {
+		left[line.ProductID] += line.Price * float64(line.Quantity)
+		orderLeft += line.Price * float64(line.Quantity)
+	}
+
+	var out []models.DiscountLine
+	for _, d := range discounts {
+		limit := orderLeft
+		if d.ProductID != "" {
+			limit = math.Min(limit, left[d.ProductID])
+		}
+		if d.Amount > limit {
+			d.Amount = round(limit)
+		}
+		if d.Amount <= 0 {
+			continue
+		}
+		orderLeft -= d.Amount
+		if d.ProductID != "" {
+			left[d.ProductID] -= d.Amount
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+func matches(p *models.Promotion, line Line) bool {
+	if !restricted(p) {
+		return true
+	}
+	return slices.Contains(p.ProductIDs, line.ProductID) ||
+		(line.Category != "" && slices.Contains(p.Categories, line.Category)) ||
+		(line.Brand != "" && slices.Contains(p.Brands, line.Brand))
+}
+
+// restricted reports whether the promotion only applies to some products, categories or brands
+func restricted(p *models.Promotion) bool {
+	return len(p.ProductIDs) > 0 || len(p.Categories) > 0 || len(p.Brands) > 0
+}
+
+// round rounds an amount to cents
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -35,7 +35,7 @@ func InitRedis() (*redis.Client, string) {
 		Addr: redisAddr,
 	})
 	if _, err := rdb.Ping(ctx).Result(); err != nil {
-		log.Printf("Redis connection error:", err)
+		log.Printf("Redis connection error: %v", err)
 	}
 
 	err := rdb.XGroupCreateMkStream(ctx, streamKey, consumerGroup, "0").Err()
@@ -0,0 +1,52 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+)
+
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// Router serves Go 1.22 method patterns such as "GET /v1/orders/{id}". A request with a known path
+// but another method gets 405 with an Allow header listing the registered methods.
+type Router struct {
+	mux *http.ServeMux
+}
+
+func New() *Router {
+	return &Router{mux: http.NewServeMux()}
+}
+
+// Handle registers a versioned route
+func (rt *Router) Handle(pattern string, h http.HandlerFunc) {
+	rt.mux.HandleFunc(pattern, h)
+}
+
+// Deprecated registers a legacy alias that keeps working but announces its replacement with a Deprecation
+// header and a successor-version link. Placeholders of the successor are filled from the request's path
+// or query parameters of the same name.
+func (rt *Router) Deprecated(pattern string, successor string, h http.HandlerFunc) {
+	rt.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+expand(successor, r)+`>; rel="successor-version"`)
+		h(w, r)
+	})
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+func expand(successor string, r *http.Request) string {
+	return placeholder.ReplaceAllStringFunc(successor, func(m string) string {
+		name := m[1 : len(m)-1]
+		if v := r.PathValue(name); v != "" {
+			return v
+		}
+		if v := r.URL.Query().Get(name); v != "" {
+			return url.PathEscape(v)
+		}
+		return m
+	})
+}
@@ -0,0 +1,182 @@
+package tax
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+)
+
+// Line is an order line as the tax rules see it. Amount is what the customer pays for the line, discounts
+// deducted.
+type Line struct {
+	ProductID string
+	Category  string
+	Quantity  int
+	Amount    float64
+}
+
+// Provider is implemented by every tax calculation, the built-in rate table or an external tax service
+type Provider interface {
+	// Calculate returns the taxes of the lines of an order shipped to region, an ISO 3166 country (DE) or
+	// subdivision (US-CA) code that may be empty
+	Calculate(ctx context.Context, region string, lines []Line) ([]models.TaxLine, error)
+	// Inclusive reports whether line amounts already contain the tax, it is added on top of them otherwise
+	Inclusive() bool
+}
+
+// Rate is the tax charged on the products of a category in a region. Rates without a region apply in
+// every region, rates without a category to every product.
+type Rate struct {
+	Region   string  `json:"region,omitempty"`
+	Category string  `json:"category,omitempty"`
+	Name     string  `json:"name"`
+	Percent  float64 `json:"rate"`
+}
+
+type key struct {
+	region   string
+	category string
+}
+
+// Table is the built-in Provider charging the rates of a table
+type Table struct {
+	inclusive     bool
+	defaultRegion string
+	rates         map[key]Rate
+}
+
+// NewTable returns the table of rates. Orders without a region are taxed at the rates of defaultRegion.
+func NewTable(rates []Rate, inclusive bool, defaultRegion string) (*Table, error) {
+	t := &Table{inclusive: inclusive, defaultRegion: normalizeRegion(defaultRegion), rates: make(map[key]Rate, len(rates))}
+	for _, r := range rates {
+		if r.Percent < 0 || r.Percent > 100 {
+			return nil, fmt.Errorf("tax rate %v of %q is not between 0 and 100", r.Percent, r.Name)
+		}
+		r.Region = normalizeRegion(r.Region)
+		k := key{region: r.Region, category: normalizeCategory(r.Category)}
+		if _, dup := t.rates[k]; dup {
+			return nil, fmt.Errorf("duplicate tax rate for region %q and category %q", r.Region, r.Category)
+		}
+		t.rates[k] = r
+	}
+	return t, nil
+}
+
+// LoadTable reads a JSON tax rates file:
+// {"inclusive": false, "default_region": "DE", "rates": [{"region": "DE", "name": "VAT", "rate": 19},
+// {"region": "DE", "category": "books", "name": "VAT reduced", "rate": 7}]}
+func LoadTable(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tax rates: %w", err)
+	}
+	var file struct {
+		Inclusive     bool   `json:"inclusive"`
+		DefaultRegion string `json:"default_region"`
+		Rates         []Rate `json:"rates"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse tax rates: %w", err)
+	}
+	return NewTable(file.Rates, file.Inclusive, file.DefaultRegion)
+}
+
+// ProviderFromEnv loads the rate table of TAX_RATES_FILE, nil when it is not set
+func ProviderFromEnv() Provider {
+	path := os.Getenv("TAX_RATES_FILE")
+	if path == "" {
+		return nil
+	}
+	t, err := LoadTable(path)
+	if err != nil {
+		log.Fatalf("Failed to load tax rates: %v", err)
+	}
+	log.Printf("Loaded %d tax rates", len(t.rates))
+	return t
+}
+
+// Inclusive reports whether the prices of the table include the tax
+func (t *Table) Inclusive() bool {
+	return t.inclusive
+}
+
+// Calculate charges every line the rate of its category in the region, the rate of the region for its other
+// products when the category has none. Subdivisions without rates fall back to those of their country, then
+// to the rates without a region. Lines without any rate are not taxed.
+func (t *Table) Calculate(_ context.Context, region string, lines []Line) ([]models.TaxLine, error) {
+	region = normalizeRegion(region)
+	if region == "" {
+		region = t.defaultRegion
+	}
+
+	var taxes []models.TaxLine
+	for _, line := range lines {
+		rate, ok := t.lookup(region, normalizeCategory(line.Category))
+		if !ok || line.Amount <= 0 {
+			continue
+		}
+		taxable, amount := line.Amount, line.Amount*rate.Percent/100
+		if t.inclusive {
+			taxable = round(line.Amount / (1 + rate.Percent/100))
+			amount = line.Amount - taxable
+		}
+		taxes = append(taxes, models.TaxLine{
+			ProductID: line.ProductID,
+			Name:      rate.Name,
+			Region:    rate.Region,
+			Rate:      rate.Percent,
+			Taxable:   round(taxable),
+			Amount:    round(amount),
+		})
+	}
+	return taxes, nil
+}
+
+// lookup finds the most specific rate: the region before its country before every region, and within one the
+// category before the rest of the products
+func (t *Table) lookup(region, category string) (Rate, bool) {
+	regions := []string{region}
+	if country, _, found := strings.Cut(region, "-"); found {
+		regions = append(regions, country)
+	}
+	if region != "" {
+		regions = append(regions, "")
+	}
+	for _, r := range regions {
+		if rate, ok := t.rates[key{region: r, category: category}]; ok && category != "" {
+			return rate, true
+		}
+		if rate, ok := t.rates[key{region: r}]; ok {
+			return rate, true
+		}
+	}
+	return Rate{}, false
+}
+
+// Total sums the taxes
+func Total(taxes []models.TaxLine) float64 {
+	var total float64
+	for _, t := range taxes {
+		total += t.Amount
+	}
+	return round(total)
+}
+
+func normalizeRegion(region string) string {
+	return strings.ToUpper(strings.TrimSpace(region))
+}
+
+func normalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
+
+// round rounds an amount to cents
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,98 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/problem"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errMismatch = errors.New("the token belongs to another tenant")
+	errUnknown  = errors.New("unknown tenant")
+)
+
+// resolve determines the tenant of a call. Users act for the tenant_id of their token, tokens without one
+// belong to the default tenant, and a requested tenant must agree with it. Services and anonymous callers
+// name the tenant they act for, the default tenant when they don't.
+func resolve(ctx context.Context, requested string, reg *Registry) (Tenant, error) {
+	id := requested
+	if claims, ok := auth.FromContext(ctx); ok && claims.Role != auth.RoleService {
+		id = claims.TenantID
+		if id == "" {
+			id = Default
+		}
+		if requested != "" && requested != id {
+			return Tenant{}, errMismatch
+		}
+	}
+	if id == "" {
+		id = Default
+	}
+
+	t, ok := reg.Lookup(id)
+	if !ok {
+		return Tenant{}, errUnknown
+	}
+	return t, nil
+}
+
+// Middleware resolves the tenant of a request. It runs after authentication so the claims are known, use
+// Guard to chain it behind an auth guard.
+func Middleware(reg *Registry) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			t, err := resolve(r.Context(), r.Header.Get(Header), reg)
+			switch {
+			case errors.Is(err, errMismatch):
+				problem.Write(w, r, http.StatusForbidden, "tenant_mismatch", err.Error())
+				return
+			case err != nil:
+				problem.Write(w, r, http.StatusBadRequest, "unknown_tenant", "the "+Header+" header does not name a known tenant")
+				return
+			}
+			next(w, r.WithContext(NewContext(r.Context(), t)))
+		}
+	}
+}
+
+// Guard returns guard followed by the tenant middleware
+func Guard(reg *Registry, guard func(http.HandlerFunc) http.HandlerFunc) func(http.HandlerFunc) http.HandlerFunc {
+	resolveTenant := Middleware(reg)
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return guard(resolveTenant(next))
+	}
+}
+
+// UnaryServerInterceptor resolves the tenant of gRPC calls from the x-tenant-id metadata and the caller's
+// claims. It must run after the authentication interceptor.
+func UnaryServerInterceptor(reg *Registry) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		requested := ""
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(metadataKey); len(values) > 0 {
+				requested = values[0]
+			}
+		}
+
+		t, err := resolve(ctx, requested, reg)
+		switch {
+		case errors.Is(err, errMismatch):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case err != nil:
+			return nil, status.Error(codes.InvalidArgument, "x-tenant-id does not name a known tenant")
+		}
+		return handler(NewContext(ctx, t), req)
+	}
+}
+
+// OutgoingContext names the tenant of ctx in the metadata of outgoing gRPC calls
+func OutgoingContext(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, metadataKey, FromContext(ctx).ID)
+}
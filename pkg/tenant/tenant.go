@@ -0,0 +1,117 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Default is the tenant of documents written before tenants existed and of callers that do not name one
+const Default = "default"
+
+// Header names the tenant of a request made by a service or an anonymous caller, gRPC calls use the lower
+// case metadata key
+const Header = "X-Tenant-ID"
+
+const metadataKey = "x-tenant-id"
+
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Config is the per-tenant configuration, zero values fall back to the service defaults
+type Config struct {
+	// Currency is the only currency orders of the tenant may be placed in
+	Currency    string `json:"currency,omitempty"`
+	MaxItems    int    `json:"max_items,omitempty"`
+	MaxQuantity int    `json:"max_quantity,omitempty"`
+}
+
+// Tenant is the storefront a request acts for
+type Tenant struct {
+	ID string
+	Config
+}
+
+type contextKey struct{}
+
+// NewContext returns a context acting for the tenant
+func NewContext(ctx context.Context, t Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the tenant of the context, the default tenant when there is none
+func FromContext(ctx context.Context) Tenant {
+	if t, ok := ctx.Value(contextKey{}).(Tenant); ok && t.ID != "" {
+		return t
+	}
+	return Tenant{ID: Default}
+}
+
+// Filter scopes a MongoDB filter to the tenant. Documents without a tenant_id belong to the default tenant.
+func Filter(id string, filter bson.M) bson.M {
+	if id == "" || id == Default {
+		filter["tenant_id"] = bson.M{"$in": bson.A{Default, nil}}
+	} else {
+		filter["tenant_id"] = id
+	}
+	return filter
+}
+
+// Registry holds the configuration of the known tenants
+type Registry struct {
+	tenants map[string]Config
+}
+
+// LoadRegistry reads a JSON tenants file: {"tenants": {"acme": {"currency": "EUR", "max_items": 20}}}
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants: %w", err)
+	}
+	var file struct {
+		Tenants map[string]Config `json:"tenants"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants: %w", err)
+	}
+	for id := range file.Tenants {
+		if !validID.MatchString(id) {
+			return nil, fmt.Errorf("invalid tenant id %q", id)
+		}
+	}
+	return &Registry{tenants: file.Tenants}, nil
+}
+
+// RegistryFromEnv loads the tenants of TENANTS_FILE, nil when it is not set
+func RegistryFromEnv() *Registry {
+	path := os.Getenv("TENANTS_FILE")
+	if path == "" {
+		return nil
+	}
+	reg, err := LoadRegistry(path)
+	if err != nil {
+		log.Fatalf("Failed to load tenants: %v", err)
+	}
+	log.Printf("Loaded %d tenants", len(reg.tenants))
+	return reg
+}
+
+// Lookup returns the tenant of id. Without a registry every well-formed id is accepted with the service
+// defaults, with one only the configured tenants and the default tenant are.
+func (reg *Registry) Lookup(id string) (Tenant, bool) {
+	if !validID.MatchString(id) {
+		return Tenant{}, false
+	}
+	if reg == nil {
+		return Tenant{ID: id}, true
+	}
+	cfg, ok := reg.tenants[id]
+	if !ok && id != Default {
+		return Tenant{}, false
+	}
+	return Tenant{ID: id, Config: cfg}, true
+}
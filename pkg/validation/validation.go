@@ -0,0 +1,58 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError describes why a single field of a request was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors is the list of every field that failed validation
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Validator collects field errors so a request can report all its problems at once
+type Validator struct {
+	errs Errors
+}
+
+// Check records the message against the field when ok is false
+func (v *Validator) Check(ok bool, field string, format string, args ...interface{}) {
+	if !ok {
+		v.errs = append(v.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// Required rejects empty or blank strings
+func (v *Validator) Required(field string, value string) {
+	v.Check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+// MaxLen rejects strings longer than max characters
+func (v *Validator) MaxLen(field string, value string, max int) {
+	v.Check(len([]rune(value)) <= max, field, "must be at most %d characters", max)
+}
+
+// Between rejects integers outside [min, max]
+func (v *Validator) Between(field string, value int, min int, max int) {
+	v.Check(value >= min && value <= max, field, "must be between %d and %d", min, max)
+}
+
+// Err returns the collected errors, or nil when the request is valid
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
@@ -0,0 +1,147 @@
+package warehouse
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+)
+
+// Rule decides which warehouse fulfils an order line when several hold enough stock
+type Rule string
+
+const (
+	// RulePriority prefers the warehouse with the lowest priority number
+	RulePriority Rule = "priority"
+	// RuleMostStock prefers the warehouse holding the most units of the product
+	RuleMostStock Rule = "most_stock"
+	// RuleClosest prefers the warehouse closest to the shipping location, orders without one fall back to
+	// the priority rule
+	RuleClosest Rule = "closest"
+)
+
+// ParseRule validates an allocation rule name, the empty name is the priority rule
+func ParseRule(name string) (Rule, error) {
+	switch rule := Rule(name); rule {
+	case "":
+		return RulePriority, nil
+	case RulePriority, RuleMostStock, RuleClosest:
+		return rule, nil
+	default:
+		return "", fmt.Errorf("unknown allocation rule %q", name)
+	}
+}
+
+// Allocator picks the warehouse fulfilling each order line. A nil Allocator applies the priority rule
+// without a registry, warehouses are then ranked by id.
+type Allocator struct {
+	registry *Registry
+	rule     Rule
+}
+
+func NewAllocator(reg *Registry, rule Rule) *Allocator {
+	return &Allocator{registry: reg, rule: rule}
+}
+
+// AllocatorFromEnv allocates with the ALLOCATION_RULE among the warehouses of WAREHOUSES_FILE
+func AllocatorFromEnv() *Allocator {
+	rule, err := ParseRule(os.Getenv("ALLOCATION_RULE"))
+	if err != nil {
+		log.Fatalf("invalid ALLOCATION_RULE: %v", err)
+	}
+	return NewAllocator(RegistryFromEnv(), rule)
+}
+
+// AllocateLevel returns the warehouse that fulfils quantity units out of a stock level. Products without
+// warehouses, or whose unassigned stock covers the units, are fulfilled without one: ok is true with an
+// empty warehouseID.
+func (a *Allocator) AllocateLevel(shipTo *models.Location, quantity int, level models.StockLevel) (warehouseID string, ok bool) {
+	if warehouseID, ok := a.Allocate(shipTo, quantity, level.Warehouses); ok {
+		return warehouseID, true
+	}
+
+	unassigned := level.Stock
+	for _, held := range level.Warehouses {
+		unassigned -= held.Stock
+	}
+	return "", unassigned >= quantity
+}
+
+// Allocate returns the warehouse that fulfils quantity units of a product out of the stock held per
+// warehouse. A line is fulfilled by a single warehouse, ok is false when none holds enough units.
+func (a *Allocator) Allocate(shipTo *models.Location, quantity int, stock []models.WarehouseStock) (warehouseID string, ok bool) {
+	var reg *Registry
+	rule := RulePriority
+	if a != nil {
+		reg, rule = a.registry, a.rule
+	}
+
+	candidates := make([]candidate, 0, len(stock))
+	for _, s := range stock {
+		if s.Stock < quantity {
+			continue
+		}
+		w, known := reg.Lookup(s.WarehouseID)
+		candidates = append(candidates, candidate{warehouse: w, known: known, stock: s.Stock, distance: distance(w.Location, shipTo)})
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	if rule == RuleClosest && shipTo == nil {
+		rule = RulePriority
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].before(candidates[j], rule)
+	})
+	return candidates[0].warehouse.ID, true
+}
+
+type candidate struct {
+	warehouse models.Warehouse
+	known     bool
+	stock     int
+	distance  float64
+}
+
+// before ranks warehouses missing from the registry last, then applies the rule and breaks ties by id
+func (c candidate) before(other candidate, rule Rule) bool {
+	if c.known != other.known {
+		return c.known
+	}
+	switch rule {
+	case RuleMostStock:
+		if c.stock != other.stock {
+			return c.stock > other.stock
+		}
+	case RuleClosest:
+		if c.distance != other.distance {
+			return c.distance < other.distance
+		}
+	default:
+		if c.warehouse.Priority != other.warehouse.Priority {
+			return c.warehouse.Priority < other.warehouse.Priority
+		}
+	}
+	return c.warehouse.ID < other.warehouse.ID
+}
+
+const earthRadiusKm = 6371
+
+// distance is the great-circle distance in km, infinite when either location is unknown
+func distance(from, to *models.Location) float64 {
+	if from == nil || to == nil {
+		return math.Inf(1)
+	}
+	lat1, lat2 := radians(from.Latitude), radians(to.Latitude)
+	dLat, dLon := lat2-lat1, radians(to.Longitude-from.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
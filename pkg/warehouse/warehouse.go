@@ -0,0 +1,75 @@
+package warehouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+)
+
+// Registry holds the known warehouses
+type Registry struct {
+	warehouses map[string]models.Warehouse
+}
+
+// LoadRegistry reads a JSON warehouses file:
+// {"warehouses": [{"id": "fra", "name": "Frankfurt", "location": {"latitude": 50.1, "longitude": 8.7}, "priority": 1}]}
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read warehouses: %w", err)
+	}
+	var file struct {
+		Warehouses []models.Warehouse `json:"warehouses"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse warehouses: %w", err)
+	}
+
+	reg := &Registry{warehouses: make(map[string]models.Warehouse, len(file.Warehouses))}
+	for _, w := range file.Warehouses {
+		if w.ID == "" {
+			return nil, fmt.Errorf("warehouse without id")
+		}
+		if _, dup := reg.warehouses[w.ID]; dup {
+			return nil, fmt.Errorf("duplicate warehouse %q", w.ID)
+		}
+		reg.warehouses[w.ID] = w
+	}
+	return reg, nil
+}
+
+// RegistryFromEnv loads the warehouses of WAREHOUSES_FILE, nil when it is not set
+func RegistryFromEnv() *Registry {
+	path := os.Getenv("WAREHOUSES_FILE")
+	if path == "" {
+		return nil
+	}
+	reg, err := LoadRegistry(path)
+	if err != nil {
+		log.Fatalf("Failed to load warehouses: %v", err)
+	}
+	log.Printf("Loaded %d warehouses", len(reg.warehouses))
+	return reg
+}
+
+// Lookup returns the warehouse of id. Warehouses missing from the registry are reported with their id only.
+func (reg *Registry) Lookup(id string) (models.Warehouse, bool) {
+	if reg != nil {
+		if w, ok := reg.warehouses[id]; ok {
+			return w, true
+		}
+	}
+	return models.Warehouse{ID: id}, false
+}
+
+// Known reports whether stock may be held at the warehouse. Without a registry every id is accepted.
+func (reg *Registry) Known(id string) bool {
+	if reg == nil {
+		return id != ""
+	}
+	_, ok := reg.warehouses[id]
+	return ok
+}
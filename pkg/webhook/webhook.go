@@ -0,0 +1,126 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// EventHeader names the event a delivery carries
+	EventHeader = "X-Webhook-Event"
+	// SignatureHeader carries sha256=<hex HMAC-SHA256 of the body> when the sender has a secret
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// attempts is how often a delivery is tried before it is given up
+const attempts = 3
+
+// Sender delivers events as JSON POST requests to the subscribed URLs
+type Sender struct {
+	urls    []string
+	secret  []byte
+	client  *http.Client
+	backoff time.Duration
+}
+
+// NewSender returns a sender posting to urls, deliveries are signed when secret is not empty
+func NewSender(urls []string, secret string) *Sender {
+	return &Sender{urls: urls, secret: []byte(secret), client: &http.Client{Timeout: 5 * time.Second}, backoff: 500 * time.Millisecond}
+}
+
+// SenderFromEnv returns a sender for the comma-separated URLs of <prefix>_URLS signing with <prefix>_SECRET,
+// nil when no URLs are set
+func SenderFromEnv(prefix string) *Sender {
+	var urls []string
+	for _, u := range strings.Split(os.Getenv(prefix+"_URLS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+	return NewSender(urls, os.Getenv(prefix+"_SECRET"))
+}
+
+// Sign returns the signature of body sent in SignatureHeader
+func Sign(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts the payload to every URL. Network errors, 429 and 5xx answers are retried with a growing
+// backoff, the deliveries that still failed are reported together. A nil sender sends nothing.
+func (s *Sender) Send(ctx context.Context, event string, payload interface{}) error {
+	if s == nil {
+		return nil
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", event, err)
+	}
+
+	var errs []error
+	for _, u := range s.urls {
+		if err := s.deliver(ctx, u, event, body); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", u, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Sender) deliver(ctx context.Context, url string, event string, body []byte) error {
+	backoff := s.backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		if retry, err = s.post(ctx, url, event, body); err == nil || !retry || attempt == attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes a single delivery and reports whether a failure is worth retrying
+func (s *Sender) post(ctx context.Context, url string, event string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	if len(s.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(s.secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/health"
 	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/redis-stream"
 	"github.com/dinesh-man/ecommerce-order-processing-system/queue-service/queue"
 )
@@ -49,18 +51,28 @@ func main() {
 
 	log.Println("Redis Queue service is running on port 6379")
 
-	http.HandleFunc("/queue/health", func(w http.ResponseWriter, r *http.Request) {
-		writeJSONResponse(w, "OK", http.StatusOK)
-	})
+	probes := health.New(health.DefaultTimeout)
+	probes.AddReadiness("redis", queue.Ping)
+
+	http.HandleFunc("GET /healthz", probes.Live)
+	http.HandleFunc("GET /readyz", probes.Ready)
+	http.HandleFunc("/queue/health", probes.Ready)
+
+	// Queue administration is reserved to admins and to internal callers with a key of SERVICE_KEYS_FILE
+	serviceKeys := auth.KeyRingFromEnv()
+	if serviceKeys != nil {
+		go serviceKeys.Watch(context.Background(), auth.KeyReloadInterval)
+	}
+	admin := auth.ServiceOr(serviceKeys, auth.Require(auth.VerifierFromEnv(), auth.RoleAdmin))
 
-	http.HandleFunc("/queue/size", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/queue/size", admin(func(w http.ResponseWriter, r *http.Request) {
 		res, err := queue.QueueLength(streamKey)
 		if err != nil {
 			writeJSONResponse(w, fmt.Sprintf("Failed to get queue length: %s", err.Error()), http.StatusInternalServerError)
 			return
 		}
 		writeJSONResponse(w, fmt.Sprintf("Current queue size is %d", res), http.StatusOK)
-	})
+	}))
 
 	server := &http.Server{Addr: ":8080"}
 
@@ -78,6 +90,10 @@ func main() {
 	<-stop // Block until signal is received
 	log.Println("Shutdown signal received. Cleaning up...")
 
+	// Keep serving while the pod is taken out of the service endpoints
+	probes.Drain()
+	time.Sleep(health.DrainDelayFromEnv())
+
 	// Gracefully shutdown HTTP server
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -31,3 +31,8 @@ func InitRedis(addr string) error {
 func QueueLength(streamKey string) (int64, error) {
 	return rdb.XLen(ctx, streamKey).Result()
 }
+
+// Ping checks that Redis answers, it is used by the readiness probe
+func Ping(ctx context.Context) error {
+	return rdb.Ping(ctx).Err()
+}
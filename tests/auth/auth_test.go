@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var secret = []byte("test-secret")
+
+func TestVerifier(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: secret, Issuer: "local"})
+	require.NoError(t, err)
+
+	sign := func(claims auth.Claims) string {
+		claims.Issuer = "local"
+		token, err := auth.SignHS256(secret, claims)
+		require.NoError(t, err)
+		return token
+	}
+
+	t.Run("accepts a valid HS256 token", func(t *testing.T) {
+		claims, err := verifier.Verify(sign(auth.NewClaims(auth.RoleCustomer, "C001", "alice", time.Minute)))
+		require.NoError(t, err)
+		assert.Equal(t, auth.RoleCustomer, claims.Role)
+		assert.Equal(t, "C001", claims.CustomerID)
+	})
+
+	t.Run("rejects expired tokens", func(t *testing.T) {
+		_, err := verifier.Verify(sign(auth.NewClaims(auth.RoleAdmin, "", "ops", -time.Hour)))
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects tokens signed with another secret", func(t *testing.T) {
+		token, err := auth.SignHS256([]byte("other"), auth.NewClaims(auth.RoleAdmin, "", "ops", time.Minute))
+		require.NoError(t, err)
+		_, err = verifier.Verify(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects other issuers", func(t *testing.T) {
+		token, err := auth.SignHS256(secret, auth.NewClaims(auth.RoleAdmin, "", "ops", time.Minute))
+		require.NoError(t, err)
+		_, err = verifier.Verify(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects customer tokens without customer_id and unknown roles", func(t *testing.T) {
+		_, err := verifier.Verify(sign(auth.NewClaims(auth.RoleCustomer, "", "alice", time.Minute)))
+		assert.Error(t, err)
+		_, err = verifier.Verify(sign(auth.NewClaims("root", "", "mallory", time.Minute)))
+		assert.Error(t, err)
+	})
+}
+
+func TestJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	data, err := json.Marshal(auth.JWKS{Keys: []auth.JWK{auth.PublicJWK("k1", &key.PublicKey)}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(jwksFile, data, 0o600))
+
+	verifier, err := auth.NewVerifier(auth.Config{JWKSFile: jwksFile})
+	require.NoError(t, err)
+
+	token, err := auth.SignRS256(key, "k1", auth.NewClaims(auth.RoleSupport, "", "bob", time.Minute))
+	require.NoError(t, err)
+	claims, err := verifier.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleSupport, claims.Role)
+
+	// Unknown key ids and HS256 tokens are refused when only the JWKS is configured
+	token, err = auth.SignRS256(key, "k2", auth.NewClaims(auth.RoleSupport, "", "bob", time.Minute))
+	require.NoError(t, err)
+	_, err = verifier.Verify(token)
+	assert.Error(t, err)
+
+	token, err = auth.SignHS256(secret, auth.NewClaims(auth.RoleSupport, "", "bob", time.Minute))
+	require.NoError(t, err)
+	_, err = verifier.Verify(token)
+	assert.Error(t, err)
+}
+
+func TestRequire(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: secret})
+	require.NoError(t, err)
+
+	handler := auth.Require(verifier, auth.RoleAdmin)(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := auth.FromContext(r.Context())
+		w.Write([]byte(claims.Subject))
+	})
+	call := func(role string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/products/P001/restock", nil)
+		if role != "" {
+			token, err := auth.SignHS256(secret, auth.NewClaims(role, "C001", "tester", time.Minute))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	rec := call("")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Bearer")
+
+	assert.Equal(t, http.StatusForbidden, call(auth.RoleCustomer).Code)
+
+	rec = call(auth.RoleAdmin)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "tester", rec.Body.String())
+
+	// A nil verifier disables authentication
+	rec = httptest.NewRecorder()
+	auth.Require(nil, auth.RoleAdmin)(func(w http.ResponseWriter, r *http.Request) {})(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
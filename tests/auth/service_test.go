@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/mtls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	oldKey = "old-service-key-0123456789"
+	newKey = "new-service-key-0123456789"
+)
+
+func writeKeys(t *testing.T, path, content string, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestKeyRing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeys(t, path, `{"keys": [{"id": "2025-05", "key": "`+oldKey+`"}]}`, time.Now().Add(-time.Hour))
+	keys, err := auth.LoadKeyRing(path)
+	require.NoError(t, err)
+
+	t.Run("accepts configured keys only", func(t *testing.T) {
+		id, ok := keys.Verify(oldKey)
+		assert.True(t, ok)
+		assert.Equal(t, "2025-05", id)
+		_, ok = keys.Verify(newKey)
+		assert.False(t, ok)
+	})
+
+	t.Run("accepts old and new keys during a rotation", func(t *testing.T) {
+		writeKeys(t, path, `{"keys": [{"id": "2025-06", "key": "`+newKey+`"}, {"id": "2025-05", "key": "`+oldKey+`"}]}`, time.Now())
+		require.NoError(t, keys.Reload())
+
+		id, ok := keys.Verify(newKey)
+		assert.True(t, ok)
+		assert.Equal(t, "2025-06", id)
+		_, ok = keys.Verify(oldKey)
+		assert.True(t, ok)
+	})
+
+	t.Run("refuses expired keys", func(t *testing.T) {
+		expired := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+		writeKeys(t, path, `{"keys": [{"id": "2025-06", "key": "`+newKey+`"}, {"id": "2025-05", "key": "`+oldKey+`", "expires_at": "`+expired+`"}]}`, time.Now().Add(time.Minute))
+		require.NoError(t, keys.Reload())
+
+		_, ok := keys.Verify(oldKey)
+		assert.False(t, ok)
+		_, ok = keys.Verify(newKey)
+		assert.True(t, ok)
+	})
+
+	t.Run("keeps the previous keys when the file is invalid", func(t *testing.T) {
+		writeKeys(t, path, `{"keys": [{"id": "short", "key": "abc"}]}`, time.Now().Add(2*time.Minute))
+		assert.Error(t, keys.Reload())
+
+		_, ok := keys.Verify(newKey)
+		assert.True(t, ok)
+	})
+}
+
+func TestServiceOr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeys(t, path, `{"keys": [{"id": "order-service", "key": "`+newKey+`"}]}`, time.Now())
+	keys, err := auth.LoadKeyRing(path)
+	require.NoError(t, err)
+
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: secret})
+	require.NoError(t, err)
+	guard := auth.ServiceOr(keys, auth.Require(verifier, auth.RoleAdmin))
+	handler := guard(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := auth.FromContext(r.Context())
+		w.Write([]byte(claims.Role + ":" + claims.Subject))
+	})
+
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/products/P001/restock", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	t.Run("admits services with a valid key", func(t *testing.T) {
+		rec := serve(auth.ServiceKeyHeader, newKey)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "service:order-service", rec.Body.String())
+	})
+
+	t.Run("rejects invalid keys", func(t *testing.T) {
+		rec := serve(auth.ServiceKeyHeader, oldKey)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Body.String(), "invalid_service_key")
+	})
+
+	t.Run("falls back to the admin token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("", "").Code)
+
+		token, err := auth.SignHS256(secret, auth.NewClaims(auth.RoleAdmin, "", "ops", time.Minute))
+		require.NoError(t, err)
+		rec := serve("Authorization", "Bearer "+token)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "admin:ops", rec.Body.String())
+	})
+}
+
+// dialHealth serves the gRPC health service behind the service interceptor and returns a client for it
+func dialHealth(t *testing.T, serverOpts []grpc.ServerOption, dialOpts ...grpc.DialOption) healthpb.HealthClient {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(serverOpts...)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	dialOpts = append(dialOpts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }))
+	conn, err := grpc.NewClient("passthrough:///bufnet", dialOpts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestServiceUnaryInterceptor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeys(t, path, `{"keys": [{"id": "order-service", "key": "`+newKey+`"}]}`, time.Now())
+	keys, err := auth.LoadKeyRing(path)
+	require.NoError(t, err)
+	serverOpts := []grpc.ServerOption{grpc.UnaryInterceptor(auth.ServiceUnaryInterceptor(keys, false))}
+	ctx := context.Background()
+
+	t.Run("rejects calls without a key", func(t *testing.T) {
+		client := dialHealth(t, serverOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("rejects invalid keys", func(t *testing.T) {
+		client := dialHealth(t, serverOpts, grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithPerRPCCredentials(auth.ServiceKeyCredentials{Key: oldKey}))
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("admits calls with a valid key", func(t *testing.T) {
+		client := dialHealth(t, serverOpts, grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithPerRPCCredentials(auth.ServiceKeyCredentials{Key: newKey}))
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		assert.NoError(t, err)
+	})
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCA(t, filepath.Join(dir, "ca.pem"))
+	writeLeaf(t, filepath.Join(dir, "server.pem"), "inventory-service", ca, caKey)
+	writeLeaf(t, filepath.Join(dir, "client.pem"), "order-service", ca, caKey)
+	writeCA(t, filepath.Join(dir, "other-ca.pem"))
+	otherCA, err := mtls.LoadCAPool(filepath.Join(dir, "other-ca.pem"))
+	require.NoError(t, err)
+
+	serverTLS, err := mtls.ServerConfig(filepath.Join(dir, "server.pem"), filepath.Join(dir, "ca.pem"))
+	require.NoError(t, err)
+	serverOpts := []grpc.ServerOption{
+		grpc.Creds(credentials.NewTLS(serverTLS)),
+		grpc.UnaryInterceptor(auth.ServiceUnaryInterceptor(nil, true)),
+	}
+	ctx := context.Background()
+
+	t.Run("admits clients with a certificate of the CA", func(t *testing.T) {
+		clientTLS, err := mtls.ClientConfig(filepath.Join(dir, "client.pem"), filepath.Join(dir, "ca.pem"))
+		require.NoError(t, err)
+		clientTLS.ServerName = "inventory-service"
+		client := dialHealth(t, serverOpts, grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+		_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects clients without a certificate", func(t *testing.T) {
+		clientTLS, err := mtls.ClientConfig(filepath.Join(dir, "client.pem"), filepath.Join(dir, "ca.pem"))
+		require.NoError(t, err)
+		clientTLS.ServerName = "inventory-service"
+		clientTLS.Certificates = nil
+		client := dialHealth(t, serverOpts, grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+		_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	})
+
+	t.Run("clients refuse servers of another CA", func(t *testing.T) {
+		clientTLS, err := mtls.ClientConfig(filepath.Join(dir, "client.pem"), filepath.Join(dir, "ca.pem"))
+		require.NoError(t, err)
+		clientTLS.ServerName = "inventory-service"
+		clientTLS.RootCAs = otherCA
+		client := dialHealth(t, serverOpts, grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+		_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	})
+}
+
+func writeCA(t *testing.T, path string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return ca, key
+}
+
+// writeLeaf writes a certificate and its key to one PEM file, the layout mtls.LoadCertificate reads
+func writeLeaf(t *testing.T, path, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
@@ -0,0 +1,84 @@
+package etag
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/etag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfMatch(t *testing.T) {
+	request := func(ifMatch string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		return r
+	}
+	current := func(version int64) func() (int64, error) {
+		return func() (int64, error) { return version, nil }
+	}
+
+	t.Run("absent or any", func(t *testing.T) {
+		for _, header := range []string{"", "*"} {
+			version, err := etag.IfMatch(request(header), nil)
+			assert.NoError(t, err)
+			assert.Nil(t, version)
+		}
+	})
+
+	t.Run("single strong tag", func(t *testing.T) {
+		version, err := etag.IfMatch(request(`"3"`), nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), *version)
+	})
+
+	t.Run("weak tags never match", func(t *testing.T) {
+		_, err := etag.IfMatch(request(`W/"3"`), current(3))
+		assert.ErrorIs(t, err, etag.ErrNoStrongETag)
+		_, err = etag.IfMatch(request(`"v3"`), current(3))
+		assert.ErrorIs(t, err, etag.ErrNoStrongETag)
+	})
+
+	t.Run("weak tags of a list are skipped", func(t *testing.T) {
+		version, err := etag.IfMatch(request(`"2", W/"3"`), current(2))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), *version)
+		version, err = etag.IfMatch(request(`W/"2", "3"`), current(2))
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), *version)
+	})
+
+	t.Run("malformed tags", func(t *testing.T) {
+		for _, header := range []string{"3", `W/3`, `"3",`, `"3" "4"`, `"2", v3`} {
+			_, err := etag.IfMatch(request(header), nil)
+			assert.ErrorIs(t, err, etag.ErrInvalidIfMatch, header)
+		}
+	})
+
+	t.Run("list requires the current version", func(t *testing.T) {
+		version, err := etag.IfMatch(request(`"2", "3" ,"4"`), current(3))
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), *version)
+	})
+
+	t.Run("list without the current version requires the first", func(t *testing.T) {
+		version, err := etag.IfMatch(request(`"2", "4"`), current(3))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), *version)
+
+		version, err = etag.IfMatch(request(`"2", "4"`), func() (int64, error) { return 0, errors.New("not found") })
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), *version)
+	})
+
+	t.Run("repeated version needs no lookup", func(t *testing.T) {
+		version, err := etag.IfMatch(request(`"5", "5"`), nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), *version)
+	})
+}
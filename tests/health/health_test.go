@@ -0,0 +1,98 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/health"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func probe(t *testing.T, handler http.HandlerFunc) (int, health.Report) {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var report health.Report
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	return rec.Code, report
+}
+
+func TestProbes(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	redisPing := func(ctx context.Context) error { return rc.Ping(ctx).Err() }
+
+	t.Run("ready while every dependency answers", func(t *testing.T) {
+		probes := health.New(time.Second)
+		probes.AddReadiness("redis", redisPing)
+		probes.AddInfo("last_successful_batch", func() interface{} { return "never" })
+
+		code, report := probe(t, probes.Ready)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, health.StatusOK, report.Status)
+		assert.Equal(t, health.StatusOK, report.Checks["redis"].Status)
+		assert.Equal(t, "never", report.Info["last_successful_batch"])
+	})
+
+	t.Run("failing dependency makes the service unready but alive", func(t *testing.T) {
+		probes := health.New(time.Second)
+		probes.AddReadiness("redis", redisPing)
+		probes.AddReadiness("mongodb", func(ctx context.Context) error { return errors.New("connection refused") })
+
+		code, report := probe(t, probes.Ready)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, health.StatusUnavailable, report.Status)
+		assert.Equal(t, health.StatusOK, report.Checks["redis"].Status)
+		assert.Equal(t, "connection refused", report.Checks["mongodb"].Error)
+
+		code, _ = probe(t, probes.Live)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("slow dependency times out", func(t *testing.T) {
+		probes := health.New(20 * time.Millisecond)
+		probes.AddReadiness("mongodb", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		code, report := probe(t, probes.Ready)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Contains(t, report.Checks["mongodb"].Error, "timed out")
+	})
+
+	t.Run("unavailable redis", func(t *testing.T) {
+		down := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+		probes := health.New(time.Second)
+		probes.AddReadiness("redis", func(ctx context.Context) error { return down.Ping(ctx).Err() })
+
+		code, report := probe(t, probes.Ready)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, health.StatusUnavailable, report.Checks["redis"].Status)
+	})
+
+	t.Run("draining is not ready", func(t *testing.T) {
+		probes := health.New(time.Second)
+		probes.AddReadiness("redis", redisPing)
+		probes.Drain()
+
+		code, report := probe(t, probes.Ready)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, health.StatusDraining, report.Status)
+
+		code, _ = probe(t, probes.Live)
+		assert.Equal(t, http.StatusOK, code)
+	})
+}
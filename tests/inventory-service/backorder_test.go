@@ -0,0 +1,92 @@
+package inventory_service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/service"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestBackorderPolicy(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	routes := handler.NewInventoryHandler(service.NewInventoryService("products", rc, "product-events"), nil, nil, nil).Routes()
+	serve := func(method, target string, body []byte) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest(method, target, bytes.NewReader(body)))
+		return rec
+	}
+
+	mt.Run("the mode is validated", func(mt *mtest.T) {
+		rec := serve(http.MethodPut, "/v1/products/P001/backorder", []byte(`{"mode": "SOMEDAY"}`))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	mt.Run("products accept pre-orders", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{
+			{Key: "id", Value: "P001"},
+			{Key: "stock", Value: 0},
+			{Key: "version", Value: int64(3)},
+			{Key: "backorder", Value: bson.D{{Key: "mode", Value: "PRE_ORDER"}}},
+		}}})
+
+		rec := serve(http.MethodPut, "/v1/products/P001/backorder", []byte(`{"mode": "PRE_ORDER", "available_at": "2026-12-01T00:00:00Z"}`))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+
+		set := mt.GetStartedEvent().Command.Lookup("update", "$set", "backorder").Document()
+		assert.Equal(t, "PRE_ORDER", set.Lookup("mode").StringValue())
+
+		entries, err := rc.XRange(context.Background(), "product-events", "-", "+").Result()
+		require.NoError(t, err)
+		require.NotEmpty(t, entries)
+		assert.Equal(t, "0", entries[len(entries)-1].Values["stock"])
+	})
+
+	mt.Run("the policy is cleared", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{
+			{Key: "id", Value: "P001"},
+			{Key: "version", Value: int64(4)},
+		}}})
+
+		rec := serve(http.MethodDelete, "/v1/products/P001/backorder", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		_, err := mt.GetStartedEvent().Command.Lookup("update", "$unset").Document().LookupErr("backorder")
+		assert.NoError(t, err)
+	})
+
+	mt.Run("unknown products are not found", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}})
+
+		rec := serve(http.MethodDelete, "/v1/products/P404/backorder", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
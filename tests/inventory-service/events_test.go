@@ -0,0 +1,48 @@
+package inventory_service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/service"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestProductEvents(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	mt.Run("restock publishes product.updated", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{
+			{Key: "id", Value: "P001"},
+			{Key: "stock", Value: 12},
+			{Key: "version", Value: int64(4)},
+		}}})
+
+		inventoryService := service.NewInventoryService("products", rc, "product-events")
+		_, err := inventoryService.RestockProduct("P001", 2, nil)
+		require.NoError(t, err)
+
+		entries, err := rc.XRange(context.Background(), "product-events", "-", "+").Result()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, service.EventProductUpdated, entries[0].Values["event"])
+		assert.Equal(t, "P001", entries[0].Values["product_id"])
+		assert.Equal(t, "4", entries[0].Values["version"])
+	})
+}
@@ -0,0 +1,102 @@
+package inventory_service
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/rpc"
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/service"
+	inventoryv1 "github.com/dinesh-man/ecommerce-order-processing-system/pkg/pb/inventory/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestInventoryGRPC(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	inventoryv1.RegisterInventoryServiceServer(server, rpc.NewInventoryServer(service.NewInventoryService("products", nil, "")))
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := inventoryv1.NewInventoryServiceClient(conn)
+
+	product := bson.D{
+		{Key: "id", Value: "P001"},
+		{Key: "name", Value: "Mock Product Name"},
+		{Key: "price", Value: 150.0},
+		{Key: "stock", Value: 1},
+		{Key: "version", Value: int64(3)},
+	}
+
+	mt.Run("get product", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch, product))
+
+		resp, err := client.GetProduct(context.Background(), &inventoryv1.GetProductRequest{Id: "P001"})
+		require.NoError(t, err)
+		assert.Equal(t, 150.0, resp.GetProduct().GetPrice())
+		assert.Equal(t, int64(3), resp.GetProduct().GetVersion())
+	})
+
+	mt.Run("unknown product is not found", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch))
+
+		_, err := client.GetProduct(context.Background(), &inventoryv1.GetProductRequest{Id: "P404"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	mt.Run("batch get lists missing ids", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch, product))
+
+		resp, err := client.BatchGetProducts(context.Background(), &inventoryv1.BatchGetProductsRequest{Ids: []string{"P001", "P404"}})
+		require.NoError(t, err)
+		assert.Len(t, resp.GetProducts(), 1)
+		assert.Equal(t, []string{"P404"}, resp.GetMissingIds())
+	})
+
+	mt.Run("reserving more than the stock fails the precondition", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "value", Value: nil},
+		}, mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch, product))
+
+		_, err := client.ReserveStock(context.Background(), &inventoryv1.ReserveStockRequest{
+			Lines: []*inventoryv1.StockLine{{ProductId: "P001", Quantity: 2}},
+		})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+
+	mt.Run("invalid quantity is rejected", func(mt *mtest.T) {
+		_, err := client.ReleaseStock(context.Background(), &inventoryv1.ReleaseStockRequest{
+			Lines: []*inventoryv1.StockLine{{ProductId: "P001", Quantity: 0}},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
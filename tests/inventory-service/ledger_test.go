@@ -0,0 +1,188 @@
+package inventory_service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestStockLedger(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	inventoryService := service.NewInventoryService("products", nil, "product-events").WithLedger("stock_movements")
+	routes := handler.NewInventoryHandler(inventoryService, nil, nil, nil).Routes()
+	serve := func(method, target string, body []byte) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest(method, target, bytes.NewReader(body)))
+		return rec
+	}
+	product := func(id string, stock int) bson.D {
+		return bson.D{{Key: "id", Value: id}, {Key: "stock", Value: stock}, {Key: "version", Value: int64(2)}}
+	}
+
+	mt.Run("restocks are recorded with reason, actor and order", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: product("P001", 7)}}, mtest.CreateSuccessResponse())
+
+		_, err := inventoryService.ForActor("service:order-service").RestockWarehouse(service.StockLine{ProductID: "P001", Quantity: 2, OrderID: "O1"}, "return R1", nil)
+		require.NoError(t, err)
+
+		mt.GetStartedEvent() // findAndModify
+		movement := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(t, "RESTOCK", movement.Lookup("type").StringValue())
+		assert.Equal(t, int32(2), movement.Lookup("quantity").Int32())
+		assert.Equal(t, int32(7), movement.Lookup("stock_after").Int32())
+		assert.Equal(t, "return R1", movement.Lookup("reason").StringValue())
+		assert.Equal(t, "service:order-service", movement.Lookup("actor").StringValue())
+		assert.Equal(t, "O1", movement.Lookup("order_id").StringValue())
+		assert.Equal(t, "default", movement.Lookup("tenant_id").StringValue())
+	})
+
+	mt.Run("reservations are recorded as negative movements", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: product("P001", 4)}}, mtest.CreateSuccessResponse())
+
+		_, err := inventoryService.ReserveStock([]service.StockLine{{ProductID: "P001", Quantity: 3, OrderID: "O2"}})
+		require.NoError(t, err)
+
+		mt.GetStartedEvent() // findAndModify
+		movement := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(t, "RESERVATION", movement.Lookup("type").StringValue())
+		assert.Equal(t, int32(-3), movement.Lookup("quantity").Int32())
+	})
+
+	mt.Run("releases for an order never exceed what it holds", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		// O3 reserved 3 units and got 1 back already
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "inventory.stock_movements", mtest.FirstBatch, bson.D{{Key: "_id", Value: nil}, {Key: "sum", Value: -2}}),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: product("P001", 6)}},
+			mtest.CreateSuccessResponse(),
+		)
+
+		_, err := inventoryService.ReleaseStock([]service.StockLine{{ProductID: "P001", Quantity: 5, OrderID: "O3"}}, "order cancelled")
+		require.NoError(t, err)
+
+		held := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Index(0).Value().Document()
+		assert.Equal(t, "O3", held.Lookup("$match", "order_id").StringValue())
+		assert.Equal(t, int32(2), mt.GetStartedEvent().Command.Lookup("update", "$inc", "stock").Int32())
+
+		// releasing the order again puts nothing back
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "inventory.stock_movements", mtest.FirstBatch, bson.D{{Key: "_id", Value: nil}, {Key: "sum", Value: 0}}))
+		mt.GetStartedEvent() // ledger insert
+		_, err = inventoryService.ReleaseStock([]service.StockLine{{ProductID: "P001", Quantity: 5, OrderID: "O3"}}, "order cancelled")
+		require.NoError(t, err)
+		assert.Equal(t, "aggregate", mt.GetStartedEvent().CommandName)
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+
+	mt.Run("adjustments need a reason", func(mt *mtest.T) {
+		rec := serve(http.MethodPost, "/v1/products/P001/adjust", []byte(`{"quantity": -1}`))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	mt.Run("adjustments never take the stock below zero", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+			mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch, product("P001", 2)),
+		)
+
+		rec := serve(http.MethodPost, "/v1/products/P001/adjust", []byte(`{"quantity": -5, "reason": "damaged"}`))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	mt.Run("movements are listed per product and time range", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		occurred := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "inventory.stock_movements", mtest.FirstBatch, bson.D{
+			{Key: "product_id", Value: "P001"},
+			{Key: "type", Value: "ADJUSTMENT"},
+			{Key: "quantity", Value: -1},
+			{Key: "stock_after", Value: 9},
+			{Key: "reason", Value: "stock take"},
+			{Key: "occurred_at", Value: occurred},
+		}))
+
+		rec := serve(http.MethodGet, "/v1/products/P001/movements?from=2026-03-01T00:00:00Z&to=2026-04-01T00:00:00Z&limit=10", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var movements []models.StockMovement
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&movements))
+		require.Len(t, movements, 1)
+		assert.Equal(t, models.MovementAdjustment, movements[0].Type)
+		assert.Equal(t, "stock take", movements[0].Reason)
+
+		find := mt.GetStartedEvent().Command
+		assert.Equal(t, "P001", find.Lookup("filter", "product_id").StringValue())
+		assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), find.Lookup("filter", "occurred_at", "$gte").Time().UTC())
+		assert.Equal(t, int64(10), find.Lookup("limit").Int64())
+	})
+
+	mt.Run("invalid time ranges are rejected", func(mt *mtest.T) {
+		rec := serve(http.MethodGet, "/v1/products/P001/movements?from=yesterday", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	mt.Run("reconciliation opens the ledger and reports mismatches", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		total := func(tenantID, productID string, sum, opened int) bson.D {
+			return bson.D{
+				{Key: "_id", Value: bson.D{{Key: "tenant_id", Value: tenantID}, {Key: "product_id", Value: productID}}},
+				{Key: "sum", Value: sum},
+				{Key: "opened", Value: opened},
+			}
+		}
+		acmeProduct := append(product("P002", 2), bson.E{Key: "tenant_id", Value: "acme"})
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch, product("P001", 5), acmeProduct),
+			mtest.CreateCursorResponse(0, "inventory.stock_movements", mtest.FirstBatch, total("default", "P001", 4, 1), total("acme", "P002", -1, 0)),
+			// P001 is checked again and still does not match
+			mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch, product("P001", 5)),
+			mtest.CreateCursorResponse(0, "inventory.stock_movements", mtest.FirstBatch, total("default", "P001", 4, 1)),
+			// P002 moved once since the ledger exists, it held 3 units before
+			mtest.CreateCursorResponse(0, "inventory.stock_movements", mtest.FirstBatch, bson.D{
+				{Key: "product_id", Value: "P002"},
+				{Key: "type", Value: "RESERVATION"},
+				{Key: "quantity", Value: -1},
+				{Key: "stock_after", Value: 2},
+			}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		discrepancies, err := inventoryService.Reconcile(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, []models.StockDiscrepancy{{TenantID: "default", ProductID: "P001", Stock: 5, Ledger: 4}}, discrepancies)
+
+		for range 5 {
+			mt.GetStartedEvent()
+		}
+		opening := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(t, "OPENING", opening.Lookup("type").StringValue())
+		assert.Equal(t, "acme", opening.Lookup("tenant_id").StringValue())
+		assert.Equal(t, int32(3), opening.Lookup("quantity").Int32())
+	})
+}
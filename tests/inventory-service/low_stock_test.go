@@ -0,0 +1,157 @@
+package inventory_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/webhook"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestLowStock(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	var delivered []models.LowStockAlert
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, webhook.Sign([]byte("s3cret"), body), r.Header.Get(webhook.SignatureHeader))
+		var alert models.LowStockAlert
+		require.NoError(t, json.Unmarshal(body, &alert))
+		delivered = append(delivered, alert)
+	}))
+	defer subscriber.Close()
+
+	inventoryService := service.NewInventoryService("products", rc, "product-events").
+		WithThresholds(models.StockThresholds{LowStock: 5}).
+		WithWebhooks(webhook.NewSender([]string{subscriber.URL}, "s3cret"))
+	routes := handler.NewInventoryHandler(inventoryService, nil, nil, nil).Routes()
+	serve := func(method, target string, body []byte) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest(method, target, bytes.NewReader(body)))
+		return rec
+	}
+	updated := func(n int) bson.D {
+		return bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: n}, {Key: "nModified", Value: n}}
+	}
+
+	mt.Run("crossing a threshold alerts once", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch,
+				bson.D{{Key: "id", Value: "P001"}, {Key: "name", Value: "Mug"}, {Key: "stock", Value: 8},
+					{Key: "thresholds", Value: bson.D{{Key: "low_stock", Value: 10}, {Key: "out_of_stock", Value: 2}}}},
+				// Restocked since the last check
+				bson.D{{Key: "id", Value: "P002"}, {Key: "stock", Value: 20}, {Key: "stock_status", Value: "LOW_STOCK"}},
+				// Already alerted
+				bson.D{{Key: "id", Value: "P003"}, {Key: "stock", Value: 0}, {Key: "stock_status", Value: "OUT_OF_STOCK"}},
+			),
+			updated(1),
+			updated(1),
+		)
+
+		alerts, err := inventoryService.CheckStockLevels(context.Background())
+		require.NoError(t, err)
+		require.Len(t, alerts, 1)
+		assert.Equal(t, "P001", alerts[0].ProductID)
+		assert.Equal(t, models.LowStock, alerts[0].Status)
+		assert.Equal(t, models.StockThresholds{LowStock: 10, OutOfStock: 2}, alerts[0].Thresholds)
+
+		require.Len(t, delivered, 1)
+		assert.Equal(t, service.EventLowStock, delivered[0].Event)
+		assert.Equal(t, "default", delivered[0].TenantID)
+
+		entries, err := rc.XRange(context.Background(), "product-events", "-", "+").Result()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, service.EventLowStock, entries[0].Values["event"])
+		assert.Equal(t, "LOW_STOCK", entries[0].Values["status"])
+
+		mt.GetStartedEvent() // find
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "LOW_STOCK", update.Lookup("u", "$set", "stock_status").StringValue())
+		update = mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "IN_STOCK", update.Lookup("u", "$set", "stock_status").StringValue())
+	})
+
+	mt.Run("only the replica recording the status alerts", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		delivered = nil
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch, bson.D{{Key: "id", Value: "P001"}, {Key: "stock", Value: 0}}),
+			updated(0),
+		)
+
+		alerts, err := inventoryService.CheckStockLevels(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, alerts)
+		assert.Empty(t, delivered)
+	})
+
+	mt.Run("report lists the products running low", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch,
+			bson.D{{Key: "id", Value: "P001"}, {Key: "name", Value: "Mug"}, {Key: "stock", Value: 0}},
+			bson.D{{Key: "id", Value: "P002"}, {Key: "name", Value: "Cup"}, {Key: "stock", Value: 4}},
+		))
+
+		rec := serve(http.MethodGet, "/v1/products/low-stock", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var report []models.LowStockItem
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+		require.Len(t, report, 2)
+		assert.Equal(t, models.OutOfStock, report[0].Status)
+		assert.Equal(t, models.LowStock, report[1].Status)
+		assert.Equal(t, 5, report[1].Thresholds.LowStock)
+	})
+
+	mt.Run("thresholds are validated", func(mt *mtest.T) {
+		rec := serve(http.MethodPut, "/v1/products/P001/thresholds", []byte(`{"low_stock": 1, "out_of_stock": 3}`))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	mt.Run("thresholds are set per product", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{
+			{Key: "id", Value: "P001"},
+			{Key: "stock", Value: 12},
+			{Key: "version", Value: int64(5)},
+			{Key: "thresholds", Value: bson.D{{Key: "low_stock", Value: 10}, {Key: "out_of_stock", Value: 2}}},
+		}}})
+
+		rec := serve(http.MethodPut, "/v1/products/P001/thresholds", []byte(`{"low_stock": 10, "out_of_stock": 2}`))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"5"`, rec.Header().Get("ETag"))
+
+		set := mt.GetStartedEvent().Command.Lookup("update", "$set", "thresholds").Document()
+		assert.Equal(t, int32(10), set.Lookup("low_stock").Int32())
+	})
+}
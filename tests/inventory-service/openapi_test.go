@@ -0,0 +1,132 @@
+package inventory_service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/api"
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/service"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestInventoryServiceContract(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	doc, err := openapi3.NewLoader().LoadFromData(api.Spec)
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(context.Background()))
+	router, err := legacy.NewRouter(doc)
+	require.NoError(t, err)
+
+	// serve sends the request through the routes and validates the response against the OpenAPI document
+	serve := func(mt *mtest.T, req *http.Request) *httptest.ResponseRecorder {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		route, pathParams, err := router.FindRoute(req)
+		require.NoError(t, err, "%s %s is not documented", req.Method, req.URL.Path)
+
+		var body []byte
+		if req.Body != nil {
+			body, _ = io.ReadAll(req.Body)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		rec := httptest.NewRecorder()
+		handler.NewInventoryHandler(service.NewInventoryService("products", nil, ""), nil, nil, nil).Routes().ServeHTTP(rec, req)
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		input := &openapi3filter.RequestValidationInput{Request: req, PathParams: pathParams, Route: route,
+			Options: &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc}}
+		if rec.Code < 300 {
+			assert.NoError(t, openapi3filter.ValidateRequest(context.Background(), input))
+		}
+		assert.NoError(t, openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 rec.Code,
+			Header:                 rec.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+		}), "%s %s returned %d: %s", req.Method, req.URL.Path, rec.Code, rec.Body.String())
+		return rec
+	}
+
+	product := bson.D{
+		{Key: "id", Value: "P001"},
+		{Key: "name", Value: "Mock Product Name"},
+		{Key: "price", Value: 150.0},
+		{Key: "currency", Value: "EUR"},
+		{Key: "stock", Value: 10},
+		{Key: "version", Value: int64(3)},
+	}
+
+	mt.Run("list products", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch, product))
+
+		rec := serve(mt, httptest.NewRequest(http.MethodGet, "/v1/products", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	mt.Run("get product", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch, product))
+
+		rec := serve(mt, httptest.NewRequest(http.MethodGet, "/v1/products/P001", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+	})
+
+	mt.Run("unknown product", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch))
+
+		rec := serve(mt, httptest.NewRequest(http.MethodGet, "/v1/products/P404", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	mt.Run("restock product", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "value", Value: product},
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/products/P001/restock", strings.NewReader(`{"quantity":2,"reason":"return"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := serve(mt, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	mt.Run("reserve order stock", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "value", Value: product},
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/stock/reserve", strings.NewReader(`{"order_id":"O1","lines":[{"product_id":"P001","quantity":2}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := serve(mt, req)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	mt.Run("reservation beyond the stock", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+			mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch, product),
+		)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/stock/reserve", strings.NewReader(`{"order_id":"O1","lines":[{"product_id":"P001","quantity":20}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := serve(mt, req)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+}
@@ -0,0 +1,95 @@
+package inventory_service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestTenantCatalog(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	tenantsFile := filepath.Join(t.TempDir(), "tenants.json")
+	require.NoError(t, os.WriteFile(tenantsFile, []byte(`{"tenants": {"acme": {"currency": "EUR"}}}`), 0o600))
+	tenants, err := tenant.LoadRegistry(tenantsFile)
+	require.NoError(t, err)
+
+	inventoryService := service.NewInventoryService("products", rc, "product-events")
+	routes := handler.NewInventoryHandler(inventoryService, nil, nil, tenants).Routes()
+	get := func(target, tenantHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if tenantHeader != "" {
+			req.Header.Set(tenant.Header, tenantHeader)
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	mt.Run("the catalog is scoped to the requested tenant", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch, bson.D{
+			{Key: "id", Value: "P001"},
+			{Key: "tenant_id", Value: "acme"},
+			{Key: "stock", Value: 3},
+		}))
+
+		rec := get("/v1/products/P001", "acme")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "tenant_id")
+		assert.Equal(t, "acme", mt.GetStartedEvent().Command.Lookup("filter", "tenant_id").StringValue())
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch))
+		assert.Equal(t, http.StatusOK, get("/v1/products", "").Code)
+		scope := mt.GetStartedEvent().Command.Lookup("filter", "tenant_id", "$in").Array()
+		assert.Equal(t, tenant.Default, scope.Index(0).Value().StringValue())
+	})
+
+	mt.Run("unknown tenants are rejected", func(mt *mtest.T) {
+		rec := get("/v1/products", "initech")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "unknown_tenant")
+	})
+
+	mt.Run("stock events name the tenant", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{
+			{Key: "id", Value: "P001"},
+			{Key: "stock", Value: 5},
+			{Key: "version", Value: int64(2)},
+		}}})
+
+		_, err := inventoryService.ForTenant(tenant.Tenant{ID: "acme"}).RestockProduct("P001", 2, nil)
+		require.NoError(t, err)
+
+		entries, err := rc.XRange(context.Background(), "product-events", "-", "+").Result()
+		require.NoError(t, err)
+		require.NotEmpty(t, entries)
+		assert.Equal(t, "acme", entries[len(entries)-1].Values["tenant_id"])
+	})
+}
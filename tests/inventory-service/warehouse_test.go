@@ -0,0 +1,102 @@
+package inventory_service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/inventory-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/warehouse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestWarehouseStock(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	file := filepath.Join(t.TempDir(), "warehouses.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"warehouses": [{"id": "fra", "name": "Frankfurt", "priority": 1}]}`), 0o600))
+	reg, err := warehouse.LoadRegistry(file)
+	require.NoError(t, err)
+
+	inventoryService := service.NewInventoryService("products", nil, "product-events").WithWarehouses(reg)
+	routes := handler.NewInventoryHandler(inventoryService, nil, nil, nil).Routes()
+	serve := func(method, target string, body []byte) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest(method, target, bytes.NewReader(body)))
+		return rec
+	}
+
+	mt.Run("availability breaks the stock down by warehouse", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "inventory.products", mtest.FirstBatch, bson.D{
+			{Key: "id", Value: "P001"},
+			{Key: "stock", Value: 10},
+			{Key: "warehouses", Value: bson.A{
+				bson.D{{Key: "warehouse_id", Value: "fra"}, {Key: "stock", Value: 6}},
+				bson.D{{Key: "warehouse_id", Value: "old"}, {Key: "stock", Value: 1}},
+			}},
+		}))
+
+		rec := serve(http.MethodGet, "/v1/products/P001/availability", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var availability models.Availability
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&availability))
+		assert.Equal(t, 10, availability.Stock)
+		assert.Equal(t, 3, availability.Unassigned)
+		require.Len(t, availability.Warehouses, 2)
+		assert.Equal(t, "Frankfurt", availability.Warehouses[0].Name)
+		assert.Equal(t, 6, availability.Warehouses[0].Stock)
+		assert.Equal(t, "old", availability.Warehouses[1].ID)
+	})
+
+	mt.Run("restocks add to the warehouse and the total", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{
+			{Key: "id", Value: "P001"},
+			{Key: "stock", Value: 12},
+			{Key: "version", Value: int64(3)},
+		}}})
+
+		rec := serve(http.MethodPost, "/v1/products/P001/restock", []byte(`{"quantity": 2, "warehouse_id": "fra"}`))
+		require.Equal(t, http.StatusOK, rec.Code)
+		cmd := mt.GetStartedEvent().Command
+		assert.Equal(t, "fra", cmd.Lookup("query", "warehouses.warehouse_id").StringValue())
+		assert.Equal(t, int32(2), cmd.Lookup("update", "$inc", "warehouses.$.stock").Int32())
+		assert.Equal(t, int32(2), cmd.Lookup("update", "$inc", "stock").Int32())
+	})
+
+	mt.Run("the first units at a warehouse add it to the product", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "id", Value: "P002"}, {Key: "stock", Value: 2}}}},
+		)
+
+		_, err := inventoryService.RestockWarehouse(service.StockLine{ProductID: "P002", WarehouseID: "fra", Quantity: 2}, "", nil)
+		require.NoError(t, err)
+		mt.GetStartedEvent() // the update of an existing entry
+		pushed := mt.GetStartedEvent().Command.Lookup("update", "$push", "warehouses").Document()
+		assert.Equal(t, "fra", pushed.Lookup("warehouse_id").StringValue())
+	})
+
+	mt.Run("unknown warehouses are rejected", func(mt *mtest.T) {
+		_, err := inventoryService.ReserveStock([]service.StockLine{{ProductID: "P001", WarehouseID: "nyc", Quantity: 1}})
+		assert.ErrorIs(t, err, service.ErrUnknownWarehouse)
+	})
+}
@@ -0,0 +1,189 @@
+package order_processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-processor/processor"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// fakeStock is the stock of inventory-service, reservations take units out of it. Units held at warehouses
+// are counted in units too.
+type fakeStock struct {
+	units      map[string]int
+	warehouses map[string]map[string]int
+	reserved   []processor.StockLine
+	released   []processor.StockLine
+}
+
+func (f *fakeStock) Reserve(ctx context.Context, orderID string, lines []processor.StockLine) error {
+	for _, line := range lines {
+		if f.units[line.ProductID] < line.Quantity {
+			return processor.ErrInsufficientStock
+		}
+		if line.WarehouseID != "" && f.warehouses[line.ProductID][line.WarehouseID] < line.Quantity {
+			return processor.ErrInsufficientStock
+		}
+	}
+	for _, line := range lines {
+		f.units[line.ProductID] -= line.Quantity
+		if line.WarehouseID != "" {
+			f.warehouses[line.ProductID][line.WarehouseID] -= line.Quantity
+		}
+	}
+	f.reserved = append(f.reserved, lines...)
+	return nil
+}
+
+func (f *fakeStock) Release(ctx context.Context, orderID string, lines []processor.StockLine, reason string) error {
+	for _, line := range lines {
+		f.units[line.ProductID] += line.Quantity
+		if line.WarehouseID != "" {
+			f.warehouses[line.ProductID][line.WarehouseID] += line.Quantity
+		}
+	}
+	f.released = append(f.released, lines...)
+	return nil
+}
+
+func (f *fakeStock) Level(ctx context.Context, productID string) (models.StockLevel, error) {
+	level := models.StockLevel{Stock: f.units[productID]}
+	for warehouseID, units := range f.warehouses[productID] {
+		level.Warehouses = append(level.Warehouses, models.WarehouseStock{WarehouseID: warehouseID, Stock: units})
+	}
+	return level, nil
+}
+
+func TestBackorderRelease(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	//launch miniredis for testing purposes
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// Connect go-redis client to miniredis
+	rc := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+
+	created := time.Now().Add(-time.Hour)
+	backordered := func(id primitive.ObjectID, quantity int) bson.D {
+		return bson.D{
+			{Key: "_id", Value: id},
+			{Key: "customer_id", Value: "C001"},
+			{Key: "items", Value: bson.A{bson.D{
+				{Key: "product_id", Value: "P001"},
+				{Key: "quantity", Value: quantity},
+				{Key: "price", Value: 100.0},
+				{Key: "backorder", Value: bson.D{{Key: "mode", Value: "BACKORDER"}}},
+			}}},
+			{Key: "status", Value: "BACKORDERED"},
+			{Key: "version", Value: int64(1)},
+			{Key: "created_at", Value: created},
+		}
+	}
+	restocked := []redis.XMessage{{ID: "1-0", Values: map[string]interface{}{"event": "product.updated", "product_id": "P001", "stock": "4"}}}
+
+	mt.Run("replayed restock releases nothing twice", func(mt *mtest.T) {
+		processor.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		stock := &fakeStock{units: map[string]int{"P001": 4}}
+		backorders := processor.NewBackorders(rc, "product-events", "order-processor-group", "c1", "orders", "notifications", "orders", nil, stock)
+		first, second := primitive.NewObjectID(), primitive.NewObjectID()
+
+		// the restock covers the first order, the second one waits
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, backordered(first, 3), backordered(second, 3)),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+		require.NoError(t, backorders.Release(context.Background(), restocked))
+
+		require.Len(t, stock.reserved, 1)
+		assert.Equal(t, 3, stock.reserved[0].Quantity)
+		assert.Equal(t, 1, stock.units["P001"])
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command
+		assert.Equal(t, first, update.Lookup("updates").Array().Index(0).Value().Document().Lookup("q", "_id").ObjectID())
+		assert.Equal(t, "PENDING", update.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set", "status").StringValue())
+
+		// the same event again still announces 4 units, but only the second order waits and inventory-service
+		// cannot reserve its stock
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, backordered(second, 3)))
+		require.NoError(t, backorders.Release(context.Background(), restocked))
+
+		assert.Len(t, stock.reserved, 1)
+		assert.Equal(t, 1, stock.units["P001"])
+		assert.Equal(t, "find", mt.GetStartedEvent().CommandName)
+		assert.Nil(t, mt.GetStartedEvent())
+
+		entries, err := rc.XRange(context.Background(), "orders", "-", "+").Result()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, first.Hex(), entries[0].Values["order_id"])
+	})
+
+	mt.Run("order changed meanwhile gives its reservation back", func(mt *mtest.T) {
+		processor.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		stock := &fakeStock{units: map[string]int{"P001": 4}}
+		backorders := processor.NewBackorders(rc, "product-events", "order-processor-group", "c1", "orders", "notifications", "orders", nil, stock)
+		first, second := primitive.NewObjectID(), primitive.NewObjectID()
+
+		// the first order was cancelled before its release was written, its stock goes to the second one
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, backordered(first, 3), backordered(second, 2)),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+		require.NoError(t, backorders.Release(context.Background(), restocked))
+
+		require.Len(t, stock.released, 1)
+		assert.Equal(t, 3, stock.released[0].Quantity)
+		require.Len(t, stock.reserved, 2)
+		assert.Equal(t, 2, stock.units["P001"])
+	})
+	mt.Run("released line is allocated to a warehouse", func(mt *mtest.T) {
+		processor.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		// 1 unit is unassigned, the line needs a warehouse holding all 3
+		stock := &fakeStock{units: map[string]int{"P001": 4}, warehouses: map[string]map[string]int{"P001": {"fra": 3}}}
+		backorders := processor.NewBackorders(rc, "product-events", "order-processor-group", "c1", "orders", "notifications", "orders", nil, stock)
+		order := backordered(primitive.NewObjectID(), 3)
+		order = append(order, bson.E{Key: "fulfilments", Value: bson.A{bson.D{
+			{Key: "id", Value: "g1"},
+			{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 3}}}},
+			{Key: "status", Value: "PENDING"},
+		}}})
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, order),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+		require.NoError(t, backorders.Release(context.Background(), restocked))
+
+		require.Len(t, stock.reserved, 1)
+		assert.Equal(t, "fra", stock.reserved[0].WarehouseID)
+		assert.Equal(t, 0, stock.warehouses["P001"]["fra"])
+		mt.GetStartedEvent()
+		set := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+		assert.Equal(t, "fra", set.Lookup("items", "0", "warehouse_id").StringValue())
+		assert.Equal(t, "fra", set.Lookup("fulfilments", "0", "warehouse_id").StringValue())
+		assert.Equal(t, int32(3), set.Lookup("fulfilments", "0", "items", "0", "quantity").Int32())
+	})
+}
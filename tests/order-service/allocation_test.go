@@ -0,0 +1,122 @@
+package order_service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/warehouse"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestWarehouseAllocation(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	file := filepath.Join(t.TempDir(), "warehouses.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"warehouses": [
+		{"id": "fra", "location": {"latitude": 50.11, "longitude": 8.68}, "priority": 2},
+		{"id": "mad", "location": {"latitude": 40.42, "longitude": -3.70}, "priority": 1}
+	]}`), 0o600))
+	reg, err := warehouse.LoadRegistry(file)
+	require.NoError(t, err)
+
+	mockInventory := newMockInventory(
+		models.Product{ID: "P001", Price: 100, Currency: "EUR", Stock: 8, Warehouses: []models.WarehouseStock{{WarehouseID: "fra", Stock: 5}, {WarehouseID: "mad", Stock: 3}}},
+		models.Product{ID: "P002", Price: 20, Currency: "EUR", Stock: 4},
+		models.Product{ID: "P003", Price: 10, Currency: "EUR", Stock: 6, Warehouses: []models.WarehouseStock{{WarehouseID: "fra", Stock: 3}, {WarehouseID: "mad", Stock: 3}}},
+	)
+	defer mockInventory.Close()
+	newService := func(rule warehouse.Rule) *service.OrderService {
+		return service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)).
+			WithAllocator(warehouse.NewAllocator(reg, rule))
+	}
+
+	mt.Run("each line records its warehouse", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		order, err := newService(warehouse.RulePriority).CreateOrder(models.Order{
+			CustomerID: "C001",
+			Items:      []models.LineItem{{ProductID: "P001", Quantity: 4}, {ProductID: "P002", Quantity: 1}},
+		})
+		require.NoError(t, err)
+		// Madrid has priority but only holds 3 units
+		assert.Equal(t, "fra", order.Items[0].WarehouseID)
+		// Products without warehouses ship from their unassigned stock
+		assert.Empty(t, order.Items[1].WarehouseID)
+
+		inserted := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(t, "fra", inserted.Lookup("items").Array().Index(0).Value().Document().Lookup("warehouse_id").StringValue())
+	})
+
+	mt.Run("the closest warehouse fulfils orders with a shipping location", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		order, err := newService(warehouse.RuleClosest).CreateOrder(models.Order{
+			CustomerID: "C001",
+			ShipTo:     &models.Location{Latitude: 41.39, Longitude: 2.17},
+			Items:      []models.LineItem{{ProductID: "P001", Quantity: 1}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "mad", order.Items[0].WarehouseID)
+	})
+
+	mt.Run("lines no single warehouse can fulfil are rejected", func(mt *mtest.T) {
+		_, err := newService(warehouse.RulePriority).CreateOrder(models.Order{
+			CustomerID: "C001",
+			Items:      []models.LineItem{{ProductID: "P003", Quantity: 5}},
+		})
+		var serviceErr *service.Error
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, service.KindInsufficientStock, serviceErr.Kind)
+	})
+
+	mt.Run("amended lines are allocated again", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		orderID := primitive.NewObjectID()
+		orderDoc := bson.D{
+			{Key: "_id", Value: orderID},
+			{Key: "customer_id", Value: "C001"},
+			{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 1}, {Key: "price", Value: 100.0}, {Key: "warehouse_id", Value: "mad"}}}},
+			{Key: "currency", Value: "EUR"},
+			{Key: "status", Value: "PENDING"},
+			{Key: "version", Value: int64(1)},
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: orderDoc}},
+		)
+
+		_, err := newService(warehouse.RulePriority).AmendOrder(orderID.Hex(), service.OrderAmendment{Version: 1, Items: []models.LineItem{{ProductID: "P001", Quantity: 5}}}, nil)
+		require.NoError(t, err)
+
+		mt.GetStartedEvent() // find
+		update := mt.GetStartedEvent().Command.Lookup("update", "$set", "items").Array().Index(0).Value().Document()
+		assert.Equal(t, "fra", update.Lookup("warehouse_id").StringValue())
+	})
+}
@@ -0,0 +1,126 @@
+package order_service
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAmendOrder(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	//launch miniredis for testing purposes
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// Connect go-redis client to miniredis
+	rc := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+
+	// Mock inventory service
+	mockInventory := newMockInventory(
+		models.Product{ID: "P001", Stock: 5, Price: 100},
+		models.Product{ID: "P002", Stock: 5, Price: 100},
+	)
+	defer mockInventory.Close()
+
+	orderID := primitive.NewObjectID()
+	pendingOrder := bson.D{
+		{Key: "_id", Value: orderID},
+		{Key: "customer_id", Value: "C001"},
+		{Key: "items", Value: bson.A{
+			bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}, {Key: "price", Value: 150.0}},
+		}},
+		{Key: "total", Value: 300.0},
+		{Key: "status", Value: "PENDING"},
+		{Key: "version", Value: int64(1)},
+	}
+
+	mt.Run("amend quantities and add item", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		amended := bson.D{
+			{Key: "_id", Value: orderID},
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 3}, {Key: "price", Value: 150.0}},
+				bson.D{{Key: "product_id", Value: "P002"}, {Key: "quantity", Value: 1}, {Key: "price", Value: 100.0}},
+			}},
+			{Key: "total", Value: 550.0},
+			{Key: "status", Value: "PENDING"},
+			{Key: "version", Value: int64(2)},
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, pendingOrder),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: amended}},
+		)
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		order, err := orderService.AmendOrder(orderID.Hex(), service.OrderAmendment{
+			Version: 1,
+			Items: []models.LineItem{
+				{ProductID: "P001", Quantity: 3},
+				{ProductID: "P002", Quantity: 1},
+			},
+		}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), order.Version)
+
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command
+		// existing line keeps its price, the new line uses the current price
+		assert.Equal(t, 550.0, update.Lookup("update", "$set", "total").Double())
+		assert.Equal(t, int64(1), update.Lookup("query", "version").AsInt64())
+
+		entries, err := rc.XRange(mt.Context(), "orders", "-", "+").Result()
+		assert.NoError(t, err)
+		assert.Equal(t, service.EventOrderAmended, entries[len(entries)-1].Values["event"])
+	})
+
+	mt.Run("reject stale version", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, pendingOrder))
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		_, err := orderService.AmendOrder(orderID.Hex(), service.OrderAmendment{
+			Version: 0,
+			Items:   []models.LineItem{{ProductID: "P001", Quantity: 1}},
+		}, nil)
+		assert.ErrorIs(t, err, service.ErrVersionConflict)
+	})
+
+	mt.Run("revalidate stock", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, pendingOrder))
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		// the 2 units the order holds count, 5 more are in stock
+		_, err := orderService.AmendOrder(orderID.Hex(), service.OrderAmendment{
+			Version: 1,
+			Items:   []models.LineItem{{ProductID: "P001", Quantity: 8}},
+		}, nil)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "insufficient stock")
+	})
+}
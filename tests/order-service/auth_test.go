@@ -0,0 +1,138 @@
+package order_service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/rpc"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	orderv1 "github.com/dinesh-man/ecommerce-order-processing-system/pkg/pb/order/v1"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestOrderAuthorization(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	//launch miniredis for testing purposes
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// Connect go-redis client to miniredis
+	rc := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+
+	secret := []byte("test-secret")
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: secret})
+	require.NoError(t, err)
+	token := func(role, customerID string) string {
+		token, err := auth.SignHS256(secret, auth.NewClaims(role, customerID, "tester", time.Minute))
+		require.NoError(t, err)
+		return token
+	}
+
+	orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+	routes := handler.NewOrderHandler(orderService, "", handler.DefaultOrderLimits(), verifier, nil).Routes()
+	call := func(method, target, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	orderID := primitive.NewObjectID()
+	orderDoc := bson.D{
+		{Key: "_id", Value: orderID},
+		{Key: "customer_id", Value: "C001"},
+		{Key: "status", Value: "PENDING"},
+		{Key: "version", Value: int64(1)},
+	}
+
+	mt.Run("requests without a token are rejected", func(mt *mtest.T) {
+		rec := call(http.MethodGet, "/v1/orders", "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+
+		assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/v1/orders", "not-a-jwt").Code)
+	})
+
+	mt.Run("customers only list their own orders", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc))
+
+		rec := call(http.MethodGet, "/v1/orders", token(auth.RoleCustomer, "C001"))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "C001", mt.GetStartedEvent().Command.Lookup("filter", "customer_id").StringValue())
+
+		assert.Equal(t, http.StatusForbidden, call(http.MethodGet, "/v1/orders?customer_id=C002", token(auth.RoleCustomer, "C001")).Code)
+		assert.Equal(t, http.StatusForbidden, call(http.MethodGet, "/v1/customers/C002/orders", token(auth.RoleCustomer, "C001")).Code)
+	})
+
+	mt.Run("other customers' orders are not found", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc),
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc),
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc),
+		)
+
+		assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/v1/orders/"+orderID.Hex(), token(auth.RoleCustomer, "C002")).Code)
+		assert.Equal(t, http.StatusNotFound, call(http.MethodPost, "/v1/orders/"+orderID.Hex()+"/cancel", token(auth.RoleCustomer, "C002")).Code)
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/v1/orders/"+orderID.Hex(), token(auth.RoleSupport, "")).Code)
+	})
+
+	mt.Run("shipments and return decisions need staff", func(mt *mtest.T) {
+		assert.Equal(t, http.StatusForbidden, call(http.MethodPost, "/v1/orders/"+orderID.Hex()+"/shipments", token(auth.RoleCustomer, "C001")).Code)
+		assert.Equal(t, http.StatusForbidden, call(http.MethodPost, "/v1/orders/"+orderID.Hex()+"/returns/R1/approve", token(auth.RoleCustomer, "C001")).Code)
+		assert.Equal(t, http.StatusForbidden, call(http.MethodGet, "/debug/vars", token(auth.RoleSupport, "")).Code)
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/openapi.json", "").Code)
+	})
+
+	mt.Run("gRPC calls are authenticated", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		client := orderv1.NewOrderServiceClient(serveBufconn(t, func(s *grpc.Server) {
+			orderv1.RegisterOrderServiceServer(s, rpc.NewOrderServer(orderService, handler.DefaultOrderLimits()))
+		}, grpc.UnaryInterceptor(auth.UnaryServerInterceptor(verifier))))
+
+		_, err := client.GetOrder(context.Background(), &orderv1.GetOrderRequest{Id: orderID.Hex()})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc))
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token(auth.RoleCustomer, "C002"))
+		_, err = client.GetOrder(ctx, &orderv1.GetOrderRequest{Id: orderID.Hex()})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		_, err = client.ListOrders(ctx, &orderv1.ListOrdersRequest{CustomerId: "C001"})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+}
@@ -0,0 +1,97 @@
+package order_service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestBackorders(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	availableAt := time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+	mockInventory := newMockInventory(
+		models.Product{ID: "P001", Price: 100, Currency: "EUR", Stock: 5},
+		models.Product{ID: "P002", Price: 20, Currency: "EUR", Stock: 0, Backorder: &models.BackorderPolicy{Mode: models.PreOrder, AvailableAt: &availableAt}},
+		models.Product{ID: "P003", Price: 10, Currency: "EUR", Stock: 1},
+	)
+	defer mockInventory.Close()
+	orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+
+	mt.Run("short lines of backorderable products wait for stock", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		order, err := orderService.CreateOrder(models.Order{
+			CustomerID: "C001",
+			Items:      []models.LineItem{{ProductID: "P001", Quantity: 2}, {ProductID: "P002", Quantity: 3}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, models.Backordered, order.Status)
+		assert.Equal(t, 260.0, order.Total)
+		assert.Nil(t, order.Items[0].Backorder)
+		require.NotNil(t, order.Items[1].Backorder)
+		assert.Equal(t, models.PreOrder, order.Items[1].Backorder.Mode)
+		assert.True(t, order.Items[1].Backorder.Waiting())
+		assert.Equal(t, models.Backordered, order.History[0].Status)
+
+		inserted := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(t, "BACKORDERED", inserted.Lookup("status").StringValue())
+		assert.Equal(t, "PRE_ORDER", inserted.Lookup("items").Array().Index(1).Value().Document().Lookup("backorder", "mode").StringValue())
+
+		// The processor only sees the order once it is released
+		length, err := rc.XLen(context.Background(), "orders").Result()
+		require.NoError(t, err)
+		assert.Zero(t, length)
+	})
+
+	mt.Run("products without a backorder policy are still rejected", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		_, err := orderService.CreateOrder(models.Order{
+			CustomerID: "C001",
+			Items:      []models.LineItem{{ProductID: "P002", Quantity: 1}, {ProductID: "P003", Quantity: 2}},
+		})
+		var serviceErr *service.Error
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, "insufficient_stock", serviceErr.Code)
+	})
+
+	mt.Run("backordered orders are cancelled like pending ones", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "_id", Value: id}, {Key: "status", Value: "BACKORDERED"}}}})
+
+		require.NoError(t, orderService.CancelOrder(id.Hex(), nil))
+
+		filter := mt.GetStartedEvent().Command.Lookup("query").Document()
+		statuses := filter.Lookup("status", "$in").Array()
+		assert.Equal(t, "BACKORDERED", statuses.Index(1).Value().StringValue())
+	})
+}
@@ -4,9 +4,12 @@ import (
 	"testing"
 
 	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
 	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -28,23 +31,39 @@ func TestCancelOrder(t *testing.T) {
 		Addr: mr.Addr(),
 	})
 
+	stockInventory, movements := newStockRecorder()
+	defer stockInventory.Close()
+
 	mt.Run("cancel pending order", func(mt *mtest.T) {
 		service.GetCollection = func(name string) *mongo.Collection {
 			return mt.Coll
 		}
 
-		orderService := service.NewOrderService("orders", "", rc, "orders")
-		id := primitive.NewObjectID().Hex()
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(stockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		id := primitive.NewObjectID()
+		*movements = nil
 
 		mt.AddMockResponses(bson.D{
-			{"ok", 1},
-			{"n", 1},
-			{"nModified", 1},
-			{"matchedCount", 1},
+			{Key: "ok", Value: 1},
+			{Key: "value", Value: bson.D{
+				{Key: "_id", Value: id},
+				{Key: "status", Value: "PENDING"},
+				{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}, {Key: "warehouse_id", Value: "fra"}}}},
+			}},
 		})
 
-		err := orderService.CancelOrder(id)
+		err := orderService.CancelOrder(id.Hex(), nil)
 		assert.NoError(t, err)
+
+		// the stock reserved for the deleted order goes back to inventory-service
+		require.Len(t, *movements, 1)
+		released := (*movements)[0]
+		assert.Equal(t, "release", released.Movement)
+		assert.Equal(t, id.Hex(), released.OrderID)
+		require.Len(t, released.Lines, 1)
+		assert.Equal(t, "P001", released.Lines[0].ProductID)
+		assert.Equal(t, "fra", released.Lines[0].WarehouseID)
+		assert.Equal(t, 2, released.Lines[0].Quantity)
 	})
 
 	mt.Run("fail to cancel non-pending order", func(mt *mtest.T) {
@@ -52,18 +71,84 @@ func TestCancelOrder(t *testing.T) {
 			return mt.Coll
 		}
 
-		orderService := service.NewOrderService("orders", "", rc, "orders")
-		id := primitive.NewObjectID().Hex()
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		id := primitive.NewObjectID()
 
 		mt.AddMockResponses(bson.D{
-			{"ok", 1},
-			{"n", 0},
-			{"nModified", 0},
-			{"matchedCount", 0},
-		})
+			{Key: "ok", Value: 1},
+			{Key: "value", Value: nil},
+		}, mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch), mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: id},
+			{Key: "status", Value: "SHIPPED"},
+		}))
 
-		err := orderService.CancelOrder(id)
+		err := orderService.CancelOrder(id.Hex(), nil)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "order cannot be cancelled")
 	})
+
+	processingOrder := func(id primitive.ObjectID) bson.D {
+		return bson.D{
+			{Key: "_id", Value: id},
+			{Key: "status", Value: "PROCESSING"},
+			{Key: "total", Value: 300.0},
+			{Key: "version", Value: int64(3)},
+			{Key: "payment", Value: bson.D{
+				{Key: "provider", Value: "fake"},
+				{Key: "transaction_id", Value: "fake_tx"},
+				{Key: "amount", Value: 300.0},
+				{Key: "status", Value: "AUTHORIZED"},
+			}},
+		}
+	}
+
+	mt.Run("cancel processing order voids payment", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		id := primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, processingOrder(id)),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+
+		err := orderService.CancelOrder(id.Hex(), nil)
+		assert.NoError(t, err)
+
+		// the order is cancelled together with the voided payment, at the version that was read
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, int64(3), update.Lookup("q", "version").AsInt64())
+		assert.Equal(t, "CANCELLED", update.Lookup("u", "$set", "status").StringValue())
+		assert.Equal(t, "VOIDED", update.Lookup("u", "$set", "payment", "status").StringValue())
+	})
+
+	mt.Run("failed void leaves the order processing", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Decline, 0, 0))
+		id := primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, processingOrder(id)),
+		)
+
+		err := orderService.CancelOrder(id.Hex(), nil)
+		var serviceErr *service.Error
+		assert.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, "payment_unavailable", serviceErr.Code)
+
+		// nothing is written, so the cancellation can be retried
+		mt.GetStartedEvent()
+		assert.Equal(t, "find", mt.GetStartedEvent().CommandName)
+		assert.Nil(t, mt.GetStartedEvent())
+	})
 }
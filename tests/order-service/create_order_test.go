@@ -1,15 +1,21 @@
 package order_service
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
 	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
 	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
@@ -23,6 +29,116 @@ var (
 	sk string
 )
 
+// newMockInventory serves the products over the inventory REST API, both one by one and as the stock batch
+func newMockInventory(products ...models.Product) *httptest.Server {
+	return httptest.NewServer(mockInventoryHandler(false, products...))
+}
+
+// mockInventoryHandler serves the products and the /v1/stock endpoints of the mock inventory service. When
+// tracked is set reservations take the units out of the served stock and releases put them back, otherwise
+// the stock never changes.
+func mockInventoryHandler(tracked bool, products ...models.Product) http.Handler {
+	byID := map[string]models.Product{}
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+	var mu sync.Mutex
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/products/{id}", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		product, ok := byID[r.PathValue("id")]
+		mu.Unlock()
+		if !ok {
+			http.Error(w, "product not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(product)
+	})
+	mux.HandleFunc("GET /v1/products", func(w http.ResponseWriter, r *http.Request) {
+		found := []models.Product{}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			if product, ok := byID[id]; ok {
+				found = append(found, product)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(found)
+	})
+	// Reservations succeed as long as the served stock covers every line
+	move := func(w http.ResponseWriter, r *http.Request, sign int) {
+		var req struct {
+			Lines []struct {
+				ProductID   string `json:"product_id"`
+				WarehouseID string `json:"warehouse_id"`
+				Quantity    int    `json:"quantity"`
+			} `json:"lines"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, line := range req.Lines {
+			if product, ok := byID[line.ProductID]; !ok || product.Stock < line.Quantity && sign < 0 {
+				http.Error(w, "insufficient stock", http.StatusConflict)
+				return
+			}
+		}
+		if tracked {
+			for _, line := range req.Lines {
+				product := byID[line.ProductID]
+				product.Stock += sign * line.Quantity
+				product.Warehouses = append([]models.WarehouseStock(nil), product.Warehouses...)
+				for i := range product.Warehouses {
+					if product.Warehouses[i].WarehouseID == line.WarehouseID {
+						product.Warehouses[i].Stock += sign * line.Quantity
+					}
+				}
+				byID[line.ProductID] = product
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+	mux.HandleFunc("POST /v1/stock/reserve", func(w http.ResponseWriter, r *http.Request) { move(w, r, -1) })
+	mux.HandleFunc("POST /v1/stock/release", func(w http.ResponseWriter, r *http.Request) { move(w, r, 1) })
+	mux.HandleFunc("POST /v1/stock/{movement}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+// stockMovement is a call to one of the /v1/stock endpoints of inventory-service
+type stockMovement struct {
+	Movement string
+	OrderID  string `json:"order_id"`
+	Reason   string `json:"reason"`
+	Lines    []struct {
+		ProductID   string `json:"product_id"`
+		WarehouseID string `json:"warehouse_id"`
+		Quantity    int    `json:"quantity"`
+	} `json:"lines"`
+}
+
+// newStockRecorder mocks inventory-service like newMockInventory, with reservations and releases changing
+// the served stock, and records every call to the /v1/stock endpoints
+func newStockRecorder(products ...models.Product) (*httptest.Server, *[]stockMovement) {
+	var movements []stockMovement
+	next := mockInventoryHandler(true, products...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if movement, ok := strings.CutPrefix(r.URL.Path, "/v1/stock/"); ok {
+			body, _ := io.ReadAll(r.Body)
+			recorded := stockMovement{Movement: movement}
+			json.Unmarshal(body, &recorded)
+			movements = append(movements, recorded)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		next.ServeHTTP(w, r)
+	}))
+	return server, &movements
+}
+
 func TestCreateOrder(t *testing.T) {
 	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
 
@@ -39,16 +155,12 @@ func TestCreateOrder(t *testing.T) {
 	})
 
 	// Mock inventory service
-	mockInventory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		product := models.Product{
-			ID:    "P001",
-			Name:  "Mock Product Name",
-			Stock: 10,
-			Price: 150,
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(product)
-	}))
+	mockInventory := newMockInventory(models.Product{
+		ID:    "P001",
+		Name:  "Mock Product Name",
+		Stock: 10,
+		Price: 150,
+	})
 	defer mockInventory.Close()
 
 	mt.Run("order service test", func(mt *mtest.T) {
@@ -69,12 +181,13 @@ func TestCreateOrder(t *testing.T) {
 		}
 		defer func() { service.GetCollection = originalGetCollection }()
 
-		orderService := service.NewOrderService("orders", mockInventory.URL, rc, "orders")
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
 		createdOrder, err := orderService.CreateOrder(order)
 
 		assert.NoError(t, err)
 		assert.Equal(t, models.Pending, createdOrder.Status)
 		assert.NotEqual(t, primitive.NilObjectID, createdOrder.ID)
+		assert.Equal(t, 300.0, createdOrder.Total)
 
 		// Simulate FindOne response for GetOrderByID
 		orderDoc := bson.D{
@@ -84,8 +197,10 @@ func TestCreateOrder(t *testing.T) {
 				bson.D{
 					{"product_id", "P001"},
 					{"quantity", 2},
+					{"price", 150.0},
 				},
 			}},
+			{"total", createdOrder.Total},
 			{"status", string(createdOrder.Status)},
 			{"created_at", createdOrder.CreatedAt},
 			{"updated_at", createdOrder.UpdatedAt},
@@ -99,6 +214,7 @@ func TestCreateOrder(t *testing.T) {
 		assert.Equal(t, createdOrder.CustomerID, fetchedOrder.CustomerID)
 		assert.Equal(t, createdOrder.Status, fetchedOrder.Status)
 		assert.Equal(t, createdOrder.Items, fetchedOrder.Items)
+		assert.Equal(t, createdOrder.Total, fetchedOrder.Total)
 		assert.WithinDuration(t, createdOrder.CreatedAt, fetchedOrder.CreatedAt, time.Second)
 		assert.WithinDuration(t, createdOrder.UpdatedAt, fetchedOrder.UpdatedAt, time.Second)
 	})
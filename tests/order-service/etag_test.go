@@ -0,0 +1,138 @@
+package order_service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestOrderETags(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	//launch miniredis for testing purposes
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// Connect go-redis client to miniredis
+	rc := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+
+	orderID := primitive.NewObjectID()
+	orderDoc := bson.D{
+		{Key: "_id", Value: orderID},
+		{Key: "customer_id", Value: "C001"},
+		{Key: "status", Value: "PENDING"},
+		{Key: "version", Value: int64(2)},
+	}
+
+	mt.Run("get order returns version as ETag", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		orderHandler := handler.NewOrderHandler(service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)), "", handler.DefaultOrderLimits(), nil, nil)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc))
+
+		rec := httptest.NewRecorder()
+		orderHandler.GetOrderHandler(rec, httptest.NewRequest(http.MethodGet, "/order?id="+orderID.Hex(), nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+	})
+
+	mt.Run("cancel with stale If-Match fails precondition", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		orderHandler := handler.NewOrderHandler(service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)), "", handler.DefaultOrderLimits(), nil, nil)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc))
+
+		req := httptest.NewRequest(http.MethodDelete, "/order/cancel?id="+orderID.Hex(), nil)
+		req.Header.Set("If-Match", `"1"`)
+		rec := httptest.NewRecorder()
+		orderHandler.CancelOrderHandler(rec, req)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	})
+
+	mt.Run("malformed If-Match is a bad request", func(mt *mtest.T) {
+		orderHandler := handler.NewOrderHandler(service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)), "", handler.DefaultOrderLimits(), nil, nil)
+
+		req := httptest.NewRequest(http.MethodDelete, "/order/cancel?id="+orderID.Hex(), nil)
+		req.Header.Set("If-Match", "v1")
+		rec := httptest.NewRecorder()
+		orderHandler.CancelOrderHandler(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "invalid_if_match")
+	})
+	mt.Run("weak If-Match fails precondition", func(mt *mtest.T) {
+		orderHandler := handler.NewOrderHandler(service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)), "", handler.DefaultOrderLimits(), nil, nil)
+
+		req := httptest.NewRequest(http.MethodDelete, "/order/cancel?id="+orderID.Hex(), nil)
+		req.Header.Set("If-Match", `W/"2"`)
+		rec := httptest.NewRecorder()
+		orderHandler.CancelOrderHandler(rec, req)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	})
+
+	mt.Run("If-Match list with the current version passes", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		orderHandler := handler.NewOrderHandler(service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)), "", handler.DefaultOrderLimits(), nil, nil)
+
+		// the current version is looked up for the list, checked again and the pending order is deleted
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc),
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: orderDoc}},
+		)
+
+		req := httptest.NewRequest(http.MethodDelete, "/order/cancel?id="+orderID.Hex(), nil)
+		req.Header.Set("If-Match", `"1", "2"`)
+		rec := httptest.NewRecorder()
+		orderHandler.CancelOrderHandler(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		deleted := mt.GetStartedEvent().Command.Lookup("query", "version")
+		assert.Equal(t, int64(2), deleted.Int64())
+	})
+	mt.Run("weak entries of an If-Match list are skipped", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		orderHandler := handler.NewOrderHandler(service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)), "", handler.DefaultOrderLimits(), nil, nil)
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: orderDoc}},
+		)
+
+		req := httptest.NewRequest(http.MethodDelete, "/order/cancel?id="+orderID.Hex(), nil)
+		req.Header.Set("If-Match", `"2", W/"3"`)
+		rec := httptest.NewRecorder()
+		orderHandler.CancelOrderHandler(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		mt.GetStartedEvent()
+		deleted := mt.GetStartedEvent().Command.Lookup("query", "version")
+		assert.Equal(t, int64(2), deleted.Int64())
+	})
+}
@@ -0,0 +1,165 @@
+package order_service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestFulfilmentGroups(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	mockInventory := newMockInventory(
+		models.Product{ID: "P001", Price: 100, Currency: "EUR", Stock: 5, Warehouses: []models.WarehouseStock{{WarehouseID: "fra", Stock: 5}}},
+		models.Product{ID: "P002", Price: 20, Currency: "EUR", Stock: 4, Warehouses: []models.WarehouseStock{{WarehouseID: "mad", Stock: 4}}},
+	)
+	defer mockInventory.Close()
+	newService := func() *service.OrderService {
+		return service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+	}
+
+	orderID := primitive.NewObjectID()
+	splitOrder := func(status string, groups bson.A, shipments bson.A) bson.D {
+		return bson.D{
+			{Key: "_id", Value: orderID},
+			{Key: "customer_id", Value: "C001"},
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}, {Key: "price", Value: 100.0}, {Key: "warehouse_id", Value: "fra"}},
+				bson.D{{Key: "product_id", Value: "P002"}, {Key: "quantity", Value: 1}, {Key: "price", Value: 20.0}, {Key: "warehouse_id", Value: "mad"}},
+			}},
+			{Key: "total", Value: 220.0},
+			{Key: "currency", Value: "EUR"},
+			{Key: "status", Value: status},
+			{Key: "version", Value: int64(2)},
+			{Key: "payment", Value: bson.D{
+				{Key: "provider", Value: "fake"},
+				{Key: "transaction_id", Value: "fake_tx"},
+				{Key: "amount", Value: 220.0},
+				{Key: "status", Value: "AUTHORIZED"},
+			}},
+			{Key: "fulfilments", Value: groups},
+			{Key: "shipments", Value: shipments},
+		}
+	}
+	group := func(id, warehouseID, productID string, quantity int, status string) bson.D {
+		return bson.D{
+			{Key: "id", Value: id},
+			{Key: "warehouse_id", Value: warehouseID},
+			{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: productID}, {Key: "quantity", Value: quantity}}}},
+			{Key: "status", Value: status},
+		}
+	}
+	shipment := func(id, fulfilmentID, trackingNumber, productID string, quantity int, status string) bson.D {
+		return bson.D{
+			{Key: "id", Value: id},
+			{Key: "fulfilment_id", Value: fulfilmentID},
+			{Key: "carrier", Value: "UPS"},
+			{Key: "tracking_number", Value: trackingNumber},
+			{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: productID}, {Key: "quantity", Value: quantity}}}},
+			{Key: "status", Value: status},
+		}
+	}
+	updated := bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}}
+
+	mt.Run("orders are split by warehouse", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		order, err := newService().CreateOrder(models.Order{
+			CustomerID: "C001",
+			Items:      []models.LineItem{{ProductID: "P001", Quantity: 2}, {ProductID: "P002", Quantity: 1}},
+		})
+		require.NoError(t, err)
+		require.Len(t, order.Fulfilments, 2)
+		assert.Equal(t, "fra", order.Fulfilments[0].WarehouseID)
+		assert.Equal(t, []models.ShipmentItem{{ProductID: "P001", Quantity: 2}}, order.Fulfilments[0].Items)
+		assert.Equal(t, "mad", order.Fulfilments[1].WarehouseID)
+		assert.Equal(t, models.FulfilmentPending, order.Fulfilments[1].Status)
+		assert.NotEqual(t, order.Fulfilments[0].ID, order.Fulfilments[1].ID)
+	})
+
+	mt.Run("a shipment needs its group when several are open", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		groups := bson.A{group("G1", "fra", "P001", 2, "PROCESSING"), group("G2", "mad", "P002", 1, "PROCESSING")}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, splitOrder("PROCESSING", groups, bson.A{})))
+
+		_, err := newService().CreateShipment(orderID.Hex(), models.Shipment{Carrier: "UPS", TrackingNumber: "1Z1"}, nil)
+		var serviceErr *service.Error
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, "fulfilment_required", serviceErr.Code)
+	})
+
+	mt.Run("the group is derived from the shipped items", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		groups := bson.A{group("G1", "fra", "P001", 2, "PROCESSING"), group("G2", "mad", "P002", 1, "PROCESSING")}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, splitOrder("PROCESSING", groups, bson.A{})), updated)
+
+		created, err := newService().CreateShipment(orderID.Hex(), models.Shipment{
+			Carrier:        "UPS",
+			TrackingNumber: "1Z2",
+			Items:          []models.ShipmentItem{{ProductID: "P002", Quantity: 1}},
+		}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "G2", created.FulfilmentID)
+	})
+
+	mt.Run("the order is partially shipped until every group left", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		groups := bson.A{group("G1", "fra", "P001", 2, "PROCESSING"), group("G2", "mad", "P002", 1, "PROCESSING")}
+		shipments := bson.A{shipment("S1", "G1", "1Z1", "P001", 2, "LABEL_CREATED")}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, splitOrder("PROCESSING", groups, shipments)), updated)
+
+		order, err := newService().HandleCarrierEvent(models.CarrierEvent{TrackingNumber: "1Z1", Status: models.InTransit, OccurredAt: time.Now()})
+		require.NoError(t, err)
+		assert.Equal(t, models.PartiallyShipped, order.Status)
+		assert.Equal(t, models.FulfilmentShipped, order.Fulfilments[0].Status)
+		assert.Equal(t, models.FulfilmentProcessing, order.Fulfilments[1].Status)
+		// The payment is only captured once the whole order shipped
+		assert.Equal(t, models.PaymentAuthorized, order.Payment.Status)
+	})
+
+	mt.Run("the last group shipping ships the order", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		groups := bson.A{group("G1", "fra", "P001", 2, "SHIPPED"), group("G2", "mad", "P002", 1, "PROCESSING")}
+		shipments := bson.A{
+			shipment("S1", "G1", "1Z1", "P001", 2, "IN_TRANSIT"),
+			shipment("S2", "G2", "1Z2", "P002", 1, "LABEL_CREATED"),
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, splitOrder("PARTIALLY_SHIPPED", groups, shipments)), updated, updated)
+
+		order, err := newService().HandleCarrierEvent(models.CarrierEvent{TrackingNumber: "1Z2", Status: models.InTransit, OccurredAt: time.Now()})
+		require.NoError(t, err)
+		assert.Equal(t, models.Shipped, order.Status)
+		assert.Equal(t, models.FulfilmentShipped, order.Fulfilments[1].Status)
+		assert.Equal(t, models.PaymentCaptured, order.Payment.Status)
+	})
+}
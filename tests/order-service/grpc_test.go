@@ -0,0 +1,150 @@
+package order_service
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/rpc"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	inventoryv1 "github.com/dinesh-man/ecommerce-order-processing-system/pkg/pb/inventory/v1"
+	orderv1 "github.com/dinesh-man/ecommerce-order-processing-system/pkg/pb/order/v1"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeInventory is an in-memory inventory gRPC server
+type fakeInventory struct {
+	inventoryv1.UnimplementedInventoryServiceServer
+	products map[string]*inventoryv1.Product
+}
+
+func (f *fakeInventory) GetProduct(ctx context.Context, req *inventoryv1.GetProductRequest) (*inventoryv1.GetProductResponse, error) {
+	product, ok := f.products[req.GetId()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "product not found")
+	}
+	return &inventoryv1.GetProductResponse{Product: product}, nil
+}
+
+func (f *fakeInventory) BatchGetProducts(ctx context.Context, req *inventoryv1.BatchGetProductsRequest) (*inventoryv1.BatchGetProductsResponse, error) {
+	resp := &inventoryv1.BatchGetProductsResponse{}
+	for _, id := range req.GetIds() {
+		if product, ok := f.products[id]; ok {
+			resp.Products = append(resp.Products, product)
+		} else {
+			resp.MissingIds = append(resp.MissingIds, id)
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeInventory) ReserveStock(ctx context.Context, req *inventoryv1.ReserveStockRequest) (*inventoryv1.ReserveStockResponse, error) {
+	for _, line := range req.GetLines() {
+		product, ok := f.products[line.GetProductId()]
+		if !ok {
+			return nil, status.Error(codes.NotFound, "product not found")
+		}
+		if product.GetStock() < line.GetQuantity() {
+			return nil, status.Error(codes.FailedPrecondition, "insufficient stock")
+		}
+	}
+	return &inventoryv1.ReserveStockResponse{}, nil
+}
+
+// serveBufconn starts a gRPC server in memory and returns a client connection to it
+func serveBufconn(t *testing.T, register func(*grpc.Server), opts ...grpc.ServerOption) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(opts...)
+	register(server)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestOrderGRPC(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	//launch miniredis for testing purposes
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// Connect go-redis client to miniredis
+	rc := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+
+	inventoryConn := serveBufconn(t, func(s *grpc.Server) {
+		inventoryv1.RegisterInventoryServiceServer(s, &fakeInventory{products: map[string]*inventoryv1.Product{
+			"P001": {Id: "P001", Price: 150, Currency: "EUR", Stock: 10},
+		}})
+	})
+	orderService := service.NewOrderService("orders", inventory.NewGRPCClient(inventoryConn), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+	client := orderv1.NewOrderServiceClient(serveBufconn(t, func(s *grpc.Server) {
+		orderv1.RegisterOrderServiceServer(s, rpc.NewOrderServer(orderService, handler.DefaultOrderLimits()))
+	}))
+
+	mt.Run("create order priced by the gRPC inventory", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		resp, err := client.CreateOrder(context.Background(), &orderv1.CreateOrderRequest{
+			CustomerId: "C001",
+			Items:      []*orderv1.OrderItem{{ProductId: "P001", Quantity: 2}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "PENDING", resp.GetOrder().GetStatus())
+		assert.Equal(t, 300.0, resp.GetOrder().GetTotal())
+		assert.Equal(t, "EUR", resp.GetOrder().GetCurrency())
+	})
+
+	mt.Run("unknown product is an invalid argument", func(mt *mtest.T) {
+		_, err := client.CreateOrder(context.Background(), &orderv1.CreateOrderRequest{
+			CustomerId: "C001",
+			Items:      []*orderv1.OrderItem{{ProductId: "P404", Quantity: 1}},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	mt.Run("invalid request is rejected before the service", func(mt *mtest.T) {
+		_, err := client.CreateOrder(context.Background(), &orderv1.CreateOrderRequest{
+			Items: []*orderv1.OrderItem{{ProductId: "P001", Quantity: 0}},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Contains(t, status.Convert(err).Message(), "customer_id is required")
+	})
+
+	mt.Run("unknown order is not found", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch))
+
+		_, err := client.GetOrder(context.Background(), &orderv1.GetOrderRequest{Id: primitive.NewObjectID().Hex()})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
@@ -0,0 +1,107 @@
+package order_service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResilientInventoryClient(t *testing.T) {
+	cfg := inventory.Config{
+		Timeout:          time.Second,
+		MaxRetries:       2,
+		BaseBackoff:      time.Millisecond,
+		MaxBackoff:       5 * time.Millisecond,
+		FailureThreshold: 3,
+		Cooldown:         50 * time.Millisecond,
+	}
+
+	// mockInventory fails the first `failures` calls with 503
+	mockInventory := func(failures int32) (*httptest.Server, *atomic.Int32) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.URL.Path == "/v1/products/P404" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(models.Product{ID: "P001", Price: 150})
+		}))
+		t.Cleanup(server.Close)
+		return server, &calls
+	}
+
+	t.Run("reads are retried", func(t *testing.T) {
+		server, calls := mockInventory(2)
+		client := inventory.NewResilientClient(inventory.NewHTTPClient(server.URL, 0, ""), cfg)
+
+		product, err := client.GetProduct(context.Background(), "P001")
+		require.NoError(t, err)
+		assert.Equal(t, 150.0, product.Price)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("unknown products are not retried", func(t *testing.T) {
+		server, calls := mockInventory(0)
+		client := inventory.NewResilientClient(inventory.NewHTTPClient(server.URL, 0, ""), cfg)
+
+		_, err := client.GetProduct(context.Background(), "P404")
+		assert.ErrorIs(t, err, inventory.ErrProductNotFound)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("restock is not retried", func(t *testing.T) {
+		server, calls := mockInventory(1)
+		client := inventory.NewResilientClient(inventory.NewHTTPClient(server.URL, 0, ""), cfg)
+
+		err := client.Restock(context.Background(), "P001", "", 1, "return", "")
+		assert.ErrorIs(t, err, inventory.ErrUnavailable)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("breaker opens, fails fast and closes after a successful probe", func(t *testing.T) {
+		server, calls := mockInventory(3)
+		client := inventory.NewResilientClient(inventory.NewHTTPClient(server.URL, 0, ""), cfg)
+
+		_, err := client.GetProduct(context.Background(), "P001")
+		assert.ErrorIs(t, err, inventory.ErrUnavailable)
+		assert.Equal(t, int32(3), calls.Load())
+
+		_, err = client.GetProduct(context.Background(), "P001")
+		assert.ErrorIs(t, err, inventory.ErrCircuitOpen)
+		assert.Equal(t, int32(3), calls.Load())
+
+		time.Sleep(cfg.Cooldown)
+		_, err = client.GetProduct(context.Background(), "P001")
+		assert.NoError(t, err)
+		assert.Equal(t, int32(4), calls.Load())
+	})
+
+	t.Run("hung inventory times out", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer server.Close()
+		client := inventory.NewResilientClient(inventory.NewHTTPClient(server.URL, 20*time.Millisecond, ""), inventory.Config{
+			Timeout: 20 * time.Millisecond, FailureThreshold: 5, Cooldown: time.Second,
+		})
+
+		start := time.Now()
+		_, err := client.GetProduct(context.Background(), "P001")
+		assert.ErrorIs(t, err, inventory.ErrUnavailable)
+		assert.Less(t, time.Since(start), 150*time.Millisecond)
+	})
+}
@@ -5,8 +5,10 @@ import (
 	"time"
 
 	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
 	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
 	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
@@ -66,12 +68,15 @@ func TestListOrders(t *testing.T) {
 			return mt.Coll
 		}
 
-		orderService := service.NewOrderService("orders", "", rc, "orders")
-		orders, nextCursor, err := orderService.ListOrders("", "", 2)
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		page, err := orderService.ListOrders(service.ListOptions{PageSize: 2})
 		assert.NoError(t, err)
-		assert.Len(t, orders, 2)
+		assert.Len(t, page.Orders, 2)
 		assert.Equal(t, models.OrderStatus("PENDING"), models.Pending)
-		assert.Equal(t, order2ID.Hex(), nextCursor)
+		// last page: no cursor to follow
+		assert.False(t, page.HasMore)
+		assert.Empty(t, page.NextCursor)
+		assert.Empty(t, page.PrevCursor)
 	})
 
 	mt = mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
@@ -87,11 +92,121 @@ func TestListOrders(t *testing.T) {
 			return mt.Coll
 		}
 
-		orderService := service.NewOrderService("orders", "", rc, "orders")
-		orders, nextCursor, err := orderService.ListOrders("CANCELLED", "", 1)
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		page, err := orderService.ListOrders(service.ListOptions{Filter: service.OrderFilter{Status: "CANCELLED"}, PageSize: 1})
 		assert.NoError(t, err)
-		assert.Len(t, orders, 1)
+		assert.Len(t, page.Orders, 1)
 		assert.Equal(t, models.OrderStatus("CANCELLED"), models.Cancelled)
-		assert.Equal(t, order2ID.Hex(), nextCursor)
+		assert.Equal(t, order2ID, page.Orders[0].ID)
+		assert.False(t, page.HasMore)
+	})
+
+	mt = mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("list customer orders filtered by product, date and total", func(mt *mtest.T) {
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, order1),
+		)
+
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		minTotal, maxTotal := 100.0, 500.0
+		filter := service.OrderFilter{
+			CustomerID:  "C001",
+			ProductID:   "P001",
+			CreatedFrom: time.Now().Add(-24 * time.Hour),
+			MinTotal:    &minTotal,
+			MaxTotal:    &maxTotal,
+		}
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		page, err := orderService.ListOrders(service.ListOptions{Filter: filter, PageSize: 10})
+		assert.NoError(t, err)
+		assert.Len(t, page.Orders, 1)
+
+		query := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.Equal(t, "C001", query.Lookup("customer_id").StringValue())
+		assert.Equal(t, "P001", query.Lookup("items.product_id").StringValue())
+		assert.Equal(t, 100.0, query.Lookup("total", "$gte").Double())
+		assert.Equal(t, 500.0, query.Lookup("total", "$lte").Double())
+		assert.NotEmpty(t, query.Lookup("created_at", "$gte"))
+	})
+
+	mt = mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("page forward and backward sorted by total", func(mt *mtest.T) {
+
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+
+		// first page: an extra order is returned, so another page exists
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, order1, order2),
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, bson.D{{Key: "n", Value: 2}}),
+		)
+		first, err := orderService.ListOrders(service.ListOptions{SortBy: service.SortByTotal, Descending: true, PageSize: 1, IncludeTotal: true})
+		assert.NoError(t, err)
+		assert.Len(t, first.Orders, 1)
+		assert.True(t, first.HasMore)
+		assert.NotEmpty(t, first.NextCursor)
+		assert.Empty(t, first.PrevCursor)
+		assert.Equal(t, int64(2), *first.TotalCount)
+
+		sort := mt.GetStartedEvent().Command.Lookup("sort").Document()
+		assert.Equal(t, int32(-1), sort.Lookup("total").Int32())
+
+		// second page: nothing after it, but the first page is reachable again
+		mt.ClearEvents()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, order2))
+		second, err := orderService.ListOrders(service.ListOptions{Cursor: first.NextCursor, PageSize: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, order2ID, second.Orders[0].ID)
+		assert.False(t, second.HasMore)
+		assert.Empty(t, second.NextCursor)
+		assert.NotEmpty(t, second.PrevCursor)
+
+		query := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.Contains(t, query.String(), `"total": {"$lt"`)
+
+		// going back scans in the opposite direction
+		mt.ClearEvents()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, order1))
+		back, err := orderService.ListOrders(service.ListOptions{Cursor: second.PrevCursor, PageSize: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, order1ID, back.Orders[0].ID)
+		assert.True(t, back.HasMore)
+		assert.Empty(t, back.PrevCursor)
+
+		sort = mt.GetStartedEvent().Command.Lookup("sort").Document()
+		assert.Equal(t, int32(1), sort.Lookup("total").Int32())
+	})
+
+	mt = mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("page size is capped", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, order1, order2))
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		page, err := orderService.ListOrders(service.ListOptions{PageSize: 1000})
+		assert.NoError(t, err)
+		assert.Len(t, page.Orders, 2)
+
+		// one more order than the page holds is fetched to tell whether another page follows
+		find := mt.GetStartedEvent().Command
+		assert.Equal(t, int64(service.MaxPageSize+1), find.Lookup("limit").AsInt64())
+	})
+
+	mt.Run("reject tampered cursor", func(mt *mtest.T) {
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		_, err := orderService.ListOrders(service.ListOptions{Cursor: "not-a-cursor", PageSize: 1})
+		assert.Error(t, err)
 	})
 }
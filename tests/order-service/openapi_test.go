@@ -0,0 +1,186 @@
+package order_service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/api"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// contractRouter loads the served OpenAPI document and fails the test when it is not a valid spec
+func contractRouter(t *testing.T, spec []byte) routers.Router {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(context.Background()))
+	router, err := legacy.NewRouter(doc)
+	require.NoError(t, err)
+	return router
+}
+
+// serveContract sends the request through the routes and checks the response, and for successful calls
+// also the request, against the OpenAPI document
+func serveContract(t *testing.T, router routers.Router, h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	route, pathParams, err := router.FindRoute(req)
+	require.NoError(t, err, "%s %s is not documented", req.Method, req.URL.Path)
+
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	input := &openapi3filter.RequestValidationInput{Request: req, PathParams: pathParams, Route: route,
+		Options: &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc}}
+	if rec.Code < 300 {
+		assert.NoError(t, openapi3filter.ValidateRequest(context.Background(), input))
+	}
+	assert.NoError(t, openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 rec.Code,
+		Header:                 rec.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+	}), "%s %s returned %d: %s", req.Method, req.URL.Path, rec.Code, rec.Body.String())
+	return rec
+}
+
+func TestOrderServiceContract(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	router := contractRouter(t, api.Spec)
+
+	//launch miniredis for testing purposes
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// Connect go-redis client to miniredis
+	rc := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+
+	// Mock inventory service
+	mockInventory := newMockInventory(models.Product{ID: "P001", Stock: 10, Price: 150, Currency: "EUR"})
+	defer mockInventory.Close()
+
+	routes := func(mt *mtest.T) http.Handler {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		return handler.NewOrderHandler(orderService, "", handler.DefaultOrderLimits(), nil, nil).Routes()
+	}
+
+	now := time.Now().UTC()
+	orderID := primitive.NewObjectID()
+	shippedOrder := bson.D{
+		{Key: "_id", Value: orderID},
+		{Key: "customer_id", Value: "C001"},
+		{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}, {Key: "price", Value: 150.0}}}},
+		{Key: "total", Value: 300.0},
+		{Key: "currency", Value: "EUR"},
+		{Key: "status", Value: "SHIPPED"},
+		{Key: "version", Value: int64(4)},
+		{Key: "payment", Value: bson.D{
+			{Key: "provider", Value: "fake"},
+			{Key: "transaction_id", Value: "fake_1"},
+			{Key: "amount", Value: 300.0},
+			{Key: "currency", Value: "EUR"},
+			{Key: "status", Value: "CAPTURED"},
+			{Key: "captured_at", Value: now},
+			{Key: "updated_at", Value: now},
+		}},
+		{Key: "shipments", Value: bson.A{bson.D{
+			{Key: "id", Value: "S1"},
+			{Key: "carrier", Value: "UPS"},
+			{Key: "tracking_number", Value: "1Z999"},
+			{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}}}},
+			{Key: "status", Value: "IN_TRANSIT"},
+			{Key: "events", Value: bson.A{bson.D{{Key: "status", Value: "IN_TRANSIT"}, {Key: "occurred_at", Value: now}}}},
+			{Key: "created_at", Value: now},
+			{Key: "shipped_at", Value: now},
+		}}},
+		{Key: "status_history", Value: bson.A{bson.D{{Key: "status", Value: "PENDING"}, {Key: "changed_at", Value: now}}}},
+		{Key: "created_at", Value: now},
+		{Key: "updated_at", Value: now},
+	}
+
+	mt.Run("create order", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/orders", strings.NewReader(`{"customer_id":"C001","items":[{"product_id":"P001","quantity":2}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := serveContract(t, router, routes(mt), req)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+
+	mt.Run("invalid order", func(mt *mtest.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/orders", strings.NewReader(`{"items":[{"product_id":"P001","quantity":0}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := serveContract(t, router, routes(mt), req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	mt.Run("get order", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, shippedOrder))
+
+		rec := serveContract(t, router, routes(mt), httptest.NewRequest(http.MethodGet, "/v1/orders/"+orderID.Hex(), nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	mt.Run("unknown order", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch))
+
+		rec := serveContract(t, router, routes(mt), httptest.NewRequest(http.MethodGet, "/v1/orders/"+primitive.NewObjectID().Hex(), nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	mt.Run("list orders", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, shippedOrder))
+
+		rec := serveContract(t, router, routes(mt), httptest.NewRequest(http.MethodGet, "/v1/orders?status=SHIPPED&sort=total&order=desc", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	mt.Run("cancel shipped order", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 0},
+		}, mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch), mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, shippedOrder))
+
+		rec := serveContract(t, router, routes(mt), httptest.NewRequest(http.MethodPost, "/v1/orders/"+orderID.Hex()+"/cancel", nil))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	mt.Run("openapi document", func(mt *mtest.T) {
+		rec := serveContract(t, router, routes(mt), httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
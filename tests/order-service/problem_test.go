@@ -0,0 +1,110 @@
+package order_service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/problem"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestProblemResponses(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	//launch miniredis for testing purposes
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// Connect go-redis client to miniredis
+	rc := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+
+	decode := func(t *testing.T, rec *httptest.ResponseRecorder) problem.Details {
+		assert.Equal(t, problem.ContentType, rec.Header().Get("Content-Type"))
+		var details problem.Details
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&details))
+		assert.Equal(t, rec.Code, details.Status)
+		return details
+	}
+
+	mt.Run("unknown order is 404", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		orderHandler := handler.NewOrderHandler(service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)), "", handler.DefaultOrderLimits(), nil, nil)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch))
+
+		rec := httptest.NewRecorder()
+		orderHandler.GetOrderHandler(rec, httptest.NewRequest(http.MethodGet, "/order?id="+primitive.NewObjectID().Hex(), nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		details := decode(t, rec)
+		assert.Equal(t, "order_not_found", details.Code)
+		assert.Equal(t, "/order", details.Instance)
+	})
+
+	mt.Run("malformed order id is 400", func(mt *mtest.T) {
+		orderHandler := handler.NewOrderHandler(service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)), "", handler.DefaultOrderLimits(), nil, nil)
+
+		rec := httptest.NewRecorder()
+		orderHandler.GetOrderHandler(rec, httptest.NewRequest(http.MethodGet, "/order?id=abc", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "invalid_order_id", decode(t, rec).Code)
+	})
+
+	mt.Run("cancelling a shipped order is 409", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		orderHandler := handler.NewOrderHandler(service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)), "", handler.DefaultOrderLimits(), nil, nil)
+		id := primitive.NewObjectID()
+
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 0},
+		}, mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch), mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: id},
+			{Key: "status", Value: "SHIPPED"},
+		}))
+
+		rec := httptest.NewRecorder()
+		orderHandler.CancelOrderHandler(rec, httptest.NewRequest(http.MethodDelete, "/order/cancel?id="+id.Hex(), nil))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Equal(t, "order_not_cancellable", decode(t, rec).Code)
+	})
+
+	mt.Run("database failures hide the cause", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		orderHandler := handler.NewOrderHandler(service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)), "", handler.DefaultOrderLimits(), nil, nil)
+
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 0},
+			{Key: "errmsg", Value: "connection reset"},
+		})
+
+		rec := httptest.NewRecorder()
+		orderHandler.GetOrderHandler(rec, httptest.NewRequest(http.MethodGet, "/order?id="+primitive.NewObjectID().Hex(), nil))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		details := decode(t, rec)
+		assert.Equal(t, "internal_error", details.Code)
+		assert.NotContains(t, details.Detail, "connection reset")
+	})
+}
@@ -0,0 +1,134 @@
+package order_service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductCache(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	// Mock inventory service counting product and stock reads
+	var productCalls, stockCalls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/products/{id}", func(w http.ResponseWriter, r *http.Request) {
+		productCalls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.Product{ID: r.PathValue("id"), Price: 150, Currency: "EUR", Stock: 10})
+	})
+	mux.HandleFunc("GET /v1/products", func(w http.ResponseWriter, r *http.Request) {
+		stockCalls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]models.Product{{ID: "P001", Stock: 7}})
+	})
+	mockInventory := httptest.NewServer(mux)
+	defer mockInventory.Close()
+
+	ctx := context.Background()
+
+	t.Run("metadata is cached, stock is always read from inventory", func(t *testing.T) {
+		productCalls.Store(0)
+		stockCalls.Store(0)
+		client := inventory.NewCachingClient(inventory.NewHTTPClient(mockInventory.URL, 0, ""), inventory.NewProductCache(time.Minute, nil))
+
+		for range 3 {
+			product, err := client.GetProduct(ctx, "P001")
+			require.NoError(t, err)
+			assert.Equal(t, 150.0, product.Price)
+
+			stock, err := client.GetStock(ctx, []string{"P001", "P404"})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]models.StockLevel{"P001": {Stock: 7}}, stock)
+		}
+		assert.Equal(t, int32(1), productCalls.Load())
+		assert.Equal(t, int32(3), stockCalls.Load())
+	})
+
+	t.Run("replicas share the redis tier", func(t *testing.T) {
+		productCalls.Store(0)
+		first := inventory.NewCachingClient(inventory.NewHTTPClient(mockInventory.URL, 0, ""), inventory.NewProductCache(time.Minute, rc))
+		second := inventory.NewCachingClient(inventory.NewHTTPClient(mockInventory.URL, 0, ""), inventory.NewProductCache(time.Minute, rc))
+
+		_, err := first.GetProduct(ctx, "P002")
+		require.NoError(t, err)
+		product, err := second.GetProduct(ctx, "P002")
+		require.NoError(t, err)
+		assert.Equal(t, "P002", product.ID)
+		assert.Equal(t, int32(1), productCalls.Load())
+		assert.True(t, mr.Exists("product-cache:P002"))
+	})
+
+	t.Run("product.updated events invalidate the cache", func(t *testing.T) {
+		cache := inventory.NewProductCache(time.Minute, rc)
+		cache.Set(ctx, models.Product{ID: "P003", Price: 10})
+
+		watchCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go inventory.WatchProductEvents(watchCtx, rc, "product-events", cache)
+
+		// The watcher only reads events published after it started, keep publishing until it sees one
+		assert.Eventually(t, func() bool {
+			rc.XAdd(ctx, &redis.XAddArgs{
+				Stream: "product-events",
+				Values: map[string]interface{}{"event": inventory.EventProductUpdated, "product_id": "P003", "version": 2},
+			})
+			_, ok := cache.Get(ctx, "P003")
+			return !ok
+		}, 2*time.Second, 20*time.Millisecond)
+		assert.False(t, mr.Exists("product-cache:P003"))
+	})
+
+	t.Run("tenants have their own entries", func(t *testing.T) {
+		cache := inventory.NewProductCache(time.Minute, rc)
+		acme := tenant.NewContext(ctx, tenant.Tenant{ID: "acme"})
+		cache.Set(acme, models.Product{ID: "P005", Price: 20})
+
+		_, ok := cache.Get(ctx, "P005")
+		assert.False(t, ok)
+		product, ok := cache.Get(acme, "P005")
+		require.True(t, ok)
+		assert.Equal(t, 20.0, product.Price)
+		assert.True(t, mr.Exists("product-cache:acme/P005"))
+
+		watchCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go inventory.WatchProductEvents(watchCtx, rc, "product-events", cache)
+		assert.Eventually(t, func() bool {
+			rc.XAdd(ctx, &redis.XAddArgs{
+				Stream: "product-events",
+				Values: map[string]interface{}{"event": inventory.EventProductUpdated, "product_id": "P005", "tenant_id": "acme", "version": 2},
+			})
+			_, ok := cache.Get(acme, "P005")
+			return !ok
+		}, 2*time.Second, 20*time.Millisecond)
+	})
+
+	t.Run("entries expire after the ttl", func(t *testing.T) {
+		cache := inventory.NewProductCache(10*time.Millisecond, nil)
+		cache.Set(ctx, models.Product{ID: "P004"})
+		_, ok := cache.Get(ctx, "P004")
+		assert.True(t, ok)
+
+		time.Sleep(20 * time.Millisecond)
+		_, ok = cache.Get(ctx, "P004")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,206 @@
+package order_service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/api"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestPromotions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	router := contractRouter(t, api.Spec)
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	mockInventory := newMockInventory(
+		models.Product{ID: "P001", Price: 50, Currency: "EUR", Stock: 10, Category: "shoes"},
+		models.Product{ID: "P002", Price: 4, Currency: "EUR", Stock: 10, Category: "socks"},
+	)
+	defer mockInventory.Close()
+	orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)).
+		WithPromotions("promotions")
+	routes := handler.NewOrderHandler(orderService, "", handler.DefaultOrderLimits(), nil, nil).Routes()
+
+	now := time.Now().UTC()
+	shoeSale := primitive.NewObjectID()
+	coupon := primitive.NewObjectID()
+	promotionDocs := func(couponUses int) []bson.D {
+		return []bson.D{
+			{
+				{Key: "_id", Value: shoeSale}, {Key: "name", Value: "Shoe sale"}, {Key: "type", Value: "PERCENT_OFF"},
+				{Key: "percent", Value: 10.0}, {Key: "categories", Value: bson.A{"shoes"}}, {Key: "stackable", Value: true},
+				{Key: "usage_count", Value: 0}, {Key: "active", Value: true}, {Key: "created_at", Value: now},
+			},
+			{
+				{Key: "_id", Value: coupon}, {Key: "name", Value: "5 off"}, {Key: "code", Value: "WELCOME5"}, {Key: "type", Value: "AMOUNT_OFF"},
+				{Key: "amount", Value: 5.0}, {Key: "stackable", Value: true}, {Key: "usage_limit", Value: 100},
+				{Key: "usage_count", Value: couponUses}, {Key: "active", Value: true}, {Key: "created_at", Value: now},
+			},
+		}
+	}
+	order := models.Order{
+		CustomerID:  "C001",
+		Items:       []models.LineItem{{ProductID: "P001", Quantity: 2}, {ProductID: "P002", Quantity: 5}},
+		CouponCodes: []string{" welcome5 "},
+	}
+
+	mt.Run("quotes apply coupons and automatic promotions", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "shop.promotions", mtest.FirstBatch, promotionDocs(3)...))
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/orders/quote", strings.NewReader(`{"customer_id":"C001","items":[{"product_id":"P001","quantity":2},{"product_id":"P002","quantity":5}],"coupon_codes":["welcome5"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := serveContract(t, router, routes, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var quote models.OrderQuote
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&quote))
+		assert.Equal(t, 120.0, quote.Subtotal)
+		assert.Equal(t, 105.0, quote.Total)
+		assert.Equal(t, []string{"WELCOME5"}, quote.CouponCodes)
+		require.Len(t, quote.Discounts, 2)
+		assert.Equal(t, "P001", quote.Discounts[0].ProductID)
+		assert.Equal(t, 10.0, quote.Discounts[0].Amount)
+		assert.Equal(t, "WELCOME5", quote.Discounts[1].Code)
+
+		// Quotes do not use up coupons
+		mt.GetStartedEvent()
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+
+	mt.Run("orders redeem their promotions", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "shop.promotions", mtest.FirstBatch, promotionDocs(3)...),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+			mtest.CreateSuccessResponse(),
+		)
+
+		created, err := orderService.CreateOrder(order)
+		require.NoError(t, err)
+		assert.Equal(t, 120.0, created.Subtotal)
+		assert.Equal(t, 105.0, created.Total)
+		assert.Len(t, created.Discounts, 2)
+
+		mt.GetStartedEvent()
+		for _, id := range []primitive.ObjectID{shoeSale, coupon} {
+			update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+			assert.Equal(t, id, update.Lookup("q", "_id").ObjectID())
+			assert.Equal(t, int32(1), update.Lookup("u", "$inc", "usage_count").Int32())
+		}
+		inserted := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(t, 105.0, inserted.Lookup("total").Double())
+		assert.Equal(t, 120.0, inserted.Lookup("subtotal").Double())
+		assert.Equal(t, "WELCOME5", inserted.Lookup("coupon_codes").Array().Index(0).Value().StringValue())
+	})
+
+	mt.Run("coupons used up meanwhile fail the order", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "shop.promotions", mtest.FirstBatch, promotionDocs(99)...),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+
+		_, err := orderService.CreateOrder(order)
+		var serviceErr *service.Error
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, "promotion_used_up", serviceErr.Code)
+
+		// The use of the shoe sale is given back
+		for range 3 {
+			mt.GetStartedEvent()
+		}
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, shoeSale, update.Lookup("q", "_id").ObjectID())
+		assert.Equal(t, int32(-1), update.Lookup("u", "$inc", "usage_count").Int32())
+	})
+
+	mt.Run("unusable coupons are rejected", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "shop.promotions", mtest.FirstBatch, promotionDocs(100)...))
+		_, err := orderService.Quote(order)
+		var serviceErr *service.Error
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, "invalid_coupon", serviceErr.Code)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "shop.promotions", mtest.FirstBatch, promotionDocs(0)[:1]...))
+		unknown := order
+		unknown.CouponCodes = []string{"NOPE"}
+		_, err = orderService.Quote(unknown)
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, "invalid_coupon", serviceErr.Code)
+	})
+
+	mt.Run("admins manage promotions", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/promotions", strings.NewReader(`{"name":"Buy 2 get 1","code":"three4two","type":"BUY_X_GET_Y","buy_quantity":2,"get_quantity":1,"usage_limit":50}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := serveContract(t, router, routes, req)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		var created models.Promotion
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+		assert.Equal(t, "THREE4TWO", created.Code)
+		assert.True(t, created.Active)
+
+		req = httptest.NewRequest(http.MethodPost, "/v1/promotions", strings.NewReader(`{"name":"Broken","type":"PERCENT_OFF","percent":150}`))
+		req.Header.Set("Content-Type", "application/json")
+		assert.Equal(t, http.StatusBadRequest, serveContract(t, router, routes, req).Code)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "shop.promotions", mtest.FirstBatch, promotionDocs(0)...))
+		rec = serveContract(t, router, routes, httptest.NewRequest(http.MethodGet, "/v1/promotions", nil))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		deactivated := promotionDocs(0)[1]
+		for i := range deactivated {
+			if deactivated[i].Key == "active" {
+				deactivated[i].Value = false
+			}
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: deactivated}})
+		rec = serveContract(t, router, routes, httptest.NewRequest(http.MethodDelete, "/v1/promotions/"+coupon.Hex(), nil))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), `"active":false`)
+
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}})
+		rec = serveContract(t, router, routes, httptest.NewRequest(http.MethodDelete, "/v1/promotions/"+primitive.NewObjectID().Hex(), nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
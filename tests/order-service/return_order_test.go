@@ -0,0 +1,304 @@
+package order_service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestReturns(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	//launch miniredis for testing purposes
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// Connect go-redis client to miniredis
+	rc := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+
+	// Mock inventory service restock endpoint
+	restocked := map[string]int{}
+	failRestock := map[string]bool{}
+	inventoryMux := http.NewServeMux()
+	inventoryMux.HandleFunc("POST /v1/products/{id}/restock", func(w http.ResponseWriter, r *http.Request) {
+		if failRestock[r.PathValue("id")] {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var body struct {
+			Quantity int `json:"quantity"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		restocked[r.PathValue("id")] += body.Quantity
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.Product{ID: r.PathValue("id")})
+	})
+	mockInventory := httptest.NewServer(inventoryMux)
+	defer mockInventory.Close()
+
+	orderID := primitive.NewObjectID()
+	deliveredOrder := func(status string, returns bson.A) bson.D {
+		return bson.D{
+			{Key: "_id", Value: orderID},
+			{Key: "customer_id", Value: "C001"},
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}, {Key: "price", Value: 150.0}},
+				bson.D{{Key: "product_id", Value: "P002"}, {Key: "quantity", Value: 1}, {Key: "price", Value: 40.0}},
+			}},
+			{Key: "total", Value: 340.0},
+			{Key: "status", Value: status},
+			{Key: "payment", Value: bson.D{
+				{Key: "provider", Value: "fake"},
+				{Key: "transaction_id", Value: "fake_tx"},
+				{Key: "amount", Value: 340.0},
+				{Key: "status", Value: "CAPTURED"},
+			}},
+			{Key: "returns", Value: returns},
+		}
+	}
+	updateOK := bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}}
+
+	mt.Run("request return computes refund per line", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, deliveredOrder("DELIVERED", bson.A{})), updateOK)
+
+		rma, err := orderService.RequestReturn(orderID.Hex(), []models.ReturnItem{
+			{ProductID: "P001", Quantity: 1, Reason: "damaged"},
+			{ProductID: "P002", Quantity: 1, Reason: "wrong size"},
+		}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, models.ReturnPending, rma.Status)
+		assert.Equal(t, 150.0, rma.Items[0].RefundAmount)
+		assert.Equal(t, 190.0, rma.RefundTotal)
+	})
+
+	mt.Run("reject return of undelivered quantity", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, deliveredOrder("DELIVERED", bson.A{})))
+
+		_, err := orderService.RequestReturn(orderID.Hex(), []models.ReturnItem{{ProductID: "P002", Quantity: 2, Reason: "damaged"}}, nil)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "returnable units")
+	})
+
+	mt.Run("receive approved return restocks and refunds", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		returns := bson.A{bson.D{
+			{Key: "id", Value: "R1"},
+			{Key: "items", Value: bson.A{bson.D{
+				{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}, {Key: "reason", Value: "damaged"}, {Key: "refund_amount", Value: 300.0},
+			}}},
+			{Key: "status", Value: "APPROVED"},
+			{Key: "refund_total", Value: 300.0},
+		}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, deliveredOrder("RETURN_REQUESTED", returns)),
+			updateOK, updateOK, updateOK, updateOK,
+		)
+
+		rma, err := orderService.ReceiveReturn(orderID.Hex(), "R1", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, models.ReturnRefunded, rma.Status)
+		assert.Equal(t, 2, restocked["P001"])
+	})
+	mt.Run("failed restock keeps the item pending and holds the refund", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		failRestock["P002"] = true
+		defer delete(failRestock, "P002")
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		returns := bson.A{bson.D{
+			{Key: "id", Value: "R1"},
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 1}, {Key: "reason", Value: "damaged"}, {Key: "refund_amount", Value: 150.0}},
+				bson.D{{Key: "product_id", Value: "P002"}, {Key: "quantity", Value: 1}, {Key: "reason", Value: "damaged"}, {Key: "refund_amount", Value: 40.0}},
+			}},
+			{Key: "status", Value: "APPROVED"},
+			{Key: "refund_total", Value: 190.0},
+		}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, deliveredOrder("RETURN_REQUESTED", returns)),
+			updateOK, updateOK,
+		)
+		before := restocked["P001"]
+
+		rma, err := orderService.ReceiveReturn(orderID.Hex(), "R1", nil)
+		var serviceErr *service.Error
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, "inventory_unavailable", serviceErr.Code)
+		assert.Equal(t, models.ReturnReceived, rma.Status)
+		assert.True(t, rma.Items[0].Restocked)
+		assert.False(t, rma.Items[1].Restocked)
+		assert.Equal(t, before+1, restocked["P001"])
+
+		// the return is saved RESTOCKING before inventory-service is called, then the pending item is saved with
+		// it and no refund is attempted
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set")
+		assert.Equal(t, "RESTOCKING", update.Document().Lookup("returns").Array().Index(0).Value().Document().Lookup("status").StringValue())
+		update = mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set")
+		items := update.Document().Lookup("returns").Array().Index(0).Value().Document().Lookup("items").Array()
+		assert.False(t, items.Index(1).Value().Document().Lookup("restocked").Boolean())
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+
+	mt.Run("refund retry restocks the pending items", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		returns := bson.A{bson.D{
+			{Key: "id", Value: "R1"},
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 1}, {Key: "reason", Value: "damaged"}, {Key: "refund_amount", Value: 150.0}, {Key: "restocked", Value: true}},
+				bson.D{{Key: "product_id", Value: "P002"}, {Key: "quantity", Value: 1}, {Key: "reason", Value: "damaged"}, {Key: "refund_amount", Value: 40.0}},
+			}},
+			{Key: "status", Value: "RECEIVED"},
+			{Key: "refund_total", Value: 190.0},
+		}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, deliveredOrder("RETURNED", returns)),
+			updateOK, updateOK, updateOK, updateOK,
+		)
+		before := map[string]int{"P001": restocked["P001"], "P002": restocked["P002"]}
+
+		rma, err := orderService.RefundReturn(orderID.Hex(), "R1", nil)
+		require.NoError(t, err)
+		assert.Equal(t, models.ReturnRefunded, rma.Status)
+		assert.True(t, rma.Restocked())
+		assert.Equal(t, before["P001"], restocked["P001"])
+		assert.Equal(t, before["P002"]+1, restocked["P002"])
+	})
+
+	mt.Run("refund is capped at the remaining captured amount", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		returns := bson.A{bson.D{
+			{Key: "id", Value: "R1"},
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "product_id", Value: "P002"}, {Key: "quantity", Value: 1}, {Key: "reason", Value: "damaged"}, {Key: "refund_amount", Value: 40.01}, {Key: "restocked", Value: true}},
+			}},
+			{Key: "status", Value: "RECEIVED"},
+			{Key: "refund_total", Value: 40.01},
+		}}
+		order := deliveredOrder("RETURNED", returns)
+		for i := range order {
+			if order[i].Key == "payment" {
+				order[i].Value = bson.D{
+					{Key: "provider", Value: "fake"},
+					{Key: "transaction_id", Value: "fake_tx"},
+					{Key: "amount", Value: 340.0},
+					{Key: "refunded_amount", Value: 300.0},
+					{Key: "status", Value: "CAPTURED"},
+				}
+			}
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, order), updateOK, updateOK)
+
+		rma, err := orderService.RefundReturn(orderID.Hex(), "R1", nil)
+		require.NoError(t, err)
+		assert.Equal(t, models.ReturnRefunded, rma.Status)
+		assert.Equal(t, 40.0, rma.RefundTotal)
+	})
+	mt.Run("failed save restocks nothing", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		gateway := &countingGateway{FakeGateway: payment.NewFakeGateway(payment.Approve, 0, 0)}
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", gateway)
+		returns := bson.A{bson.D{
+			{Key: "id", Value: "R1"},
+			{Key: "items", Value: bson.A{bson.D{
+				{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}, {Key: "reason", Value: "damaged"}, {Key: "refund_amount", Value: 300.0},
+			}}},
+			{Key: "status", Value: "APPROVED"},
+			{Key: "refund_total", Value: 300.0},
+		}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, deliveredOrder("RETURN_REQUESTED", returns)),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}},
+		)
+		before := restocked["P001"]
+
+		_, err := orderService.ReceiveReturn(orderID.Hex(), "R1", nil)
+		assert.ErrorIs(t, err, service.ErrVersionConflict)
+		assert.Equal(t, before, restocked["P001"])
+		assert.Zero(t, gateway.refunds)
+	})
+
+	mt.Run("refund whose outcome was not saved is not retried", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		gateway := &countingGateway{FakeGateway: payment.NewFakeGateway(payment.Approve, 0, 0)}
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", gateway)
+		returns := func(status string) bson.A {
+			return bson.A{bson.D{
+				{Key: "id", Value: "R1"},
+				{Key: "items", Value: bson.A{bson.D{
+					{Key: "product_id", Value: "P002"}, {Key: "quantity", Value: 1}, {Key: "reason", Value: "damaged"}, {Key: "refund_amount", Value: 40.0}, {Key: "restocked", Value: true},
+				}}},
+				{Key: "status", Value: status},
+				{Key: "refund_total", Value: 40.0},
+			}}
+		}
+
+		// The refund goes through, saving the REFUNDED return fails
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, deliveredOrder("RETURNED", returns("RECEIVED"))),
+			updateOK,
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}},
+		)
+		_, err := orderService.RefundReturn(orderID.Hex(), "R1", nil)
+		assert.ErrorIs(t, err, service.ErrVersionConflict)
+		assert.Equal(t, 1, gateway.refunds)
+
+		// The retry finds the return REFUNDING and refunds nothing again
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, deliveredOrder("RETURNED", returns("REFUNDING"))))
+		_, err = orderService.RefundReturn(orderID.Hex(), "R1", nil)
+		var serviceErr *service.Error
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, service.KindConflict, serviceErr.Kind)
+		assert.Equal(t, "invalid_return_state", serviceErr.Code)
+		assert.Equal(t, 1, gateway.refunds)
+	})
+}
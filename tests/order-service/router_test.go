@@ -0,0 +1,76 @@
+package order_service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestOrderRoutes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	//launch miniredis for testing purposes
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// Connect go-redis client to miniredis
+	rc := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+
+	orderID := primitive.NewObjectID()
+	orderDoc := bson.D{
+		{Key: "_id", Value: orderID},
+		{Key: "customer_id", Value: "C001"},
+		{Key: "status", Value: "PENDING"},
+		{Key: "version", Value: int64(1)},
+	}
+
+	routes := func(mt *mtest.T) http.Handler {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		return handler.NewOrderHandler(service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)), "", handler.DefaultOrderLimits(), nil, nil).Routes()
+	}
+
+	mt.Run("order id is read from the path", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc))
+
+		rec := httptest.NewRecorder()
+		routes(mt).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/orders/"+orderID.Hex(), nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("Deprecation"))
+	})
+
+	mt.Run("legacy path is a deprecated alias", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc))
+
+		rec := httptest.NewRecorder()
+		routes(mt).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/order?id="+orderID.Hex(), nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "true", rec.Header().Get("Deprecation"))
+		assert.Equal(t, `</v1/orders/`+orderID.Hex()+`>; rel="successor-version"`, rec.Header().Get("Link"))
+	})
+
+	mt.Run("wrong method is 405 with Allow", func(mt *mtest.T) {
+		rec := httptest.NewRecorder()
+		routes(mt).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/orders/"+orderID.Hex()+"/cancel", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+		assert.Equal(t, "POST", rec.Header().Get("Allow"))
+	})
+}
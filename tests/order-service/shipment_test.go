@@ -0,0 +1,313 @@
+package order_service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestShipments(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	//launch miniredis for testing purposes
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// Connect go-redis client to miniredis
+	rc := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+
+	orderID := primitive.NewObjectID()
+	processingOrder := func(shipments bson.A) bson.D {
+		return bson.D{
+			{Key: "_id", Value: orderID},
+			{Key: "customer_id", Value: "C001"},
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}, {Key: "price", Value: 150.0}},
+			}},
+			{Key: "total", Value: 300.0},
+			{Key: "status", Value: "PROCESSING"},
+			{Key: "payment", Value: bson.D{
+				{Key: "provider", Value: "fake"},
+				{Key: "transaction_id", Value: "fake_tx"},
+				{Key: "amount", Value: 300.0},
+				{Key: "status", Value: "AUTHORIZED"},
+			}},
+			{Key: "shipments", Value: shipments},
+		}
+	}
+
+	mt.Run("reject shipping more than ordered", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, processingOrder(bson.A{})))
+
+		_, err := orderService.CreateShipment(orderID.Hex(), models.Shipment{
+			Carrier:        "UPS",
+			TrackingNumber: "1Z999",
+			Items:          []models.ShipmentItem{{ProductID: "P001", Quantity: 3}},
+		}, nil)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "unshipped units")
+	})
+
+	mt.Run("ship remaining items", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, processingOrder(bson.A{})),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+
+		shipment, err := orderService.CreateShipment(orderID.Hex(), models.Shipment{Carrier: "UPS", TrackingNumber: "1Z999"}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, models.LabelCreated, shipment.Status)
+		assert.Equal(t, []models.ShipmentItem{{ProductID: "P001", Quantity: 2}}, shipment.Items)
+	})
+
+	mt.Run("carrier pickup ships order and captures payment", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		shipments := bson.A{bson.D{
+			{Key: "id", Value: "S1"},
+			{Key: "carrier", Value: "UPS"},
+			{Key: "tracking_number", Value: "1Z999"},
+			{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}}}},
+			{Key: "status", Value: "LABEL_CREATED"},
+		}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, processingOrder(shipments)),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+
+		order, err := orderService.HandleCarrierEvent(models.CarrierEvent{
+			TrackingNumber: "1Z999",
+			Status:         models.InTransit,
+			OccurredAt:     time.Now(),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, models.Shipped, order.Status)
+		assert.Equal(t, models.PaymentCaptured, order.Payment.Status)
+		assert.Len(t, order.Shipments[0].Events, 1)
+		assert.Equal(t, models.InTransit, order.Shipments[0].Status)
+	})
+	mt.Run("delivery of a processing order captures payment", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		shipments := bson.A{bson.D{
+			{Key: "id", Value: "S1"},
+			{Key: "carrier", Value: "UPS"},
+			{Key: "tracking_number", Value: "1Z999"},
+			{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}}}},
+			{Key: "status", Value: "LABEL_CREATED"},
+		}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, processingOrder(shipments)),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+
+		order, err := orderService.HandleCarrierEvent(models.CarrierEvent{
+			TrackingNumber: "1Z999",
+			Status:         models.ShipmentDelivered,
+			OccurredAt:     time.Now(),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, models.Delivered, order.Status)
+		assert.Equal(t, models.PaymentCaptured, order.Payment.Status)
+
+		// The delivery is saved before the payment is captured
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set")
+		assert.Equal(t, "DELIVERED", update.Document().Lookup("status").StringValue())
+		_, err = update.Document().LookupErr("payment")
+		assert.Error(t, err)
+		update = mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set")
+		assert.Equal(t, "CAPTURED", update.Document().Lookup("payment", "status").StringValue())
+	})
+
+	mt.Run("failed write captures nothing", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		gateway := &countingGateway{FakeGateway: payment.NewFakeGateway(payment.Approve, 0, 0)}
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", gateway)
+		shipments := bson.A{bson.D{
+			{Key: "id", Value: "S1"},
+			{Key: "carrier", Value: "UPS"},
+			{Key: "tracking_number", Value: "1Z999"},
+			{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}}}},
+			{Key: "status", Value: "LABEL_CREATED"},
+		}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, processingOrder(shipments)),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}},
+		)
+
+		_, err := orderService.HandleCarrierEvent(models.CarrierEvent{TrackingNumber: "1Z999", Status: models.InTransit, OccurredAt: time.Now()})
+		assert.ErrorIs(t, err, service.ErrVersionConflict)
+		assert.Zero(t, gateway.captures)
+	})
+
+	mt.Run("redelivered event retries a failed capture once", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		occurredAt := time.Now().Truncate(time.Millisecond)
+		shipments := bson.A{bson.D{
+			{Key: "id", Value: "S1"},
+			{Key: "carrier", Value: "UPS"},
+			{Key: "tracking_number", Value: "1Z999"},
+			{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}}}},
+			{Key: "status", Value: "LABEL_CREATED"},
+		}}
+		declined := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Decline, 0, 0))
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, processingOrder(shipments)),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+
+		// The shipment is saved, the capture fails
+		_, err := declined.HandleCarrierEvent(models.CarrierEvent{TrackingNumber: "1Z999", Status: models.InTransit, OccurredAt: occurredAt})
+		var serviceErr *service.Error
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, service.KindUnavailable, serviceErr.Kind)
+		assert.Equal(t, "payment_unavailable", serviceErr.Code)
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set")
+		assert.Equal(t, "SHIPPED", update.Document().Lookup("status").StringValue())
+
+		// The carrier redelivers the event to the shipped order
+		gateway := &countingGateway{FakeGateway: payment.NewFakeGateway(payment.Approve, 0, 0)}
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", gateway)
+		shipped := processingOrder(bson.A{bson.D{
+			{Key: "id", Value: "S1"},
+			{Key: "carrier", Value: "UPS"},
+			{Key: "tracking_number", Value: "1Z999"},
+			{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}}}},
+			{Key: "status", Value: "IN_TRANSIT"},
+			{Key: "events", Value: bson.A{bson.D{{Key: "status", Value: "IN_TRANSIT"}, {Key: "occurred_at", Value: occurredAt}}}},
+			{Key: "shipped_at", Value: occurredAt},
+		}})
+		shipped = withField(shipped, "status", "SHIPPED")
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, shipped),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+
+		order, err := orderService.HandleCarrierEvent(models.CarrierEvent{TrackingNumber: "1Z999", Status: models.InTransit, OccurredAt: occurredAt})
+		require.NoError(t, err)
+		assert.Equal(t, 1, gateway.captures)
+		assert.Equal(t, models.PaymentCaptured, order.Payment.Status)
+		assert.Len(t, order.Shipments[0].Events, 1)
+
+		// A captured payment is never captured again
+		captured := withField(shipped, "payment", bson.D{
+			{Key: "provider", Value: "fake"},
+			{Key: "transaction_id", Value: "fake_tx"},
+			{Key: "amount", Value: 300.0},
+			{Key: "status", Value: "CAPTURED"},
+		})
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, captured),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+
+		_, err = orderService.HandleCarrierEvent(models.CarrierEvent{TrackingNumber: "1Z999", Status: models.InTransit, OccurredAt: occurredAt})
+		require.NoError(t, err)
+		assert.Equal(t, 1, gateway.captures)
+	})
+
+	mt.Run("reject a tracking number used twice", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, processingOrder(bson.A{})),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key error"}),
+		)
+
+		_, err := orderService.CreateShipment(orderID.Hex(), models.Shipment{Carrier: "UPS", TrackingNumber: "1Z999"}, nil)
+		var serviceErr *service.Error
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, service.KindConflict, serviceErr.Kind)
+		assert.Equal(t, "duplicate_tracking_number", serviceErr.Code)
+	})
+
+	mt.Run("webhook without a configured secret is closed", func(mt *mtest.T) {
+		orderService := service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+		orderHandler := handler.NewOrderHandler(orderService, "", handler.DefaultOrderLimits(), nil, nil)
+
+		rec := httptest.NewRecorder()
+		orderHandler.CarrierEventHandler(rec, httptest.NewRequest(http.MethodPost, "/v1/shipments/events", strings.NewReader(`{"tracking_number":"1Z999","status":"IN_TRANSIT"}`)))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+// withField returns a copy of doc with key set to value
+func withField(doc bson.D, key string, value interface{}) bson.D {
+	out := make(bson.D, len(doc))
+	for i, e := range doc {
+		if e.Key == key {
+			e.Value = value
+		}
+		out[i] = e
+	}
+	return out
+}
+
+// countingGateway approves every request and counts the captures and refunds
+type countingGateway struct {
+	*payment.FakeGateway
+	captures int
+	refunds  int
+}
+
+func (g *countingGateway) Capture(ctx context.Context, transactionID string, amount float64) error {
+	g.captures++
+	return g.FakeGateway.Capture(ctx, transactionID, amount)
+}
+
+func (g *countingGateway) Refund(ctx context.Context, transactionID string, amount float64) error {
+	g.refunds++
+	return g.FakeGateway.Refund(ctx, transactionID, amount)
+}
@@ -0,0 +1,291 @@
+package order_service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestStockReservations(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	//launch miniredis for testing purposes
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// Connect go-redis client to miniredis
+	rc := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+
+	products := []models.Product{
+		{ID: "P001", Stock: 10, Price: 150},
+		{ID: "P002", Stock: 10, Price: 100},
+	}
+	stockInventory, movements := newStockRecorder(products...)
+	defer stockInventory.Close()
+
+	newService := func(mt *mtest.T, url string) *service.OrderService {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		*movements = nil
+		return service.NewOrderService("orders", inventory.NewHTTPClient(url, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+	}
+
+	mt.Run("create order reserves its lines", func(mt *mtest.T) {
+		orderService := newService(mt, stockInventory.URL)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		order, err := orderService.CreateOrder(models.Order{
+			CustomerID: "C001",
+			Items:      []models.LineItem{{ProductID: "P001", Quantity: 2}},
+		})
+		require.NoError(t, err)
+
+		require.Len(t, *movements, 1)
+		reserved := (*movements)[0]
+		assert.Equal(t, "reserve", reserved.Movement)
+		assert.Equal(t, order.ID.Hex(), reserved.OrderID)
+		require.Len(t, reserved.Lines, 1)
+		assert.Equal(t, "P001", reserved.Lines[0].ProductID)
+		assert.Equal(t, 2, reserved.Lines[0].Quantity)
+	})
+
+	mt.Run("stock taken meanwhile rejects the order", func(mt *mtest.T) {
+		// the product still shows stock, but another order reserved it first
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v1/stock/reserve", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "insufficient stock", http.StatusConflict)
+		})
+		mux.Handle("/", mockInventoryHandler(false, products...))
+		raced := httptest.NewServer(mux)
+		defer raced.Close()
+		orderService := newService(mt, raced.URL)
+
+		_, err := orderService.CreateOrder(models.Order{
+			CustomerID: "C001",
+			Items:      []models.LineItem{{ProductID: "P001", Quantity: 2}},
+		})
+		var serviceErr *service.Error
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, "insufficient_stock", serviceErr.Code)
+
+		// nothing is written
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+
+	mt.Run("failed insert releases the reservation", func(mt *mtest.T) {
+		orderService := newService(mt, stockInventory.URL)
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}, {Key: "errmsg", Value: "connection reset"}})
+
+		_, err := orderService.CreateOrder(models.Order{
+			CustomerID: "C001",
+			Items:      []models.LineItem{{ProductID: "P001", Quantity: 2}},
+		})
+		assert.Error(t, err)
+
+		require.Len(t, *movements, 2)
+		assert.Equal(t, "reserve", (*movements)[0].Movement)
+		assert.Equal(t, "release", (*movements)[1].Movement)
+		assert.Equal(t, (*movements)[0].OrderID, (*movements)[1].OrderID)
+		assert.Equal(t, (*movements)[0].Lines, (*movements)[1].Lines)
+	})
+
+	mt.Run("amendment reserves and releases the difference", func(mt *mtest.T) {
+		orderService := newService(mt, stockInventory.URL)
+		orderID := primitive.NewObjectID()
+		pendingOrder := bson.D{
+			{Key: "_id", Value: orderID},
+			{Key: "customer_id", Value: "C001"},
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}, {Key: "price", Value: 150.0}},
+			}},
+			{Key: "total", Value: 300.0},
+			{Key: "status", Value: "PENDING"},
+			{Key: "version", Value: int64(1)},
+		}
+		amended := bson.D{
+			{Key: "_id", Value: orderID},
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 1}, {Key: "price", Value: 150.0}},
+				bson.D{{Key: "product_id", Value: "P002"}, {Key: "quantity", Value: 3}, {Key: "price", Value: 100.0}},
+			}},
+			{Key: "total", Value: 450.0},
+			{Key: "status", Value: "PENDING"},
+			{Key: "version", Value: int64(2)},
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, pendingOrder),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: amended}},
+		)
+
+		_, err := orderService.AmendOrder(orderID.Hex(), service.OrderAmendment{
+			Version: 1,
+			Items: []models.LineItem{
+				{ProductID: "P001", Quantity: 1},
+				{ProductID: "P002", Quantity: 3},
+			},
+		}, nil)
+		require.NoError(t, err)
+
+		// the added units are reserved before the write, the removed ones given back after it
+		require.Len(t, *movements, 2)
+		reserved, released := (*movements)[0], (*movements)[1]
+		assert.Equal(t, "reserve", reserved.Movement)
+		require.Len(t, reserved.Lines, 1)
+		assert.Equal(t, "P002", reserved.Lines[0].ProductID)
+		assert.Equal(t, 3, reserved.Lines[0].Quantity)
+		assert.Equal(t, "release", released.Movement)
+		require.Len(t, released.Lines, 1)
+		assert.Equal(t, "P001", released.Lines[0].ProductID)
+		assert.Equal(t, 1, released.Lines[0].Quantity)
+	})
+
+	mt.Run("amendment counts the stock the order holds", func(mt *mtest.T) {
+		// the order took the last 2 units, inventory-service shows none left
+		lastUnits, lastMovements := newStockRecorder(models.Product{ID: "P003", Stock: 2, Price: 50, Warehouses: []models.WarehouseStock{{WarehouseID: "fra", Stock: 2}}})
+		defer lastUnits.Close()
+		orderService := newService(mt, lastUnits.URL)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		order, err := orderService.CreateOrder(models.Order{
+			CustomerID: "C001",
+			Items:      []models.LineItem{{ProductID: "P003", Quantity: 2}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "fra", order.Items[0].WarehouseID)
+
+		placed := bson.D{
+			{Key: "_id", Value: order.ID},
+			{Key: "customer_id", Value: "C001"},
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "product_id", Value: "P003"}, {Key: "quantity", Value: 2}, {Key: "price", Value: 50.0}, {Key: "warehouse_id", Value: "fra"}},
+			}},
+			{Key: "total", Value: 100.0},
+			{Key: "status", Value: "PENDING"},
+			{Key: "version", Value: int64(1)},
+		}
+		amended := bson.D{
+			{Key: "_id", Value: order.ID},
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "product_id", Value: "P003"}, {Key: "quantity", Value: 1}, {Key: "price", Value: 50.0}, {Key: "warehouse_id", Value: "fra"}},
+			}},
+			{Key: "total", Value: 50.0},
+			{Key: "status", Value: "PENDING"},
+			{Key: "version", Value: int64(2)},
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, placed),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: amended}},
+		)
+
+		_, err = orderService.AmendOrder(order.ID.Hex(), service.OrderAmendment{
+			Version: 1,
+			Items:   []models.LineItem{{ProductID: "P003", Quantity: 1}},
+		}, nil)
+		require.NoError(t, err)
+
+		// nothing more is reserved, the unit no longer needed is given back
+		require.Len(t, *lastMovements, 2)
+		released := (*lastMovements)[1]
+		assert.Equal(t, "release", released.Movement)
+		require.Len(t, released.Lines, 1)
+		assert.Equal(t, "fra", released.Lines[0].WarehouseID)
+		assert.Equal(t, 1, released.Lines[0].Quantity)
+	})
+
+	mt.Run("unanswered reservation of a new order is released", func(mt *mtest.T) {
+		// inventory-service took the stock, but the answer never arrived
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v1/stock/reserve", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "upstream timeout", http.StatusGatewayTimeout)
+		})
+		var releases []stockMovement
+		mux.HandleFunc("POST /v1/stock/release", func(w http.ResponseWriter, r *http.Request) {
+			release := stockMovement{Movement: "release"}
+			json.NewDecoder(r.Body).Decode(&release)
+			releases = append(releases, release)
+			w.WriteHeader(http.StatusNoContent)
+		})
+		mux.Handle("/", mockInventoryHandler(false, products...))
+		timedOut := httptest.NewServer(mux)
+		defer timedOut.Close()
+		orderService := newService(mt, timedOut.URL)
+
+		_, err := orderService.CreateOrder(models.Order{
+			CustomerID: "C001",
+			Items:      []models.LineItem{{ProductID: "P001", Quantity: 2}},
+		})
+		var serviceErr *service.Error
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, service.KindUnavailable, serviceErr.Kind)
+
+		require.Len(t, releases, 1)
+		assert.Equal(t, "reservation failed", releases[0].Reason)
+		assert.Equal(t, "P001", releases[0].Lines[0].ProductID)
+		assert.Equal(t, 2, releases[0].Lines[0].Quantity)
+	})
+
+	mt.Run("carrier pickup commits the shipped stock", func(mt *mtest.T) {
+		orderService := newService(mt, stockInventory.URL)
+		orderID := primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: orderID},
+				{Key: "items", Value: bson.A{
+					bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}, {Key: "price", Value: 150.0}, {Key: "warehouse_id", Value: "fra"}},
+				}},
+				{Key: "total", Value: 300.0},
+				{Key: "status", Value: "PROCESSING"},
+				{Key: "payment", Value: bson.D{
+					{Key: "provider", Value: "fake"},
+					{Key: "transaction_id", Value: "fake_tx"},
+					{Key: "amount", Value: 300.0},
+					{Key: "status", Value: "AUTHORIZED"},
+				}},
+				{Key: "shipments", Value: bson.A{bson.D{
+					{Key: "id", Value: "S1"},
+					{Key: "carrier", Value: "UPS"},
+					{Key: "tracking_number", Value: "1Z777"},
+					{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 2}}}},
+					{Key: "status", Value: "LABEL_CREATED"},
+				}}},
+			}),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+
+		_, err := orderService.HandleCarrierEvent(models.CarrierEvent{
+			TrackingNumber: "1Z777",
+			Status:         models.InTransit,
+			OccurredAt:     time.Now(),
+		})
+		require.NoError(t, err)
+
+		require.Len(t, *movements, 1)
+		committed := (*movements)[0]
+		assert.Equal(t, "commit", committed.Movement)
+		assert.Equal(t, orderID.Hex(), committed.OrderID)
+		require.Len(t, committed.Lines, 1)
+		assert.Equal(t, "fra", committed.Lines[0].WarehouseID)
+		assert.Equal(t, 2, committed.Lines[0].Quantity)
+	})
+}
@@ -0,0 +1,147 @@
+package order_service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/api"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tax"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestOrderTaxes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	router := contractRouter(t, api.Spec)
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	mockInventory := newMockInventory(
+		models.Product{ID: "P001", Price: 100, Currency: "EUR", Stock: 10, Category: "shoes"},
+		models.Product{ID: "P002", Price: 20, Currency: "EUR", Stock: 10, Category: "books"},
+	)
+	defer mockInventory.Close()
+
+	rates := []tax.Rate{
+		{Region: "DE", Name: "VAT", Percent: 19},
+		{Region: "DE", Category: "books", Name: "VAT reduced", Percent: 7},
+	}
+	exclusive, err := tax.NewTable(rates, false, "")
+	require.NoError(t, err)
+	newService := func(p tax.Provider) *service.OrderService {
+		return service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)).
+			WithTax(p)
+	}
+	orderService := newService(exclusive)
+
+	mt.Run("taxes are added on top of exclusive prices", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		order, err := orderService.CreateOrder(models.Order{
+			CustomerID: "C001",
+			Region:     "DE",
+			Items:      []models.LineItem{{ProductID: "P001", Quantity: 2}, {ProductID: "P002", Quantity: 1}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 220.0, order.Subtotal)
+		assert.Equal(t, 39.4, order.TaxTotal)
+		assert.Equal(t, 259.4, order.Total)
+		require.Len(t, order.Taxes, 2)
+		assert.Equal(t, "VAT reduced", order.Taxes[1].Name)
+
+		inserted := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(t, 259.4, inserted.Lookup("total").Double())
+		assert.Equal(t, 38.0, inserted.Lookup("taxes").Array().Index(0).Value().Document().Lookup("amount").Double())
+	})
+
+	mt.Run("inclusive prices already contain the taxes", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		inclusive, err := tax.NewTable(rates, true, "DE")
+		require.NoError(t, err)
+
+		quote, err := newService(inclusive).Quote(models.Order{CustomerID: "C001", Items: []models.LineItem{{ProductID: "P001", Quantity: 1}}})
+		require.NoError(t, err)
+		assert.True(t, quote.TaxInclusive)
+		assert.Equal(t, 100.0, quote.Total)
+		assert.Equal(t, 15.97, quote.TaxTotal)
+		assert.Equal(t, 84.03, quote.Taxes[0].Taxable)
+	})
+
+	mt.Run("quotes report the taxes of the region", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		routes := handler.NewOrderHandler(orderService, "", handler.DefaultOrderLimits(), nil, nil).Routes()
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/orders/quote", strings.NewReader(`{"customer_id":"C001","region":"de","items":[{"product_id":"P002","quantity":3}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := serveContract(t, router, routes, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var quote models.OrderQuote
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&quote))
+		assert.Equal(t, "DE", quote.Region)
+		assert.Equal(t, 4.2, quote.TaxTotal)
+		assert.Equal(t, 64.2, quote.Total)
+
+		req = httptest.NewRequest(http.MethodPost, "/v1/orders/quote", strings.NewReader(`{"customer_id":"C001","region":"Germany","items":[{"product_id":"P002","quantity":3}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		assert.Equal(t, http.StatusBadRequest, serveContract(t, router, routes, req).Code)
+	})
+
+	mt.Run("amendments recompute the taxes", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		orderID := primitive.NewObjectID()
+		pending := bson.D{
+			{Key: "_id", Value: orderID},
+			{Key: "customer_id", Value: "C001"},
+			{Key: "items", Value: bson.A{bson.D{{Key: "product_id", Value: "P001"}, {Key: "quantity", Value: 1}, {Key: "price", Value: 100.0}}}},
+			{Key: "total", Value: 119.0},
+			{Key: "region", Value: "DE"},
+			{Key: "status", Value: "PENDING"},
+			{Key: "version", Value: int64(1)},
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, pending),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: pending}},
+		)
+
+		_, err := orderService.AmendOrder(orderID.Hex(), service.OrderAmendment{
+			Version: 1,
+			Items:   []models.LineItem{{ProductID: "P002", Quantity: 2}},
+		}, nil)
+		require.NoError(t, err)
+
+		mt.GetStartedEvent()
+		set := mt.GetStartedEvent().Command.Lookup("update", "$set").Document()
+		assert.Equal(t, 140.0, set.Lookup("subtotal").Double())
+		assert.Equal(t, 21.8, set.Lookup("tax_total").Double())
+		assert.Equal(t, 161.8, set.Lookup("total").Double())
+	})
+}
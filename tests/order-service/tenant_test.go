@@ -0,0 +1,161 @@
+package order_service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/rpc"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	orderv1 "github.com/dinesh-man/ecommerce-order-processing-system/pkg/pb/order/v1"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tenant"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	//launch miniredis for testing purposes
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("could not start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// Connect go-redis client to miniredis
+	rc := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+
+	tenantsFile := filepath.Join(t.TempDir(), "tenants.json")
+	require.NoError(t, os.WriteFile(tenantsFile, []byte(`{"tenants": {"acme": {"currency": "EUR", "max_items": 1}, "globex": {}}}`), 0o600))
+	tenants, err := tenant.LoadRegistry(tenantsFile)
+	require.NoError(t, err)
+
+	secret := []byte("test-secret")
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: secret})
+	require.NoError(t, err)
+	token := func(tenantID string) string {
+		claims := auth.NewClaims(auth.RoleSupport, "", "tester", time.Minute)
+		claims.TenantID = tenantID
+		token, err := auth.SignHS256(secret, claims)
+		require.NoError(t, err)
+		return token
+	}
+
+	mockInventory := newMockInventory(models.Product{ID: "P001", Name: "Laptop", Price: 1000, Currency: "USD", Stock: 5})
+	defer mockInventory.Close()
+	orderService := service.NewOrderService("orders", inventory.NewHTTPClient(mockInventory.URL, 0, ""), rc, "orders", payment.NewFakeGateway(payment.Approve, 0, 0))
+	routes := handler.NewOrderHandler(orderService, "", handler.DefaultOrderLimits(), verifier, tenants).Routes()
+	call := func(method, target, bearer, tenantHeader string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		if tenantHeader != "" {
+			req.Header.Set(tenant.Header, tenantHeader)
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	orderID := primitive.NewObjectID()
+	orderDoc := bson.D{
+		{Key: "_id", Value: orderID},
+		{Key: "tenant_id", Value: "acme"},
+		{Key: "customer_id", Value: "C001"},
+		{Key: "status", Value: "PENDING"},
+		{Key: "version", Value: int64(1)},
+	}
+
+	mt.Run("queries are scoped to the tenant of the token", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc))
+
+		rec := call(http.MethodGet, "/v1/orders/"+orderID.Hex(), token("acme"), "", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "tenant_id")
+		assert.Equal(t, "acme", mt.GetStartedEvent().Command.Lookup("filter", "tenant_id").StringValue())
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch))
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/v1/orders", token("globex"), "", nil).Code)
+		assert.Equal(t, "globex", mt.GetStartedEvent().Command.Lookup("filter", "tenant_id").StringValue())
+	})
+
+	mt.Run("tokens without a tenant act for the default tenant", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch))
+
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/v1/orders", token(""), "", nil).Code)
+		scope := mt.GetStartedEvent().Command.Lookup("filter", "tenant_id", "$in").Array()
+		assert.Equal(t, tenant.Default, scope.Index(0).Value().StringValue())
+	})
+
+	mt.Run("the tenant header must agree with the token", func(mt *mtest.T) {
+		rec := call(http.MethodGet, "/v1/orders", token("acme"), "globex", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), "tenant_mismatch")
+
+		rec = call(http.MethodGet, "/v1/orders", token("initech"), "", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "unknown_tenant")
+	})
+
+	mt.Run("orders follow the tenant's limits and currency", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+
+		body := []byte(`{"customer_id": "C001", "items": [{"product_id": "P001", "quantity": 1}, {"product_id": "P002", "quantity": 1}]}`)
+		rec := call(http.MethodPost, "/v1/orders", token("acme"), "", body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "validation_failed")
+
+		body = []byte(`{"customer_id": "C001", "items": [{"product_id": "P001", "quantity": 1}]}`)
+		rec = call(http.MethodPost, "/v1/orders", token("acme"), "", body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "currency_mismatch")
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		rec = call(http.MethodPost, "/v1/orders", token("globex"), "", body)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "globex", mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document().Lookup("tenant_id").StringValue())
+	})
+
+	mt.Run("gRPC calls act for the tenant of the token", func(mt *mtest.T) {
+		service.GetCollection = func(name string) *mongo.Collection {
+			return mt.Coll
+		}
+		client := orderv1.NewOrderServiceClient(serveBufconn(t, func(s *grpc.Server) {
+			orderv1.RegisterOrderServiceServer(s, rpc.NewOrderServer(orderService, handler.DefaultOrderLimits()))
+		}, grpc.ChainUnaryInterceptor(auth.UnaryServerInterceptor(verifier), tenant.UnaryServerInterceptor(tenants))))
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, orderDoc))
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token("acme"))
+		_, err := client.GetOrder(ctx, &orderv1.GetOrderRequest{Id: orderID.Hex()})
+		require.NoError(t, err)
+		assert.Equal(t, "acme", mt.GetStartedEvent().Command.Lookup("filter", "tenant_id").StringValue())
+	})
+}
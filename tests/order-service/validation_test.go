@@ -0,0 +1,59 @@
+package order_service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/handler"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/inventory"
+	"github.com/dinesh-man/ecommerce-order-processing-system/order-service/service"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/problem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateOrderValidation(t *testing.T) {
+	limits := handler.OrderLimits{MaxItems: 2, MaxQuantity: 5, MaxBodyBytes: 256}
+	orderHandler := handler.NewOrderHandler(service.NewOrderService("orders", inventory.NewHTTPClient("", 0, ""), nil, "orders", payment.NewFakeGateway(payment.Approve, 0, 0)), "", limits, nil, nil)
+
+	post := func(body string) (*httptest.ResponseRecorder, problem.Details) {
+		rec := httptest.NewRecorder()
+		orderHandler.CreateOrderHandler(rec, httptest.NewRequest(http.MethodPost, "/order", strings.NewReader(body)))
+		var details problem.Details
+		json.NewDecoder(rec.Body).Decode(&details)
+		return rec, details
+	}
+
+	t.Run("reports every invalid field", func(t *testing.T) {
+		rec, details := post(`{"items":[{"product_id":"P001","quantity":0},{"product_id":"P001","quantity":6},{"product_id":"","quantity":-1}]}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "validation_failed", details.Code)
+
+		fields := map[string]string{}
+		for _, fe := range details.Errors {
+			fields[fe.Field] = fe.Message
+		}
+		assert.Equal(t, "is required", fields["customer_id"])
+		assert.Equal(t, "must contain at most 2 items", fields["items"])
+		assert.Equal(t, "must be between 1 and 5", fields["items[0].quantity"])
+		assert.Equal(t, "duplicates items[0]", fields["items[1].product_id"])
+		assert.Equal(t, "is required", fields["items[2].product_id"])
+		assert.Equal(t, "must be between 1 and 5", fields["items[2].quantity"])
+	})
+
+	t.Run("rejects server assigned fields", func(t *testing.T) {
+		rec, details := post(`{"customer_id":"C001","status":"DELIVERED","items":[{"product_id":"P001","quantity":1}]}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "invalid_body", details.Code)
+		assert.Contains(t, details.Detail, `unknown field "status"`)
+	})
+
+	t.Run("rejects oversized bodies", func(t *testing.T) {
+		rec, details := post(`{"customer_id":"` + strings.Repeat("C", 300) + `"}`)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.Equal(t, "body_too_large", details.Code)
+	})
+}
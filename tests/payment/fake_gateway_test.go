@@ -0,0 +1,67 @@
+package payment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/payment"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFakeGateway(t *testing.T) {
+	order := &models.Order{ID: primitive.NewObjectID(), Total: 300, Currency: "USD"}
+
+	t.Run("approve, capture and refund", func(t *testing.T) {
+		gateway := payment.NewFakeGateway(payment.Approve, 0, 0)
+
+		record, err := payment.Authorize(context.Background(), gateway, order)
+		assert.NoError(t, err)
+		assert.Equal(t, models.PaymentAuthorized, record.Status)
+		assert.NotEmpty(t, record.TransactionID)
+
+		assert.NoError(t, payment.Capture(context.Background(), gateway, record))
+		assert.Equal(t, models.PaymentCaptured, record.Status)
+
+		assert.NoError(t, payment.Refund(context.Background(), gateway, record, 100))
+		assert.Equal(t, models.PaymentCaptured, record.Status)
+		assert.NoError(t, payment.Refund(context.Background(), gateway, record, 200))
+		assert.Equal(t, models.PaymentRefunded, record.Status)
+		assert.Error(t, payment.Refund(context.Background(), gateway, record, 1))
+	})
+
+	t.Run("decline above limit", func(t *testing.T) {
+		gateway := payment.NewFakeGateway(payment.Approve, 0, 100)
+
+		record, err := payment.Authorize(context.Background(), gateway, order)
+		assert.NoError(t, err)
+		assert.Equal(t, models.PaymentDeclined, record.Status)
+		assert.Empty(t, record.TransactionID)
+	})
+
+	t.Run("decline", func(t *testing.T) {
+		gateway := payment.NewFakeGateway(payment.Decline, 0, 0)
+
+		record, err := payment.Authorize(context.Background(), gateway, order)
+		assert.NoError(t, err)
+		assert.Equal(t, models.PaymentDeclined, record.Status)
+		assert.Equal(t, payment.ErrDeclined.Error(), record.FailureReason)
+
+		// calls on an existing payment fail and leave the record untouched
+		authorized := &models.Payment{TransactionID: "fake_tx", Amount: 300, Status: models.PaymentAuthorized}
+		assert.ErrorIs(t, payment.Capture(context.Background(), gateway, authorized), payment.ErrDeclined)
+		assert.ErrorIs(t, payment.Refund(context.Background(), gateway, authorized, 300), payment.ErrDeclined)
+		assert.Equal(t, models.PaymentAuthorized, authorized.Status)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		gateway := payment.NewFakeGateway(payment.Timeout, 0, 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := payment.Authorize(ctx, gateway, order)
+		assert.ErrorIs(t, err, payment.ErrTimeout)
+	})
+}
@@ -0,0 +1,119 @@
+package promotion
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/promotion"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDiscounts(t *testing.T) {
+	lines := []promotion.Line{
+		{ProductID: "P001", Category: "shoes", Brand: "acme", Quantity: 2, Price: 50},
+		{ProductID: "P002", Category: "socks", Brand: "acme", Quantity: 5, Price: 4},
+		{ProductID: "P003", Category: "shoes", Brand: "globex", Quantity: 1, Price: 80},
+	}
+
+	t.Run("percent off the matching lines", func(t *testing.T) {
+		p := &models.Promotion{ID: primitive.NewObjectID(), Name: "Shoe week", Type: models.PercentOff, Percent: 15, Categories: []string{"shoes"}}
+		discounts := promotion.Discounts(p, lines)
+		require.Len(t, discounts, 2)
+		assert.Equal(t, "P001", discounts[0].ProductID)
+		assert.Equal(t, 15.0, discounts[0].Amount)
+		assert.Equal(t, "P003", discounts[1].ProductID)
+		assert.Equal(t, 12.0, discounts[1].Amount)
+		assert.Equal(t, "Shoe week", discounts[0].Description)
+	})
+
+	t.Run("amount off is capped at the matching lines", func(t *testing.T) {
+		p := &models.Promotion{ID: primitive.NewObjectID(), Type: models.AmountOff, Amount: 50, ProductIDs: []string{"P002"}}
+		discounts := promotion.Discounts(p, lines)
+		require.Len(t, discounts, 1)
+		assert.Equal(t, "P002", discounts[0].ProductID)
+		assert.Equal(t, 20.0, discounts[0].Amount)
+	})
+
+	t.Run("restricted amount off is split over the matching lines", func(t *testing.T) {
+		p := &models.Promotion{ID: primitive.NewObjectID(), Type: models.AmountOff, Amount: 30, Categories: []string{"shoes"}}
+		discounts := promotion.Discounts(p, lines)
+		require.Len(t, discounts, 2)
+		assert.Equal(t, "P001", discounts[0].ProductID)
+		assert.Equal(t, 16.67, discounts[0].Amount)
+		assert.Equal(t, "P003", discounts[1].ProductID)
+		assert.Equal(t, 13.33, discounts[1].Amount)
+		assert.Equal(t, 30.0, promotion.Total(discounts))
+	})
+
+	t.Run("amount off the whole order names no product", func(t *testing.T) {
+		p := &models.Promotion{ID: primitive.NewObjectID(), Type: models.AmountOff, Amount: 30}
+		discounts := promotion.Discounts(p, lines)
+		require.Len(t, discounts, 1)
+		assert.Empty(t, discounts[0].ProductID)
+		assert.Equal(t, 30.0, discounts[0].Amount)
+	})
+
+	t.Run("buy x get y gives whole sets for free", func(t *testing.T) {
+		p := &models.Promotion{ID: primitive.NewObjectID(), Type: models.BuyXGetY, BuyQuantity: 2, GetQuantity: 1, Brands: []string{"acme"}}
+		discounts := promotion.Discounts(p, lines)
+		require.Len(t, discounts, 1)
+		assert.Equal(t, "P002", discounts[0].ProductID)
+		assert.Equal(t, 4.0, discounts[0].Amount)
+	})
+
+	t.Run("minimum subtotal of the matching lines", func(t *testing.T) {
+		p := &models.Promotion{ID: primitive.NewObjectID(), Type: models.AmountOff, Amount: 5, Categories: []string{"socks"}, MinSubtotal: 25}
+		assert.Empty(t, promotion.Discounts(p, lines))
+		p.MinSubtotal = 20
+		assert.Len(t, promotion.Discounts(p, lines), 1)
+	})
+
+	t.Run("no matching line", func(t *testing.T) {
+		p := &models.Promotion{ID: primitive.NewObjectID(), Type: models.PercentOff, Percent: 10, Brands: []string{"initech"}}
+		assert.Empty(t, promotion.Discounts(p, lines))
+	})
+}
+
+func TestBest(t *testing.T) {
+	lines := []promotion.Line{{ProductID: "P001", Quantity: 2, Price: 50}}
+	tenOff := models.Promotion{ID: primitive.NewObjectID(), Type: models.PercentOff, Percent: 10, Stackable: true}
+	fiveOff := models.Promotion{ID: primitive.NewObjectID(), Type: models.AmountOff, Amount: 5, Stackable: true}
+	twelveOff := models.Promotion{ID: primitive.NewObjectID(), Type: models.AmountOff, Amount: 12}
+	twentyOff := models.Promotion{ID: primitive.NewObjectID(), Type: models.PercentOff, Percent: 20}
+
+	t.Run("stackable promotions combine", func(t *testing.T) {
+		discounts := promotion.Best([]models.Promotion{tenOff, fiveOff, twelveOff}, lines)
+		require.Len(t, discounts, 2)
+		assert.Equal(t, 15.0, promotion.Total(discounts))
+	})
+
+	t.Run("a better exclusive promotion wins alone", func(t *testing.T) {
+		discounts := promotion.Best([]models.Promotion{tenOff, fiveOff, twelveOff, twentyOff}, lines)
+		require.Len(t, discounts, 1)
+		assert.Equal(t, twentyOff.ID.Hex(), discounts[0].PromotionID)
+		assert.Equal(t, 20.0, discounts[0].Amount)
+	})
+
+	t.Run("discounts never exceed the order", func(t *testing.T) {
+		all := models.Promotion{ID: primitive.NewObjectID(), Type: models.PercentOff, Percent: 100, Stackable: true}
+		discounts := promotion.Best([]models.Promotion{all, fiveOff}, lines)
+		assert.Equal(t, 100.0, promotion.Total(discounts))
+		require.Len(t, discounts, 1)
+	})
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+	earlier := now.Add(-time.Hour)
+
+	assert.NoError(t, promotion.Check(&models.Promotion{Active: true, StartsAt: &earlier, ExpiresAt: &later}, now))
+	assert.ErrorIs(t, promotion.Check(&models.Promotion{}, now), promotion.ErrInactive)
+	assert.ErrorIs(t, promotion.Check(&models.Promotion{Active: true, StartsAt: &later}, now), promotion.ErrNotStarted)
+	assert.ErrorIs(t, promotion.Check(&models.Promotion{Active: true, ExpiresAt: &earlier}, now), promotion.ErrExpired)
+	assert.ErrorIs(t, promotion.Check(&models.Promotion{Active: true, UsageLimit: 3, UsageCount: 3}, now), promotion.ErrUsedUp)
+	assert.NoError(t, promotion.Check(&models.Promotion{Active: true, UsageCount: 3}, now))
+}
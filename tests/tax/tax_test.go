@@ -0,0 +1,92 @@
+package tax
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/tax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTable(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tax.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"default_region": "DE", "rates": [
+		{"region": "DE", "name": "VAT", "rate": 19},
+		{"region": "DE", "category": "Books", "name": "VAT reduced", "rate": 7},
+		{"region": "US", "name": "Sales tax", "rate": 5},
+		{"region": "US-CA", "name": "CA sales tax", "rate": 7.25},
+		{"category": "gift-cards", "name": "Exempt", "rate": 0}
+	]}`), 0o600))
+	table, err := tax.LoadTable(file)
+	require.NoError(t, err)
+	assert.False(t, table.Inclusive())
+
+	lines := []tax.Line{
+		{ProductID: "P001", Category: "shoes", Quantity: 2, Amount: 100},
+		{ProductID: "P002", Category: "books", Quantity: 1, Amount: 20},
+		{ProductID: "P003", Category: "gift-cards", Quantity: 1, Amount: 50},
+	}
+
+	t.Run("category rates before the region rate", func(t *testing.T) {
+		taxes, err := table.Calculate(context.Background(), "de", lines)
+		require.NoError(t, err)
+		require.Len(t, taxes, 3)
+		assert.Equal(t, "VAT", taxes[0].Name)
+		assert.Equal(t, 19.0, taxes[0].Amount)
+		assert.Equal(t, 100.0, taxes[0].Taxable)
+		assert.Equal(t, "VAT reduced", taxes[1].Name)
+		assert.Equal(t, 1.4, taxes[1].Amount)
+		// The exemption of every region is less specific than the region rate
+		assert.Equal(t, "VAT", taxes[2].Name)
+		assert.Equal(t, 29.9, tax.Total(taxes))
+	})
+
+	t.Run("subdivisions fall back to their country", func(t *testing.T) {
+		taxes, err := table.Calculate(context.Background(), "US-CA", lines[:1])
+		require.NoError(t, err)
+		assert.Equal(t, 7.25, taxes[0].Amount)
+		assert.Equal(t, "US-CA", taxes[0].Region)
+
+		taxes, err = table.Calculate(context.Background(), "US-NY", lines[:1])
+		require.NoError(t, err)
+		assert.Equal(t, 5.0, taxes[0].Amount)
+		assert.Equal(t, "US", taxes[0].Region)
+	})
+
+	t.Run("regions without rates use the rates of every region", func(t *testing.T) {
+		taxes, err := table.Calculate(context.Background(), "FR", lines)
+		require.NoError(t, err)
+		require.Len(t, taxes, 1)
+		assert.Equal(t, "P003", taxes[0].ProductID)
+		assert.Zero(t, taxes[0].Amount)
+	})
+
+	t.Run("orders without a region use the default region", func(t *testing.T) {
+		taxes, err := table.Calculate(context.Background(), "", lines[:1])
+		require.NoError(t, err)
+		assert.Equal(t, "DE", taxes[0].Region)
+	})
+}
+
+func TestInclusiveTable(t *testing.T) {
+	table, err := tax.NewTable([]tax.Rate{{Region: "DE", Name: "VAT", Percent: 19}}, true, "")
+	require.NoError(t, err)
+	assert.True(t, table.Inclusive())
+
+	taxes, err := table.Calculate(context.Background(), "DE", []tax.Line{{ProductID: "P001", Quantity: 1, Amount: 119}})
+	require.NoError(t, err)
+	require.Len(t, taxes, 1)
+	assert.Equal(t, 100.0, taxes[0].Taxable)
+	assert.Equal(t, 19.0, taxes[0].Amount)
+}
+
+func TestInvalidTable(t *testing.T) {
+	_, err := tax.NewTable([]tax.Rate{{Region: "DE", Name: "VAT", Percent: 190}}, false, "")
+	assert.Error(t, err)
+
+	_, err = tax.NewTable([]tax.Rate{{Region: "DE", Name: "VAT", Percent: 19}, {Region: "de", Name: "VAT again", Percent: 20}}, false, "")
+	assert.Error(t, err)
+}
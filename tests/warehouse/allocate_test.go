@@ -0,0 +1,78 @@
+package warehouse
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/models"
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/warehouse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "warehouses.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"warehouses": [
+		{"id": "fra", "name": "Frankfurt", "location": {"latitude": 50.11, "longitude": 8.68}, "priority": 2},
+		{"id": "mad", "name": "Madrid", "location": {"latitude": 40.42, "longitude": -3.70}, "priority": 1},
+		{"id": "waw", "name": "Warsaw", "location": {"latitude": 52.23, "longitude": 21.01}, "priority": 3}
+	]}`), 0o600))
+	reg, err := warehouse.LoadRegistry(file)
+	require.NoError(t, err)
+
+	stock := []models.WarehouseStock{{WarehouseID: "fra", Stock: 5}, {WarehouseID: "mad", Stock: 2}, {WarehouseID: "waw", Stock: 9}}
+	berlin := &models.Location{Latitude: 52.52, Longitude: 13.40}
+
+	t.Run("priority", func(t *testing.T) {
+		allocator := warehouse.NewAllocator(reg, warehouse.RulePriority)
+		id, ok := allocator.Allocate(berlin, 2, stock)
+		require.True(t, ok)
+		assert.Equal(t, "mad", id)
+
+		// Madrid does not hold enough units, Frankfurt comes next
+		id, _ = allocator.Allocate(berlin, 3, stock)
+		assert.Equal(t, "fra", id)
+	})
+
+	t.Run("most stock", func(t *testing.T) {
+		id, ok := warehouse.NewAllocator(reg, warehouse.RuleMostStock).Allocate(nil, 1, stock)
+		require.True(t, ok)
+		assert.Equal(t, "waw", id)
+	})
+
+	t.Run("closest", func(t *testing.T) {
+		allocator := warehouse.NewAllocator(reg, warehouse.RuleClosest)
+		id, _ := allocator.Allocate(berlin, 1, stock)
+		assert.Equal(t, "fra", id)
+		id, _ = allocator.Allocate(&models.Location{Latitude: 41.39, Longitude: 2.17}, 1, stock)
+		assert.Equal(t, "mad", id)
+
+		// Without a shipping location the priority rule applies
+		id, _ = allocator.Allocate(nil, 1, stock)
+		assert.Equal(t, "mad", id)
+	})
+
+	t.Run("lines are fulfilled by a single warehouse", func(t *testing.T) {
+		_, ok := warehouse.NewAllocator(reg, warehouse.RulePriority).Allocate(berlin, 10, stock)
+		assert.False(t, ok)
+	})
+
+	t.Run("unknown warehouses rank last", func(t *testing.T) {
+		id, _ := warehouse.NewAllocator(reg, warehouse.RuleMostStock).Allocate(nil, 1, append(stock, models.WarehouseStock{WarehouseID: "old", Stock: 50}))
+		assert.Equal(t, "waw", id)
+
+		// Without a registry warehouses are ranked by id
+		var allocator *warehouse.Allocator
+		id, _ = allocator.Allocate(berlin, 1, stock)
+		assert.Equal(t, "fra", id)
+	})
+
+	t.Run("rules", func(t *testing.T) {
+		rule, err := warehouse.ParseRule("")
+		require.NoError(t, err)
+		assert.Equal(t, warehouse.RulePriority, rule)
+		_, err = warehouse.ParseRule("cheapest")
+		assert.Error(t, err)
+	})
+}
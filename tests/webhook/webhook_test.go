@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSender(t *testing.T) {
+	t.Run("deliveries are signed", func(t *testing.T) {
+		var body []byte
+		var header http.Header
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = io.ReadAll(r.Body)
+			header = r.Header
+		}))
+		defer server.Close()
+
+		err := webhook.NewSender([]string{server.URL}, "s3cret").Send(context.Background(), "inventory.low_stock", map[string]int{"stock": 2})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"stock": 2}`, string(body))
+		assert.Equal(t, "inventory.low_stock", header.Get(webhook.EventHeader))
+		assert.Equal(t, webhook.Sign([]byte("s3cret"), body), header.Get(webhook.SignatureHeader))
+	})
+
+	t.Run("server errors are retried", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+
+		require.NoError(t, webhook.NewSender([]string{server.URL}, "").Send(context.Background(), "event", struct{}{}))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("rejected deliveries are not retried", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		assert.Error(t, webhook.NewSender([]string{server.URL}, "").Send(context.Background(), "event", struct{}{}))
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("no URLs means no sender", func(t *testing.T) {
+		t.Setenv("ALERT_WEBHOOK_URLS", " ")
+		sender := webhook.SenderFromEnv("ALERT_WEBHOOK")
+		assert.Nil(t, sender)
+		assert.NoError(t, sender.Send(context.Background(), "event", struct{}{}))
+	})
+}
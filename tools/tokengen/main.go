@@ -0,0 +1,119 @@
+// Command tokengen issues JWTs for local development and tests.
+//
+//	tokengen -secret dev-secret -role customer -customer C001
+//	tokengen -secret dev-secret -role admin -tenant acme
+//	tokengen -genkey ./keys                       # writes keys/private.pem and keys/jwks.json
+//	tokengen -key ./keys/private.pem -role admin  # RS256 token verified through AUTH_JWKS_FILE
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dinesh-man/ecommerce-order-processing-system/pkg/auth"
+)
+
+func main() {
+	role := flag.String("role", auth.RoleCustomer, "role claim: customer, support or admin")
+	customer := flag.String("customer", "", "customer_id claim, required for the customer role")
+	tenant := flag.String("tenant", "", "tenant_id claim, the default tenant when empty")
+	subject := flag.String("sub", "local-dev", "subject claim")
+	ttl := flag.Duration("ttl", time.Hour, "token lifetime")
+	issuer := flag.String("iss", os.Getenv("AUTH_ISSUER"), "issuer claim")
+	audience := flag.String("aud", os.Getenv("AUTH_AUDIENCE"), "audience claim")
+	secret := flag.String("secret", os.Getenv("AUTH_HS256_SECRET"), "HS256 shared secret")
+	keyFile := flag.String("key", "", "RSA private key (PEM) to sign an RS256 token with")
+	kid := flag.String("kid", "dev", "key id of the RSA key in the JWKS")
+	genKey := flag.String("genkey", "", "directory to write a new RSA key and its JWKS to")
+	flag.Parse()
+
+	if *genKey != "" {
+		if err := generateKey(*genKey, *kid); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	claims := auth.NewClaims(*role, *customer, *subject, *ttl)
+	claims.TenantID = *tenant
+	claims.Issuer = *issuer
+	if *audience != "" {
+		claims.Audience = []string{*audience}
+	}
+
+	var token string
+	var err error
+	switch {
+	case *keyFile != "":
+		var key *rsa.PrivateKey
+		if key, err = readKey(*keyFile); err == nil {
+			token, err = auth.SignRS256(key, *kid, claims)
+		}
+	case *secret != "":
+		token, err = auth.SignHS256([]byte(*secret), claims)
+	default:
+		err = fmt.Errorf("either -secret or -key is required")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(token)
+}
+
+// generateKey writes private.pem and the matching jwks.json to dir
+func generateKey(dir, kid string) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(filepath.Join(dir, "private.pem"), keyPEM, 0o600); err != nil {
+		return err
+	}
+
+	jwks, err := json.MarshalIndent(auth.JWKS{Keys: []auth.JWK{auth.PublicJWK(kid, &key.PublicKey)}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "jwks.json"), jwks, 0o644); err != nil {
+		return err
+	}
+	log.Printf("Wrote %s and %s", filepath.Join(dir, "private.pem"), filepath.Join(dir, "jwks.json"))
+	return nil
+}
+
+func readKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an RSA key", path)
+	}
+	return key, nil
+}